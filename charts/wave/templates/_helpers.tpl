@@ -20,3 +20,27 @@ app: {{ template "wave-name" . }}
 release: {{ .Release.Name | quote }}
 heritage: {{ .Release.Service | quote }}
 {{- end -}}
+
+{{/*
+Select the workloads sent to the workload webhooks. Installations with a
+controllerClass default to the workloads with the controller class label.
+*/}}
+{{- define "wave-webhooks.objectSelector" -}}
+{{- if .Values.webhooks.objectSelector -}}
+{{- toYaml .Values.webhooks.objectSelector -}}
+{{- else if .Values.controllerClass -}}
+matchLabels:
+  wave.pusher.com/controller-class: {{ .Values.controllerClass | quote }}
+{{- end -}}
+{{- end -}}
+
+{{/*
+Create the leader election ID, one per controller class.
+*/}}
+{{- define "wave-leader-election-id" -}}
+{{- if .Values.controllerClass -}}
+{{- printf "%s-%s" (include "wave-fullname" .) .Values.controllerClass | trunc 63 | trimSuffix "-" -}}
+{{- else -}}
+{{- include "wave-fullname" . -}}
+{{- end -}}
+{{- end -}}
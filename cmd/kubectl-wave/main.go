@@ -0,0 +1,362 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// kubectl-wave is a kubectl plugin which shows the dependencies and the
+// configuration hashes of workloads managed by Wave
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/go-logr/logr"
+	"github.com/wave-k8s/wave/pkg/core"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const usage = `Usage: kubectl wave <command> [flags]
+
+Commands:
+  deps <kind>/<name>                    List the ConfigMaps and Secrets referenced by a workload
+  dependents <configmap|secret>/<name>  List the workloads which roll when the child changes
+  status [<kind>/<name>]                Compare the current with the desired configuration hash
+  rehash <kind>/<name>                  Make the controller re-hash a workload now
+
+Flags:
+`
+
+// options holds the flags shared by all commands
+type options struct {
+	kubeconfig    string
+	context       string
+	namespace     string
+	allNamespaces bool
+	// wave holds the flags of the manager which affect the answers
+	wave core.Flags
+}
+
+// command is the state shared by all commands
+type command struct {
+	client    client.Client
+	inspector *core.Inspector
+	namespace string
+	options   options
+	out       io.Writer
+}
+
+func main() {
+	logf.SetLogger(logr.Discard())
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout io.Writer, stderr io.Writer) int {
+	var opts options
+	flags := flag.NewFlagSet("kubectl-wave", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&opts.kubeconfig, "kubeconfig", "", "Path to the kubeconfig file")
+	flags.StringVar(&opts.context, "context", "", "Name of the kubeconfig context")
+	flags.StringVar(&opts.namespace, "n", "", "Namespace (defaults to the namespace of the context)")
+	flags.BoolVar(&opts.allNamespaces, "A", false, "Consider workloads in all namespaces (dependents, status)")
+	opts.wave.BindFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		flags.PrintDefaults()
+	}
+
+	if len(args) == 0 {
+		flags.Usage()
+		return 2
+	}
+	name := args[0]
+	positional, err := parseInterspersed(flags, args[1:])
+	if err != nil {
+		return 2
+	}
+
+	c, err := newCommand(opts, stdout)
+	if err != nil {
+		fmt.Fprintf(stderr, "error: %v\n", err)
+		return 1
+	}
+
+	ctx := context.Background()
+	switch name {
+	case "deps":
+		err = c.deps(ctx, positional)
+	case "dependents":
+		err = c.dependents(ctx, positional)
+	case "status":
+		err = c.status(ctx, positional)
+	case "rehash":
+		err = c.rehash(ctx, positional)
+	default:
+		flags.Usage()
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// parseInterspersed parses flags before and after positional arguments
+func parseInterspersed(flags *flag.FlagSet, args []string) ([]string, error) {
+	positional := []string{}
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+		if flags.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, flags.Arg(0))
+		args = flags.Args()[1:]
+	}
+}
+
+func newCommand(opts options, out io.Writer) (*command, error) {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = opts.kubeconfig
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, &clientcmd.ConfigOverrides{CurrentContext: opts.context})
+
+	config, err := clientConfig.ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("error loading kubeconfig: %v", err)
+	}
+	namespace := opts.namespace
+	if namespace == "" {
+		namespace, _, err = clientConfig.Namespace()
+		if err != nil {
+			return nil, fmt.Errorf("error loading namespace: %v", err)
+		}
+	}
+
+	c, err := client.New(config, client.Options{Scheme: scheme.Scheme})
+	if err != nil {
+		return nil, fmt.Errorf("error creating client: %v", err)
+	}
+	return newCommandWithClient(c, namespace, opts, out)
+}
+
+// newCommandWithClient sets up the commands for the client and the namespace
+func newCommandWithClient(c client.Client, namespace string, opts options, out io.Writer) (*command, error) {
+	handlerOptions, err := opts.wave.HandlerOptions()
+	if err != nil {
+		return nil, err
+	}
+	return &command{
+		client:    c,
+		inspector: core.NewInspector(c, handlerOptions),
+		namespace: namespace,
+		options:   opts,
+		out:       out,
+	}, nil
+}
+
+// getWorkload fetches the workload given as kind/name
+func (c *command) getWorkload(ctx context.Context, args []string) (client.Object, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("expected exactly one workload as <kind>/<name>")
+	}
+	parts := strings.SplitN(args[0], "/", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid workload %q, expected <kind>/<name>", args[0])
+	}
+	obj, err := core.NewWorkload(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	if err := c.client.Get(ctx, client.ObjectKey{Namespace: c.namespace, Name: parts[1]}, obj); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// listWorkloads lists all workloads enabled for Wave in the namespace (or all
+// namespaces with -A)
+func (c *command) listWorkloads(ctx context.Context) ([]client.Object, error) {
+	opts := []client.ListOption{}
+	if !c.options.allNamespaces {
+		opts = append(opts, client.InNamespace(c.namespace))
+	}
+
+	workloads := []client.Object{}
+	deployments := &appsv1.DeploymentList{}
+	if err := c.client.List(ctx, deployments, opts...); err != nil {
+		return nil, err
+	}
+	for i := range deployments.Items {
+		workloads = append(workloads, &deployments.Items[i])
+	}
+	statefulSets := &appsv1.StatefulSetList{}
+	if err := c.client.List(ctx, statefulSets, opts...); err != nil {
+		return nil, err
+	}
+	for i := range statefulSets.Items {
+		workloads = append(workloads, &statefulSets.Items[i])
+	}
+	daemonSets := &appsv1.DaemonSetList{}
+	if err := c.client.List(ctx, daemonSets, opts...); err != nil {
+		return nil, err
+	}
+	for i := range daemonSets.Items {
+		workloads = append(workloads, &daemonSets.Items[i])
+	}
+
+	enabled := []client.Object{}
+	for _, workload := range workloads {
+		if c.inspector.IsEnabled(workload) {
+			enabled = append(enabled, workload)
+		}
+	}
+	return enabled, nil
+}
+
+func (c *command) deps(ctx context.Context, args []string) error {
+	workload, err := c.getWorkload(ctx, args)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(c.out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "KIND\tNAMESPACE\tNAME\tREQUIRED\tKEYS")
+	for _, ref := range c.inspector.Dependencies(workload) {
+		keys := "*"
+		if ref.Keys != nil {
+			keys = strings.Join(ref.Keys, ",")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%t\t%s\n", ref.Kind, ref.Name.Namespace, ref.Name.Name, ref.Required, keys)
+	}
+	return w.Flush()
+}
+
+func (c *command) dependents(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("expected exactly one child as configmap/<name> or secret/<name>")
+	}
+	parts := strings.SplitN(args[0], "/", 2)
+	kind := strings.ToLower(parts[0])
+	switch kind {
+	case "cm", "configmaps":
+		kind = "configmap"
+	case "secrets":
+		kind = "secret"
+	}
+	if len(parts) != 2 || (kind != "configmap" && kind != "secret") {
+		return fmt.Errorf("invalid child %q, expected configmap/<name> or secret/<name>", args[0])
+	}
+	name := client.ObjectKey{Namespace: c.namespace, Name: parts[1]}
+
+	workloads, err := c.listWorkloads(ctx)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(c.out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "KIND\tNAMESPACE\tNAME\tREQUIRED\tKEYS")
+	for _, workload := range workloads {
+		for _, ref := range c.inspector.Dependencies(workload) {
+			if ref.Kind != kind || ref.Name != name {
+				continue
+			}
+			keys := "*"
+			if ref.Keys != nil {
+				keys = strings.Join(ref.Keys, ",")
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%t\t%s\n", core.KindOf(workload), workload.GetNamespace(), workload.GetName(), ref.Required, keys)
+		}
+	}
+	return w.Flush()
+}
+
+func (c *command) status(ctx context.Context, args []string) error {
+	var workloads []client.Object
+	if len(args) == 0 {
+		var err error
+		workloads, err = c.listWorkloads(ctx)
+		if err != nil {
+			return err
+		}
+	} else {
+		workload, err := c.getWorkload(ctx, args)
+		if err != nil {
+			return err
+		}
+		workloads = []client.Object{workload}
+	}
+
+	w := tabwriter.NewWriter(c.out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "KIND\tNAMESPACE\tNAME\tCURRENT\tDESIRED\tSTATUS\tROLLOUT")
+	for _, workload := range workloads {
+		current, desired, err := c.inspector.ConfigHashes(ctx, workload)
+		status := "InSync"
+		switch {
+		case !c.inspector.IsEnabled(workload):
+			status = "NotEnabled"
+		case err != nil:
+			status = fmt.Sprintf("Error: %v", err)
+		case current != desired:
+			status = "Drift"
+		}
+		rollout := workload.GetAnnotations()[core.RolloutStatusAnnotation]
+		if rollout == "" {
+			rollout = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", core.KindOf(workload), workload.GetNamespace(), workload.GetName(), shortHash(current), shortHash(desired), status, rollout)
+	}
+	return w.Flush()
+}
+
+func (c *command) rehash(ctx context.Context, args []string) error {
+	workload, err := c.getWorkload(ctx, args)
+	if err != nil {
+		return err
+	}
+	if !c.inspector.IsEnabled(workload) {
+		return fmt.Errorf("%s %s/%s is not managed by Wave", core.KindOf(workload), workload.GetNamespace(), workload.GetName())
+	}
+
+	current, desired, hashErr := c.inspector.ConfigHashes(ctx, workload)
+	if err := c.inspector.RequestRehash(ctx, workload); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "%s %s/%s re-hash requested\n", core.KindOf(workload), workload.GetNamespace(), workload.GetName())
+	// The controller only rolls the workload if its hash changes
+	if hashErr == nil && current == desired {
+		fmt.Fprintln(c.out, "The configuration hash is up to date, so the workload is not restarted. Use kubectl rollout restart to restart it.")
+	}
+	return nil
+}
+
+// shortHash shortens a hash for display
+func shortHash(hash string) string {
+	if hash == "" {
+		return "-"
+	}
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+	return hash
+}
@@ -0,0 +1,189 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/pkg/core"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("kubectl-wave commands", func() {
+	var c client.Client
+	var out *bytes.Buffer
+	var deploymentObject *appsv1.Deployment
+
+	BeforeEach(func() {
+		deploymentObject = utils.ExampleDeployment.DeepCopy()
+		deploymentObject.Annotations[core.RequiredAnnotation] = "true"
+
+		objects := []client.Object{
+			deploymentObject,
+			utils.ExampleConfigMap1.DeepCopy(),
+			utils.ExampleConfigMap2.DeepCopy(),
+			utils.ExampleConfigMap3.DeepCopy(),
+			utils.ExampleConfigMap4.DeepCopy(),
+			utils.ExampleConfigMap5.DeepCopy(),
+			utils.ExampleConfigMap6.DeepCopy(),
+		}
+		for _, s := range []*corev1.Secret{
+			utils.ExampleSecret1.DeepCopy(),
+			utils.ExampleSecret2.DeepCopy(),
+			utils.ExampleSecret3.DeepCopy(),
+			utils.ExampleSecret4.DeepCopy(),
+			utils.ExampleSecret5.DeepCopy(),
+			utils.ExampleSecret6.DeepCopy(),
+		} {
+			// The fake client does not merge stringData into data like the API server
+			if s.Data == nil {
+				s.Data = map[string][]byte{}
+			}
+			for key, value := range s.StringData {
+				s.Data[key] = []byte(value)
+			}
+			objects = append(objects, s)
+		}
+		c = fake.NewClientBuilder().WithObjects(objects...).Build()
+		out = &bytes.Buffer{}
+	})
+
+	// newTestCommand sets up the commands in the default namespace with the
+	// given flags
+	newTestCommand := func(args ...string) (*command, error) {
+		var opts options
+		flags := flag.NewFlagSet("kubectl-wave", flag.ContinueOnError)
+		opts.wave.BindFlags(flags)
+		Expect(flags.Parse(args)).To(Succeed())
+		return newCommandWithClient(c, "default", opts, out)
+	}
+
+	It("lists the dependencies of a workload", func() {
+		cmd, err := newTestCommand()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cmd.deps(context.TODO(), []string{"deploy/example"})).To(Succeed())
+		Expect(out.String()).To(MatchRegexp(`configmap\s+default\s+example1\s+true\s+\*`))
+		Expect(out.String()).To(MatchRegexp(`configmap\s+default\s+example3\s+true\s+key1,key2,key4`))
+		Expect(out.String()).To(MatchRegexp(`secret\s+ns1\s+test-secret1\s+false\s+\*`))
+	})
+
+	It("rejects unsupported kinds", func() {
+		cmd, err := newTestCommand()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cmd.deps(context.TODO(), []string{"job/example"})).To(MatchError(ContainSubstring("unsupported workload kind")))
+		Expect(cmd.deps(context.TODO(), []string{"example"})).To(MatchError(ContainSubstring("expected <kind>/<name>")))
+	})
+
+	It("applies the flags of the manager", func() {
+		cmd, err := newTestCommand("--cross-namespace-references", "default=ns1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cmd.deps(context.TODO(), []string{"deployment/example"})).To(Succeed())
+		Expect(out.String()).To(ContainSubstring("test-secret1"))
+		Expect(out.String()).NotTo(ContainSubstring("test-secret2"))
+
+		_, err = newTestCommand("--default-mode", "always")
+		Expect(err).To(MatchError(ContainSubstring("invalid --default-mode")))
+	})
+
+	It("lists the workloads which depend on a child", func() {
+		cmd, err := newTestCommand()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cmd.dependents(context.TODO(), []string{"secret/example1"})).To(Succeed())
+		Expect(out.String()).To(MatchRegexp(`Deployment\s+default\s+example\s+true\s+\*`))
+
+		out.Reset()
+		Expect(cmd.dependents(context.TODO(), []string{"cm/unused"})).To(Succeed())
+		Expect(out.String()).NotTo(ContainSubstring("Deployment"))
+		Expect(cmd.dependents(context.TODO(), []string{"pod/example"})).To(MatchError(ContainSubstring("invalid child")))
+	})
+
+	It("reports drift until the workload has the desired hash", func() {
+		cmd, err := newTestCommand()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cmd.status(context.TODO(), nil)).To(Succeed())
+		Expect(out.String()).To(MatchRegexp(`Deployment\s+default\s+example\s+-\s+\w+\s+Drift`))
+
+		_, desired, err := cmd.inspector.ConfigHashes(context.TODO(), deploymentObject)
+		Expect(err).NotTo(HaveOccurred())
+		deploymentObject.Spec.Template.Annotations = map[string]string{core.ConfigHashAnnotation: desired}
+		Expect(c.Update(context.TODO(), deploymentObject)).To(Succeed())
+
+		out.Reset()
+		Expect(cmd.status(context.TODO(), []string{"deployment/example"})).To(Succeed())
+		Expect(out.String()).To(MatchRegexp(`Deployment\s+default\s+example\s+\w+\s+\w+\s+InSync`))
+	})
+
+	It("requests a re-hash from the controller", func() {
+		cmd, err := newTestCommand()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cmd.rehash(context.TODO(), []string{"deployment/example"})).To(Succeed())
+		Expect(out.String()).To(ContainSubstring("Deployment default/example re-hash requested"))
+		Expect(out.String()).NotTo(ContainSubstring("not restarted"))
+
+		updated := &appsv1.Deployment{}
+		Expect(c.Get(context.TODO(), client.ObjectKeyFromObject(deploymentObject), updated)).To(Succeed())
+		Expect(updated.Annotations).To(HaveKey(core.RehashRequestedAnnotation))
+		// Only the controller updates the hash
+		Expect(updated.Spec.Template.Annotations).NotTo(HaveKey(core.ConfigHashAnnotation))
+	})
+
+	It("says that workloads with an up to date hash are not restarted", func() {
+		cmd, err := newTestCommand()
+		Expect(err).NotTo(HaveOccurred())
+		_, desired, err := cmd.inspector.ConfigHashes(context.TODO(), deploymentObject)
+		Expect(err).NotTo(HaveOccurred())
+		deploymentObject.Spec.Template.Annotations = map[string]string{core.ConfigHashAnnotation: desired}
+		Expect(c.Update(context.TODO(), deploymentObject)).To(Succeed())
+
+		Expect(cmd.rehash(context.TODO(), []string{"deployment/example"})).To(Succeed())
+		Expect(out.String()).To(ContainSubstring("the workload is not restarted. Use kubectl rollout restart"))
+	})
+
+	It("does not re-hash workloads which are not enabled", func() {
+		delete(deploymentObject.Annotations, core.RequiredAnnotation)
+		Expect(c.Update(context.TODO(), deploymentObject)).To(Succeed())
+		cmd, err := newTestCommand()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cmd.rehash(context.TODO(), []string{"deployment/example"})).To(MatchError(ContainSubstring("is not managed by Wave")))
+	})
+
+	It("considers workloads enabled like the controller", func() {
+		delete(deploymentObject.Annotations, core.RequiredAnnotation)
+		Expect(c.Update(context.TODO(), deploymentObject)).To(Succeed())
+		namespace := &corev1.Namespace{}
+		namespace.SetName("default")
+		namespace.SetLabels(map[string]string{core.RequiredAnnotation: "true"})
+		Expect(c.Create(context.TODO(), namespace)).To(Succeed())
+
+		cmd, err := newTestCommand("-namespace-opt-in")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cmd.rehash(context.TODO(), []string{"deployment/example"})).To(Succeed())
+
+		Expect(c.Get(context.TODO(), client.ObjectKeyFromObject(deploymentObject), deploymentObject)).To(Succeed())
+		deploymentObject.Annotations[core.ControllerClassAnnotation] = "team-a"
+		Expect(c.Update(context.TODO(), deploymentObject)).To(Succeed())
+		Expect(cmd.rehash(context.TODO(), []string{"deployment/example"})).To(MatchError(ContainSubstring("is not managed by Wave")))
+	})
+})
@@ -0,0 +1,268 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/wave-k8s/wave/pkg/core"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+// manifest is a single document of the YAML stream
+type manifest struct {
+	raw    []byte
+	object *unstructured.Unstructured
+	// modified is true if the object has to be written instead of raw
+	modified bool
+}
+
+// runHash implements the hash subcommand. It reads a YAML stream, sets the
+// config-hash annotation on all workloads the controller would manage with
+// the same flags and writes the stream back out.
+func runHash(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("hash", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	filename := flags.String("f", "-", "File to read the manifests from (- for stdin)")
+	namespace := flags.String("namespace", "default", "Namespace of manifests without a namespace")
+	strict := flags.Bool("strict", false, "Exit with an error if a required ConfigMap or Secret is not part of the manifests")
+	var handlerFlags core.Flags
+	handlerFlags.BindFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: %s hash [-f manifests.yaml] [-namespace default] [-strict] [manager flags]\n\n", os.Args[0])
+		fmt.Fprintln(stderr, "Sets the wave.pusher.com/config-hash annotation on all workloads in the manifests")
+		fmt.Fprintln(stderr, "using the ConfigMaps and Secrets in the same manifests. Pass the flags of the")
+		fmt.Fprintln(stderr, "manager which decide which workloads Wave manages and which references it hashes,")
+		fmt.Fprintln(stderr, "e.g. -default-mode or -cross-namespace-references.")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	opts, err := handlerFlags.HandlerOptions()
+	if err != nil {
+		fmt.Fprintf(stderr, "%v\n", err)
+		return 2
+	}
+
+	input := stdin
+	if *filename != "-" {
+		f, err := os.Open(*filename)
+		if err != nil {
+			fmt.Fprintf(stderr, "error opening manifests: %v\n", err)
+			return 1
+		}
+		defer f.Close()
+		input = f
+	}
+
+	manifests, err := readManifests(input)
+	if err != nil {
+		fmt.Fprintf(stderr, "error reading manifests: %v\n", err)
+		return 1
+	}
+
+	missingRequired, err := hashManifests(manifests, *namespace, opts, stderr)
+	if err != nil {
+		fmt.Fprintf(stderr, "%v\n", err)
+		return 1
+	}
+
+	if err := writeManifests(stdout, manifests); err != nil {
+		fmt.Fprintf(stderr, "error writing manifests: %v\n", err)
+		return 1
+	}
+	if *strict && missingRequired {
+		return 1
+	}
+	return 0
+}
+
+// readManifests splits the YAML stream into its documents
+func readManifests(r io.Reader) ([]*manifest, error) {
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(r))
+	manifests := []*manifest{}
+	for {
+		raw, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return manifests, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(bytes.TrimSpace(raw)) == 0 {
+			continue
+		}
+
+		m := &manifest{raw: raw}
+		obj := map[string]interface{}{}
+		if err := yaml.Unmarshal(raw, &obj); err != nil {
+			return nil, err
+		}
+		if len(obj) > 0 {
+			m.object = &unstructured.Unstructured{Object: obj}
+		}
+		manifests = append(manifests, m)
+	}
+}
+
+// hashManifests sets the config-hash annotation on all workloads the
+// controller would manage with the options and reports unresolved references.
+// Workloads with unresolved required references are left unchanged since the
+// controller does not hash them either. Objects without a namespace are
+// treated as objects in the given namespace. It returns true if a required
+// reference could not be resolved.
+func hashManifests(manifests []*manifest, namespace string, opts core.HandlerOptions, stderr io.Writer) (bool, error) {
+	defaultNamespace := func(obj client.Object) {
+		if obj.GetNamespace() == "" {
+			obj.SetNamespace(namespace)
+		}
+	}
+
+	objects := core.Manifests{}
+	for _, m := range manifests {
+		if m.object == nil || m.object.GetAPIVersion() != "v1" {
+			continue
+		}
+		switch m.object.GetKind() {
+		case "ConfigMap":
+			cm := &corev1.ConfigMap{}
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(m.object.Object, cm); err != nil {
+				return false, fmt.Errorf("error decoding ConfigMap %s: %v", m.object.GetName(), err)
+			}
+			defaultNamespace(cm)
+			objects.ConfigMaps = append(objects.ConfigMaps, cm)
+		case "Secret":
+			s := &corev1.Secret{}
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(m.object.Object, s); err != nil {
+				return false, fmt.Errorf("error decoding Secret %s: %v", m.object.GetName(), err)
+			}
+			// The API server merges stringData into data
+			if s.Data == nil {
+				s.Data = make(map[string][]byte)
+			}
+			for key, value := range s.StringData {
+				s.Data[key] = []byte(value)
+			}
+			defaultNamespace(s)
+			objects.Secrets = append(objects.Secrets, s)
+		case "Namespace":
+			ns := &corev1.Namespace{}
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(m.object.Object, ns); err != nil {
+				return false, fmt.Errorf("error decoding Namespace %s: %v", m.object.GetName(), err)
+			}
+			objects.Namespaces = append(objects.Namespaces, ns)
+		case "ServiceAccount":
+			sa := &corev1.ServiceAccount{}
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(m.object.Object, sa); err != nil {
+				return false, fmt.Errorf("error decoding ServiceAccount %s: %v", m.object.GetName(), err)
+			}
+			defaultNamespace(sa)
+			objects.ServiceAccounts = append(objects.ServiceAccounts, sa)
+		}
+	}
+
+	missingRequired := false
+	for _, m := range manifests {
+		if m.object == nil || m.object.GetAPIVersion() != "apps/v1" {
+			continue
+		}
+		var workload client.Object
+		switch m.object.GetKind() {
+		case "Deployment":
+			workload = &appsv1.Deployment{}
+		case "StatefulSet":
+			workload = &appsv1.StatefulSet{}
+		case "DaemonSet":
+			workload = &appsv1.DaemonSet{}
+		default:
+			continue
+		}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(m.object.Object, workload); err != nil {
+			return false, fmt.Errorf("error decoding %s %s: %v", m.object.GetKind(), m.object.GetName(), err)
+		}
+		defaultNamespace(workload)
+		if !core.IsWaveEnabled(workload, opts, objects) {
+			continue
+		}
+
+		hash, unresolved, err := core.CalculateWorkloadConfigHash(workload, opts, objects)
+		if err != nil {
+			return false, fmt.Errorf("error hashing %s %s/%s: %v", m.object.GetKind(), workload.GetNamespace(), workload.GetName(), err)
+		}
+		missing := false
+		for _, ref := range unresolved {
+			fmt.Fprintf(stderr, "%s %s/%s: unresolved reference to %s\n", m.object.GetKind(), workload.GetNamespace(), workload.GetName(), ref)
+			if !strings.HasSuffix(ref, "(optional)") {
+				missing = true
+			}
+		}
+		if missing {
+			fmt.Fprintf(stderr, "%s %s/%s: not hashed since required children are missing\n", m.object.GetKind(), workload.GetNamespace(), workload.GetName())
+			missingRequired = true
+			continue
+		}
+
+		if err := unstructured.SetNestedField(m.object.Object, hash, "spec", "template", "metadata", "annotations", core.ConfigHashAnnotation); err != nil {
+			return false, fmt.Errorf("error annotating %s %s/%s: %v", m.object.GetKind(), workload.GetNamespace(), workload.GetName(), err)
+		}
+		m.modified = true
+	}
+	return missingRequired, nil
+}
+
+// writeManifests writes the documents as a YAML stream. Unmodified documents
+// are written as they were read.
+func writeManifests(w io.Writer, manifests []*manifest) error {
+	for i, m := range manifests {
+		if i > 0 {
+			if _, err := fmt.Fprintln(w, "---"); err != nil {
+				return err
+			}
+		}
+		out := m.raw
+		if m.modified {
+			var err error
+			out, err = yaml.Marshal(m.object.Object)
+			if err != nil {
+				return err
+			}
+		}
+		if _, err := w.Write(bytes.TrimLeft(out, "\n")); err != nil {
+			return err
+		}
+		if !bytes.HasSuffix(out, []byte("\n")) {
+			if _, err := fmt.Fprintln(w); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
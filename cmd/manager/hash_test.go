@@ -0,0 +1,185 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/pkg/core"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	appConfigMap = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: app
+data:
+  key: value
+`
+	appDeployment = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  annotations:
+    wave.pusher.com/update-on-config-change: "true"
+spec:
+  template:
+    spec:
+      containers:
+      - name: app
+        envFrom:
+        - configMapRef:
+            name: app
+        - secretRef:
+            name: optional
+            optional: true
+`
+	pullServiceAccount = `apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: default
+imagePullSecrets:
+- name: registry
+`
+	registrySecret = `apiVersion: v1
+kind: Secret
+metadata:
+  name: registry
+stringData:
+  .dockerconfigjson: "{}"
+`
+	optInNamespace = `apiVersion: v1
+kind: Namespace
+metadata:
+  name: default
+  labels:
+    wave.pusher.com/update-on-config-change: "true"
+`
+)
+
+// stream joins the documents into a YAML stream
+func stream(documents ...string) string {
+	return strings.Join(documents, "---\n")
+}
+
+// withoutOptIn removes the required annotation from the Deployment
+func withoutOptIn(deployment string) string {
+	return strings.Replace(deployment, "    wave.pusher.com/update-on-config-change: \"true\"\n", "", 1)
+}
+
+var _ = Describe("Wave hash subcommand", func() {
+	Context("readManifests", func() {
+		It("splits the stream into its documents", func() {
+			manifests, err := readManifests(strings.NewReader(stream(appConfigMap, "\n", "# comment\n", appDeployment)))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(manifests).To(HaveLen(3))
+			Expect(manifests[0].object.GetKind()).To(Equal("ConfigMap"))
+			Expect(manifests[1].object).To(BeNil())
+			Expect(manifests[2].object.GetKind()).To(Equal("Deployment"))
+		})
+
+		It("fails on invalid documents", func() {
+			_, err := readManifests(strings.NewReader("kind: [\n"))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("writeManifests", func() {
+		It("writes unmodified documents as they were read", func() {
+			input := stream(appConfigMap, "# comment\n")
+			manifests, err := readManifests(strings.NewReader(input))
+			Expect(err).NotTo(HaveOccurred())
+			out := &bytes.Buffer{}
+			Expect(writeManifests(out, manifests)).To(Succeed())
+			Expect(out.String()).To(Equal(input))
+		})
+	})
+
+	DescribeTable("hashManifests",
+		func(input string, opts core.HandlerOptions, hashed bool, missingRequired bool) {
+			manifests, err := readManifests(strings.NewReader(input))
+			Expect(err).NotTo(HaveOccurred())
+			stderr := &bytes.Buffer{}
+			missing, err := hashManifests(manifests, "default", opts, stderr)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(missing).To(Equal(missingRequired))
+
+			deployment := manifests[len(manifests)-1]
+			Expect(deployment.modified).To(Equal(hashed))
+			annotations, _, err := unstructured.NestedStringMap(deployment.object.Object, "spec", "template", "metadata", "annotations")
+			Expect(err).NotTo(HaveOccurred())
+			if hashed {
+				Expect(annotations).To(HaveKey(core.ConfigHashAnnotation))
+			} else {
+				Expect(annotations).NotTo(HaveKey(core.ConfigHashAnnotation))
+			}
+		},
+		Entry("hashes enabled workloads", stream(appConfigMap, appDeployment), core.HandlerOptions{}, true, false),
+		Entry("skips workloads which are not enabled", stream(appConfigMap, withoutOptIn(appDeployment)), core.HandlerOptions{}, false, false),
+		Entry("hashes all workloads in opt-out mode", stream(appConfigMap, withoutOptIn(appDeployment)), core.HandlerOptions{DefaultMode: core.DefaultModeOptOut}, true, false),
+		Entry("hashes workloads in namespaces which opted in", stream(optInNamespace, appConfigMap, withoutOptIn(appDeployment)), core.HandlerOptions{NamespaceOptIn: true}, true, false),
+		Entry("skips workloads of other controller classes", stream(appConfigMap, appDeployment), core.HandlerOptions{ControllerClass: "team-a"}, false, false),
+		Entry("does not hash workloads with missing required children", appDeployment, core.HandlerOptions{}, false, true),
+	)
+
+	Context("runHash", func() {
+		var stdout, stderr *bytes.Buffer
+
+		BeforeEach(func() {
+			stdout = &bytes.Buffer{}
+			stderr = &bytes.Buffer{}
+		})
+
+		It("writes the hashed manifests", func() {
+			Expect(runHash(nil, strings.NewReader(stream(appConfigMap, appDeployment)), stdout, stderr)).To(Equal(0))
+			Expect(stdout.String()).To(ContainSubstring(core.ConfigHashAnnotation))
+			Expect(stderr.String()).To(ContainSubstring("unresolved reference to secret default/optional (optional)"))
+		})
+
+		It("passes the manager flags on", func() {
+			Expect(runHash([]string{"-default-mode=opt-out"}, strings.NewReader(stream(appConfigMap, withoutOptIn(appDeployment))), stdout, stderr)).To(Equal(0))
+			Expect(stdout.String()).To(ContainSubstring(core.ConfigHashAnnotation))
+		})
+
+		It("hashes the image pull Secrets of ServiceAccounts in the manifests with -watch-image-pull-secrets", func() {
+			deployment := strings.Replace(appDeployment, "  annotations:\n", "  annotations:\n    wave.pusher.com/image-pull-secrets: \"true\"\n", 1)
+			input := stream(appConfigMap, pullServiceAccount, registrySecret, deployment)
+			Expect(runHash(nil, strings.NewReader(input), stdout, stderr)).To(Equal(0))
+			withoutPullSecrets := stdout.String()
+
+			stdout.Reset()
+			Expect(runHash([]string{"-watch-image-pull-secrets"}, strings.NewReader(input), stdout, stderr)).To(Equal(0))
+			Expect(stdout.String()).To(ContainSubstring(core.ConfigHashAnnotation))
+			Expect(stdout.String()).NotTo(Equal(withoutPullSecrets))
+		})
+
+		It("fails on missing required children with -strict", func() {
+			Expect(runHash([]string{"-strict"}, strings.NewReader(appDeployment), stdout, stderr)).To(Equal(1))
+			Expect(stdout.String()).NotTo(ContainSubstring(core.ConfigHashAnnotation))
+			Expect(stderr.String()).To(ContainSubstring("not hashed since required children are missing"))
+		})
+
+		It("rejects invalid flags", func() {
+			Expect(runHash([]string{"-default-mode=invalid"}, strings.NewReader(""), stdout, stderr)).To(Equal(2))
+			Expect(stderr.String()).To(ContainSubstring("invalid --default-mode"))
+		})
+	})
+})
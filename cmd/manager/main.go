@@ -17,10 +17,12 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
 	"runtime"
+	"strings"
 	"time"
 
 	"sigs.k8s.io/controller-runtime/pkg/cache"
@@ -29,13 +31,13 @@ import (
 	"github.com/wave-k8s/wave/pkg/core"
 
 	"github.com/wave-k8s/wave/pkg/controller"
-	"github.com/wave-k8s/wave/pkg/controller/daemonset"
-	"github.com/wave-k8s/wave/pkg/controller/deployment"
-	"github.com/wave-k8s/wave/pkg/controller/statefulset"
+	"github.com/wave-k8s/wave/pkg/debug"
+	"golang.org/x/time/rate"
 	k8swebhook "sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
@@ -43,23 +45,45 @@ import (
 )
 
 var (
-	leaderElection          = flag.Bool("leader-election", false, "Should the controller use leader election")
-	leaderElectionID        = flag.String("leader-election-id", "", "Name of the configmap used by the leader election system")
-	leaderElectionNamespace = flag.String("leader-election-namespace", "", "Namespace for the configmap used by the leader election system")
-	syncPeriod              = flag.Duration("sync-period", 10*time.Hour, "Reconcile sync period")
-	updateRate              = flag.Float64("update-rate", core.DefaultUpdateRate, "Global maximum update rate per second (default: 1.0 = 1 update per second)")
-	updateBurst             = flag.Int("update-burst", core.DefaultUpdateBurst, "Global maximum burst size for updates (default: 100 immediate updates allowed)")
-	showVersion             = flag.Bool("version", false, "Show version and exit")
-	enableWebhooks          = flag.Bool("enable-webhooks", false, "Enable webhooks")
-	namespaces              = flag.String("namespaces", "", "Comma-separated list of namespaces to watch. Defaults to all namespaces.")
-	setupLog                = ctrl.Log.WithName("setup")
+	leaderElection                 = flag.Bool("leader-election", false, "Should the controller use leader election")
+	leaderElectionID               = flag.String("leader-election-id", "", "Name of the configmap used by the leader election system")
+	leaderElectionNamespace        = flag.String("leader-election-namespace", "", "Namespace for the configmap used by the leader election system")
+	syncPeriod                     = flag.Duration("sync-period", 10*time.Hour, "Reconcile sync period")
+	updateRate                     = flag.Float64("update-rate", core.DefaultUpdateRate, "Global maximum update rate per second (default: 1.0 = 1 update per second)")
+	updateBurst                    = flag.Int("update-burst", core.DefaultUpdateBurst, "Global maximum burst size for updates (default: 100 immediate updates allowed)")
+	blastRadiusMaxWorkloads        = flag.Int("blast-radius-max-workloads", 0, "Pause rollouts when a single ConfigMap or Secret change would roll more than this number of workloads. 0 disables the limit.")
+	blastRadiusMaxNamespacePercent = flag.Int("blast-radius-max-namespace-percent", 0, "Pause rollouts when a single ConfigMap or Secret change would roll more than this percentage of the Deployments, StatefulSets and DaemonSets in a namespace. 0 disables the limit.")
+	blastRadiusOverrides           = flag.String("blast-radius-overrides", "", "Comma-separated list of children like configmap/<namespace>/<name> or secret/<namespace>/<name> whose changes are never paused by the blast radius limit. Namespace and name can be patterns like team-*.")
+	rolloutAfterTimeout            = flag.Duration("rollout-after-timeout", core.DefaultRolloutAfterTimeout, "Maximum time a workload waits for the workloads in its rollout-after annotation before it is updated anyway")
+	rolloutStallTimeout            = flag.Duration("rollout-stall-timeout", core.DefaultRolloutStallTimeout, "Time after which a rollout triggered by Wave whose ready replicas do not improve is reported as stalled")
+	enableDebugGraph               = flag.Bool("enable-debug-graph", false, "Serve the dependency graph of watched ConfigMaps and Secrets on /debug/wave/graph of the webhook server (HTTPS on port 9443, with the serving certificate of the webhooks). Requests need a bearer token of a user who may get this non-resource URL.")
+	dryRun                         = flag.Bool("dry-run", false, "Log and record events for the changes Wave would make to workloads without updating them. Webhooks report without mutating.")
+	showVersion                    = flag.Bool("version", false, "Show version and exit")
+	enableWebhooks                 = flag.Bool("enable-webhooks", false, "Enable webhooks")
+	schedulingGates                = flag.String("scheduling-gates", "auto", "Disable scheduling of pods with missing children with the wave.pusher.com/missing-config scheduling gate instead of an invalid scheduler: true, false or auto to use them if the cluster supports them")
+	schedulingTimeout              = flag.Duration("scheduling-timeout", 0, "Time after which Wave escalates for workloads whose scheduling is disabled because of missing children. 0 disables the timeout.")
+	schedulingTimeoutAction        = flag.String("scheduling-timeout-action", string(core.SchedulingTimeoutWarn), "Action after the --scheduling-timeout: warn records Warning events, restore also restores the original scheduler so that the pods fail instead of staying Pending")
+	childDeletionPolicy            = flag.String("child-deletion-policy", string(core.ChildDeletionRoll), "How the deletion of a referenced ConfigMap or Secret is handled: roll updates the hash, freeze keeps the hash and records Warning events, ignore keeps the hash. Can be overridden per workload with the wave.pusher.com/on-child-deletion annotation.")
+	childDeletionGracePeriod       = flag.Duration("child-deletion-grace-period", 0, "Time Wave waits for a deleted ConfigMap or Secret to be recreated before it applies the --child-deletion-policy")
+	stripHashOnOptOut              = flag.Bool("opt-out-strip-hash", false, "Remove the config-hash annotation from workloads which opt out of Wave if their pod template changes anyway to restore scheduling")
+	cleanup                        = flag.Bool("cleanup", false, "Restore scheduling and remove the annotations set by Wave from all workloads, then exit. Use before uninstalling Wave.")
+	dependencyProtection           = flag.String("dependency-protection", "", "Validate deletes and key removals of ConfigMaps and Secrets which break required references of workloads: warn returns admission warnings, reject rejects the change. Disabled if empty. Requires --enable-webhooks.")
+	webhookValidation              = flag.String("webhook-validation", string(core.ValidationModeWarn), "How the validating webhook treats malformed Wave annotations: warn returns admission warnings, reject rejects the workload")
+	missingChildrenPolicy          = flag.String("missing-children-policy", string(core.MissingChildrenProceed), "How the webhook handles updates which add required references to missing ConfigMaps or Secrets: hold rejects the update, gate disables scheduling of the new pods, proceed applies the update. Can be overridden per workload with the wave.pusher.com/missing-children-policy annotation.")
+	setupLog                       = ctrl.Log.WithName("setup")
+	handlerFlags                   core.Flags
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "hash" {
+		os.Exit(runHash(os.Args[2:], os.Stdin, os.Stdout, os.Stderr))
+	}
+
 	opts := zap.Options{
 		Development: true,
 	}
 	opts.BindFlags(flag.CommandLine)
+	handlerFlags.BindFlags(flag.CommandLine)
 	flag.Parse()
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
@@ -77,10 +101,20 @@ func main() {
 		os.Exit(1)
 	}
 
+	handlerOptions, err := handlerFlags.HandlerOptions()
+	if err != nil {
+		setupLog.Error(err, "invalid flags")
+		os.Exit(1)
+	}
+	defaultNamespaces := core.BuildCacheDefaultNamespaces(handlerFlags.Namespaces)
+	if defaultNamespaces == nil {
+		defaultNamespaces = handlerOptions.NamespaceFilter.CacheConfig()
+	}
+
 	// Create a new Cmd to provide shared dependencies and start components
 	setupLog.Info("setting up manager")
 	var webhookServer k8swebhook.Server
-	if *enableWebhooks {
+	if *enableWebhooks || *enableDebugGraph {
 		webhookServer = k8swebhook.NewServer(k8swebhook.Options{
 			Port: 9443,
 		})
@@ -92,7 +126,7 @@ func main() {
 		LeaderElectionNamespace: *leaderElectionNamespace,
 		Cache: cache.Options{
 			SyncPeriod:        syncPeriod,
-			DefaultNamespaces: core.BuildCacheDefaultNamespaces(*namespaces),
+			DefaultNamespaces: defaultNamespaces,
 		},
 	})
 	if err != nil {
@@ -109,31 +143,110 @@ func main() {
 		os.Exit(1)
 	}
 
+	validationMode, err := core.ParseValidationMode(*webhookValidation)
+	if err != nil {
+		setupLog.Error(err, "invalid --webhook-validation")
+		os.Exit(1)
+	}
+	missingChildren, err := core.ParseMissingChildrenPolicy(*missingChildrenPolicy)
+	if err != nil {
+		setupLog.Error(err, "invalid --missing-children-policy")
+		os.Exit(1)
+	}
+	timeoutAction, err := core.ParseSchedulingTimeoutAction(*schedulingTimeoutAction)
+	if err != nil {
+		setupLog.Error(err, "invalid --scheduling-timeout-action")
+		os.Exit(1)
+	}
+	deletionPolicy, err := core.ParseChildDeletionPolicy(*childDeletionPolicy)
+	if err != nil {
+		setupLog.Error(err, "invalid --child-deletion-policy")
+		os.Exit(1)
+	}
+
 	// Setup all Controllers
 	setupLog.Info("Setting up controller")
-	controllerConfig := controller.Config{
-		UpdateRate:  *updateRate,
-		UpdateBurst: *updateBurst,
-	}
-	if err := controller.AddToManager(mgr, controllerConfig); err != nil {
-		setupLog.Error(err, "unable to register controllers to the manager")
+	handlerOptions.UpdateThrottler = core.NewUpdateThrottler(rate.Limit(*updateRate), *updateBurst)
+	handlerOptions.RolloutAfterTimeout = *rolloutAfterTimeout
+	handlerOptions.RolloutStallTimeout = *rolloutStallTimeout
+	handlerOptions.APIReader = mgr.GetAPIReader()
+	handlerOptions.DryRun = *dryRun
+	handlerOptions.ValidationMode = validationMode
+	handlerOptions.StripHashOnOptOut = *stripHashOnOptOut
+	handlerOptions.MissingChildrenPolicy = missingChildren
+	handlerOptions.SchedulingTimeout = *schedulingTimeout
+	handlerOptions.SchedulingTimeoutAction = timeoutAction
+	handlerOptions.ChildDeletionPolicy = deletionPolicy
+	handlerOptions.ChildDeletionGracePeriod = *childDeletionGracePeriod
+	switch *schedulingGates {
+	case "true":
+		handlerOptions.UseSchedulingGates = true
+	case "false":
+	case "auto":
+		supported, err := core.SchedulingGatesSupported(cfg)
+		if err != nil {
+			setupLog.Error(err, "unable to detect support for scheduling gates")
+			os.Exit(1)
+		}
+		handlerOptions.UseSchedulingGates = supported
+	default:
+		setupLog.Error(fmt.Errorf("must be true, false or auto"), "invalid --scheduling-gates")
 		os.Exit(1)
 	}
-	if *enableWebhooks {
-		if err := deployment.AddDeploymentWebhook(mgr, *updateRate, *updateBurst); err != nil {
-			setupLog.Error(err, "unable to create webhook", "webhook", "Deployment")
+	if *dependencyProtection != "" {
+		mode, err := core.ParseValidationMode(*dependencyProtection)
+		if err != nil {
+			setupLog.Error(err, "invalid --dependency-protection")
 			os.Exit(1)
 		}
-
-		if err := statefulset.AddStatefulSetWebhook(mgr, *updateRate, *updateBurst); err != nil {
-			setupLog.Error(err, "unable to create webhook", "webhook", "StatefulSet")
+		handlerOptions.DependencyProtector = core.NewDependencyProtector(mode)
+	}
+	if *cleanup {
+		c, err := client.New(cfg, client.Options{Scheme: mgr.GetScheme()})
+		if err != nil {
+			setupLog.Error(err, "unable to create client")
 			os.Exit(1)
 		}
-
-		if err := daemonset.AddDaemonSetWebhook(mgr, *updateRate, *updateBurst); err != nil {
-			setupLog.Error(err, "unable to create webhook", "webhook", "DaemonSet")
+		setupLog.Info("Cleaning up all workloads")
+		if err := core.Cleanup(context.Background(), c, mgr.GetEventRecorderFor(core.EventSource(handlerFlags.ControllerClass)), handlerOptions); err != nil {
+			setupLog.Error(err, "unable to clean up workloads")
+			os.Exit(1)
+		}
+		setupLog.Info("Cleanup completed")
+		return
+	}
+	if *blastRadiusMaxWorkloads > 0 || *blastRadiusMaxNamespacePercent > 0 {
+		breaker, err := core.NewBlastRadiusBreaker(mgr.GetClient(), mgr.GetEventRecorderFor(core.EventSource(handlerFlags.ControllerClass)), *blastRadiusMaxWorkloads, *blastRadiusMaxNamespacePercent, strings.Split(*blastRadiusOverrides, ","))
+		if err != nil {
+			setupLog.Error(err, "invalid --blast-radius-overrides")
+			os.Exit(1)
+		}
+		handlerOptions.BlastRadiusBreaker = breaker
+	}
+	if handlerOptions.EnableSnapshots && !*dryRun {
+		collector := core.NewSnapshotCollector(mgr.GetClient(), mgr.GetAPIReader(), handlerOptions.WatchedNamespaces)
+		if err := mgr.Add(collector); err != nil {
+			setupLog.Error(err, "unable to register snapshot collector")
+			os.Exit(1)
+		}
+	}
+	if *enableDebugGraph {
+		handlerOptions.DependencyGraph = core.NewDependencyGraph()
+		graphHandler, err := debug.WithAuthentication(cfg, handlerOptions.DependencyGraph)
+		if err != nil {
+			setupLog.Error(err, "unable to set up dependency graph authentication")
 			os.Exit(1)
 		}
+		// The webhook server serves TLS, so bearer tokens are not sent in the clear
+		mgr.GetWebhookServer().Register(core.DependencyGraphPath, graphHandler)
+	}
+	controllerConfig := controller.Config{
+		HandlerOptions: handlerOptions,
+		EnableWebhooks: *enableWebhooks,
+	}
+	if err := controller.AddToManager(mgr, controllerConfig); err != nil {
+		setupLog.Error(err, "unable to register controllers to the manager")
+		os.Exit(1)
 	}
 
 	// Start the Cmd
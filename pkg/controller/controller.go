@@ -17,13 +17,14 @@ limitations under the License.
 package controller
 
 import (
+	"github.com/wave-k8s/wave/pkg/core"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 )
 
 // Config holds configuration options for controllers
 type Config struct {
-	UpdateRate  float64 // updates per second
-	UpdateBurst int     // maximum burst size
+	core.HandlerOptions      // shared by all controllers and webhooks
+	EnableWebhooks      bool // register the webhook of each controller
 }
 
 // AddToManagerFuncs is a list of functions to add all Controllers to the Manager
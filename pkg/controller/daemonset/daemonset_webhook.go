@@ -2,8 +2,10 @@ package daemonset
 
 import (
 	"context"
+	"encoding/json"
 
 	"github.com/wave-k8s/wave/pkg/core"
+	admissionv1 "k8s.io/api/admission/v1"
 	appsv1 "k8s.io/api/apps/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
@@ -13,6 +15,7 @@ import (
 )
 
 // +kubebuilder:webhook:path=/mutate-apps-v1-daemonset,mutating=true,failurePolicy=ignore,groups=apps,resources=daemonsets,verbs=create;update,versions=v1,name=daemonsets.wave.pusher.com,admissionReviewVersions=v1,sideEffects=NoneOnDryRun
+// +kubebuilder:webhook:path=/validate-apps-v1-daemonset,mutating=false,failurePolicy=ignore,groups=apps,resources=daemonsets,verbs=create;update,versions=v1,name=validate-daemonsets.wave.pusher.com,admissionReviewVersions=v1,sideEffects=None
 
 type DaemonSetWebhook struct {
 	client.Client
@@ -24,16 +27,36 @@ func (a *DaemonSetWebhook) Default(ctx context.Context, obj runtime.Object) erro
 	if err != nil {
 		return err
 	}
-	err = a.Handler.HandleWebhook(obj.(*appsv1.DaemonSet), request.DryRun, request.Operation == "CREATE")
+	old := &appsv1.DaemonSet{}
+	if request.Operation == admissionv1.Update {
+		if err := json.Unmarshal(request.OldObject.Raw, old); err != nil {
+			return err
+		}
+	}
+	err = a.Handler.HandleWebhook(obj.(*appsv1.DaemonSet), old, request.DryRun, request.Operation == admissionv1.Create)
 	return err
 }
 
-func AddDaemonSetWebhook(mgr manager.Manager, updateRate float64, updateBurst int) error {
-	err := builder.WebhookManagedBy(mgr).For(&appsv1.DaemonSet{}).WithDefaulter(
-		&DaemonSetWebhook{
-			Client:  mgr.GetClient(),
-			Handler: core.NewHandler[*appsv1.DaemonSet](mgr.GetClient(), mgr.GetEventRecorderFor("wave"), updateRate, updateBurst),
-		}).Complete()
+func (a *DaemonSetWebhook) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return a.Handler.ValidateWebhook(obj.(*appsv1.DaemonSet))
+}
+
+func (a *DaemonSetWebhook) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	return a.Handler.ValidateWebhook(newObj.(*appsv1.DaemonSet))
+}
+
+func (a *DaemonSetWebhook) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// AddDaemonSetWebhook registers the mutating and the validating webhook using the
+// given Handler so that they share their state with the Controller
+func AddDaemonSetWebhook(mgr manager.Manager, h *core.Handler[*appsv1.DaemonSet]) error {
+	webhook := &DaemonSetWebhook{
+		Client:  mgr.GetClient(),
+		Handler: h,
+	}
+	err := builder.WebhookManagedBy(mgr).For(&appsv1.DaemonSet{}).WithDefaulter(webhook).WithValidator(webhook).Complete()
 
 	return err
 }
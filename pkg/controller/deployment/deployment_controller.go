@@ -27,22 +27,33 @@ import (
 )
 
 // +kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;update;patch
-// +kubebuilder:rbac:groups=,resources=configmaps,verbs=get;list;watch;update;patch
-// +kubebuilder:rbac:groups=,resources=secrets,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=,resources=configmaps,verbs=get;list;watch;update;patch;create;delete
+// +kubebuilder:rbac:groups=,resources=secrets,verbs=get;list;watch;update;patch;create;delete
 // +kubebuilder:rbac:groups=,resources=events,verbs=create;update;patch
+// +kubebuilder:rbac:groups=,resources=pods,verbs=get;list;update
+// +kubebuilder:rbac:groups=,resources=namespaces,verbs=get;list;watch
+// +kubebuilder:rbac:groups=,resources=serviceaccounts,verbs=get;list;watch
+// +kubebuilder:rbac:groups=apps,resources=replicasets;controllerrevisions,verbs=get;list
 
 // Add creates a new Deployment Controller and adds it to the Manager with default RBAC. The Manager will set fields on the Controller
 // and Start it when the Manager is Started.
-func Add(mgr manager.Manager, updateRate float64, updateBurst int) error {
-	r := newReconciler(mgr, updateRate, updateBurst)
-	return add(mgr, r, r.handler)
+// The webhook, if enabled, is registered with the same Handler as the Controller.
+func Add(mgr manager.Manager, opts core.HandlerOptions, enableWebhooks bool) error {
+	r := newReconciler(mgr, opts)
+	if err := add(mgr, r, r.handler); err != nil {
+		return err
+	}
+	if enableWebhooks {
+		return AddDeploymentWebhook(mgr, r.handler)
+	}
+	return nil
 }
 
 // newReconciler returns a new reconcile.Reconciler
-func newReconciler(mgr manager.Manager, updateRate float64, updateBurst int) *ReconcileDeployment {
+func newReconciler(mgr manager.Manager, opts core.HandlerOptions) *ReconcileDeployment {
 	return &ReconcileDeployment{
 		scheme:  mgr.GetScheme(),
-		handler: core.NewHandler[*appsv1.Deployment](mgr.GetClient(), mgr.GetEventRecorderFor("wave"), updateRate, updateBurst),
+		handler: core.NewHandler[*appsv1.Deployment](mgr.GetClient(), mgr.GetEventRecorderFor(core.EventSource(opts.ControllerClass)), opts),
 	}
 }
 
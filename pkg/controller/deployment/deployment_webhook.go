@@ -2,8 +2,10 @@ package deployment
 
 import (
 	"context"
+	"encoding/json"
 
 	"github.com/wave-k8s/wave/pkg/core"
+	admissionv1 "k8s.io/api/admission/v1"
 	appsv1 "k8s.io/api/apps/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
@@ -13,6 +15,7 @@ import (
 )
 
 // +kubebuilder:webhook:path=/mutate-apps-v1-deployment,mutating=true,failurePolicy=ignore,groups=apps,resources=deployments,verbs=create;update,versions=v1,name=deployments.wave.pusher.com,admissionReviewVersions=v1,sideEffects=NoneOnDryRun
+// +kubebuilder:webhook:path=/validate-apps-v1-deployment,mutating=false,failurePolicy=ignore,groups=apps,resources=deployments,verbs=create;update,versions=v1,name=validate-deployments.wave.pusher.com,admissionReviewVersions=v1,sideEffects=None
 
 type DeploymentWebhook struct {
 	client.Client
@@ -24,16 +27,36 @@ func (a *DeploymentWebhook) Default(ctx context.Context, obj runtime.Object) err
 	if err != nil {
 		return err
 	}
-	err = a.Handler.HandleWebhook(obj.(*appsv1.Deployment), request.DryRun, request.Operation == "CREATE")
+	old := &appsv1.Deployment{}
+	if request.Operation == admissionv1.Update {
+		if err := json.Unmarshal(request.OldObject.Raw, old); err != nil {
+			return err
+		}
+	}
+	err = a.Handler.HandleWebhook(obj.(*appsv1.Deployment), old, request.DryRun, request.Operation == admissionv1.Create)
 	return err
 }
 
-func AddDeploymentWebhook(mgr manager.Manager, updateRate float64, updateBurst int) error {
-	err := builder.WebhookManagedBy(mgr).For(&appsv1.Deployment{}).WithDefaulter(
-		&DeploymentWebhook{
-			Client:  mgr.GetClient(),
-			Handler: core.NewHandler[*appsv1.Deployment](mgr.GetClient(), mgr.GetEventRecorderFor("wave"), updateRate, updateBurst),
-		}).Complete()
+func (a *DeploymentWebhook) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return a.Handler.ValidateWebhook(obj.(*appsv1.Deployment))
+}
+
+func (a *DeploymentWebhook) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	return a.Handler.ValidateWebhook(newObj.(*appsv1.Deployment))
+}
+
+func (a *DeploymentWebhook) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// AddDeploymentWebhook registers the mutating and the validating webhook using the
+// given Handler so that they share their state with the Controller
+func AddDeploymentWebhook(mgr manager.Manager, h *core.Handler[*appsv1.Deployment]) error {
+	webhook := &DeploymentWebhook{
+		Client:  mgr.GetClient(),
+		Handler: h,
+	}
+	err := builder.WebhookManagedBy(mgr).For(&appsv1.Deployment{}).WithDefaulter(webhook).WithValidator(webhook).Complete()
 
 	return err
 }
@@ -0,0 +1,60 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package protection
+
+import (
+	"context"
+
+	"github.com/wave-k8s/wave/pkg/core"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// +kubebuilder:webhook:path=/validate--v1-configmap,mutating=false,failurePolicy=ignore,groups="",resources=configmaps,verbs=update;delete,versions=v1,name=protect-configmaps.wave.pusher.com,admissionReviewVersions=v1,sideEffects=None
+// +kubebuilder:webhook:path=/validate--v1-secret,mutating=false,failurePolicy=ignore,groups="",resources=secrets,verbs=update;delete,versions=v1,name=protect-secrets.wave.pusher.com,admissionReviewVersions=v1,sideEffects=None
+
+type ChildWebhook struct {
+	Protector *core.DependencyProtector
+}
+
+func (a *ChildWebhook) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (a *ChildWebhook) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	return a.Protector.Validate(ctx, oldObj.(client.Object), newObj.(client.Object))
+}
+
+func (a *ChildWebhook) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return a.Protector.Validate(ctx, obj.(client.Object), nil)
+}
+
+// AddChildWebhooks registers the validating webhooks for ConfigMaps and Secrets
+// using the given DependencyProtector
+func AddChildWebhooks(mgr manager.Manager, p *core.DependencyProtector) error {
+	for _, obj := range []client.Object{&corev1.ConfigMap{}, &corev1.Secret{}} {
+		err := builder.WebhookManagedBy(mgr).For(obj).WithValidator(&ChildWebhook{Protector: p}).Complete()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -29,6 +29,7 @@ import (
 	"github.com/wave-k8s/wave/pkg/apis"
 	"github.com/wave-k8s/wave/pkg/core"
 	"github.com/wave-k8s/wave/test/utils"
+	"golang.org/x/time/rate"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -137,12 +138,12 @@ var _ = BeforeSuite(func() {
 	m = utils.Matcher{Client: c}
 
 	var recFn reconcile.Reconciler
-	r := newReconciler(mgr, math.Inf(1), 1)
+	r := newReconciler(mgr, core.HandlerOptions{UpdateThrottler: core.NewUpdateThrottler(rate.Limit(math.Inf(1)), 1)})
 	recFn, requestsStart, requests = core.SetupControllerTestReconcile(r)
 	Expect(add(mgr, recFn, r.handler)).NotTo(HaveOccurred())
 
 	// register mutating pod webhook
-	err = AddStatefulSetWebhook(mgr, math.Inf(1), 1)
+	err = AddStatefulSetWebhook(mgr, r.handler)
 	Expect(err).ToNot(HaveOccurred())
 
 	testCtx, testCancel = context.WithCancel(context.Background())
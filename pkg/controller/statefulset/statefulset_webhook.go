@@ -2,8 +2,10 @@ package statefulset
 
 import (
 	"context"
+	"encoding/json"
 
 	"github.com/wave-k8s/wave/pkg/core"
+	admissionv1 "k8s.io/api/admission/v1"
 	appsv1 "k8s.io/api/apps/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
@@ -13,6 +15,7 @@ import (
 )
 
 // +kubebuilder:webhook:path=/mutate-apps-v1-statefulset,mutating=true,failurePolicy=ignore,groups=apps,resources=statefulsets,verbs=create;update,versions=v1,name=statefulsets.wave.pusher.com,admissionReviewVersions=v1,sideEffects=NoneOnDryRun
+// +kubebuilder:webhook:path=/validate-apps-v1-statefulset,mutating=false,failurePolicy=ignore,groups=apps,resources=statefulsets,verbs=create;update,versions=v1,name=validate-statefulsets.wave.pusher.com,admissionReviewVersions=v1,sideEffects=None
 
 type StatefulSetWebhook struct {
 	client.Client
@@ -24,16 +27,36 @@ func (a *StatefulSetWebhook) Default(ctx context.Context, obj runtime.Object) er
 	if err != nil {
 		return err
 	}
-	err = a.Handler.HandleWebhook(obj.(*appsv1.StatefulSet), request.DryRun, request.Operation == "CREATE")
+	old := &appsv1.StatefulSet{}
+	if request.Operation == admissionv1.Update {
+		if err := json.Unmarshal(request.OldObject.Raw, old); err != nil {
+			return err
+		}
+	}
+	err = a.Handler.HandleWebhook(obj.(*appsv1.StatefulSet), old, request.DryRun, request.Operation == admissionv1.Create)
 	return err
 }
 
-func AddStatefulSetWebhook(mgr manager.Manager, updateRate float64, updateBurst int) error {
-	err := builder.WebhookManagedBy(mgr).For(&appsv1.StatefulSet{}).WithDefaulter(
-		&StatefulSetWebhook{
-			Client:  mgr.GetClient(),
-			Handler: core.NewHandler[*appsv1.StatefulSet](mgr.GetClient(), mgr.GetEventRecorderFor("wave"), updateRate, updateBurst),
-		}).Complete()
+func (a *StatefulSetWebhook) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return a.Handler.ValidateWebhook(obj.(*appsv1.StatefulSet))
+}
+
+func (a *StatefulSetWebhook) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	return a.Handler.ValidateWebhook(newObj.(*appsv1.StatefulSet))
+}
+
+func (a *StatefulSetWebhook) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// AddStatefulSetWebhook registers the mutating and the validating webhook using the
+// given Handler so that they share their state with the Controller
+func AddStatefulSetWebhook(mgr manager.Manager, h *core.Handler[*appsv1.StatefulSet]) error {
+	webhook := &StatefulSetWebhook{
+		Client:  mgr.GetClient(),
+		Handler: h,
+	}
+	err := builder.WebhookManagedBy(mgr).For(&appsv1.StatefulSet{}).WithDefaulter(webhook).WithValidator(webhook).Complete()
 
 	return err
 }
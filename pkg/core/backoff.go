@@ -19,6 +19,7 @@ package core
 import (
 	"context"
 	"math"
+	"time"
 
 	"golang.org/x/time/rate"
 	"k8s.io/apimachinery/pkg/types"
@@ -67,5 +68,8 @@ func (ut *UpdateThrottler) Wait(ctx context.Context, name types.NamespacedName)
 	}
 
 	// Block until global rate limiter allows the operation
-	return ut.limiter.Wait(ctx)
+	start := time.Now()
+	err := ut.limiter.Wait(ctx)
+	updateThrottleWaitSeconds.Observe(time.Since(start).Seconds())
+	return err
 }
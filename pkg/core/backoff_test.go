@@ -23,6 +23,7 @@ import (
 	"time"
 
 	"golang.org/x/time/rate"
+	appsv1 "k8s.io/api/apps/v1"
 	"k8s.io/apimachinery/pkg/types"
 )
 
@@ -223,3 +224,27 @@ func TestUpdateThrottler_PreventChurn(t *testing.T) {
 		t.Error("Expected rate limiting to delay second update")
 	}
 }
+
+func TestUpdateThrottler_SharedBetweenHandlers(t *testing.T) {
+	// Test that Handlers of different kinds share one global rate limiter
+	ut := NewUpdateThrottler(rate.Limit(10.0), 1)
+	deployments := NewHandler[*appsv1.Deployment](nil, nil, HandlerOptions{UpdateThrottler: ut})
+	statefulSets := NewHandler[*appsv1.StatefulSet](nil, nil, HandlerOptions{UpdateThrottler: ut})
+	name := types.NamespacedName{Namespace: "test", Name: "instance"}
+	ctx := context.Background()
+
+	// The Deployment handler uses the burst token
+	if err := deployments.updateThrottler.Wait(ctx, name); err != nil {
+		t.Fatalf("Wait for deployment failed: %v", err)
+	}
+
+	// The StatefulSet handler should be delayed since the burst token was used
+	start := time.Now()
+	if err := statefulSets.updateThrottler.Wait(ctx, name); err != nil {
+		t.Fatalf("Wait for statefulset failed: %v", err)
+	}
+	elapsed := time.Since(start)
+	if elapsed < 50*time.Millisecond {
+		t.Errorf("StatefulSet update should be delayed (shared rate limit), took only %v", elapsed)
+	}
+}
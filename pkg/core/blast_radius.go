@@ -0,0 +1,339 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	configMapKind = "configmap"
+	secretKind    = "secret"
+)
+
+// childRef identifies a ConfigMap or Secret
+type childRef struct {
+	kind string
+	name types.NamespacedName
+}
+
+// String returns the childRef in the form kind/namespace/name
+func (c childRef) String() string {
+	return fmt.Sprintf("%s/%s/%s", c.kind, c.name.Namespace, c.name.Name)
+}
+
+// parseChildRef parses a childRef in the form kind/namespace/name
+func parseChildRef(s string) (childRef, bool) {
+	parts := strings.Split(strings.TrimSpace(s), "/")
+	if len(parts) != 3 || (parts[0] != configMapKind && parts[0] != secretKind) {
+		return childRef{}, false
+	}
+	return childRef{kind: parts[0], name: GetNamespacedName(parts[2], parts[1])}, true
+}
+
+// BlastRadiusBreaker pauses rollouts caused by a single ConfigMap or Secret
+// change if that change would roll more workloads than allowed.
+// It is shared between the Handlers of all kinds so that it can count the
+// workloads referencing a child across kinds.
+type BlastRadiusBreaker struct {
+	client              client.Reader
+	recorder            record.EventRecorder
+	maxWorkloads        int
+	maxNamespacePercent int
+	// overrides holds patterns of children whose rollouts are never paused
+	overrides []childRef
+
+	mutex             sync.Mutex
+	configMapWatchers []WatcherList
+	secretWatchers    []WatcherList
+	// fingerprints holds the last seen hash of the data of every child
+	fingerprints map[childRef]string
+	// tripped holds all children whose last change exceeded the limits and
+	// has not been let through by an override yet
+	tripped map[childRef]bool
+}
+
+// NewBlastRadiusBreaker creates a new BlastRadiusBreaker
+// maxWorkloads: maximum number of workloads a single change may roll (0 = unlimited)
+// maxNamespacePercent: maximum percentage of the workloads of a namespace a single change may roll (0 = unlimited)
+// overrides: children like configmap/namespace/name whose rollouts are never paused, namespace and name may be patterns like team-*
+func NewBlastRadiusBreaker(c client.Reader, r record.EventRecorder, maxWorkloads int, maxNamespacePercent int, overrides []string) (*BlastRadiusBreaker, error) {
+	b := &BlastRadiusBreaker{
+		client:              c,
+		recorder:            r,
+		maxWorkloads:        maxWorkloads,
+		maxNamespacePercent: maxNamespacePercent,
+		fingerprints:        make(map[childRef]string),
+		tripped:             make(map[childRef]bool),
+	}
+	for _, override := range overrides {
+		if strings.TrimSpace(override) == "" {
+			continue
+		}
+		ref, ok := parseChildRef(override)
+		if !ok {
+			return nil, fmt.Errorf("invalid child %q: must be configmap/<namespace>/<name> or secret/<namespace>/<name>", override)
+		}
+		if _, err := path.Match(ref.name.String(), ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %v", override, err)
+		}
+		b.overrides = append(b.overrides, ref)
+	}
+	return b, nil
+}
+
+// isOverridden returns true if the child matches one of the overrides
+func (b *BlastRadiusBreaker) isOverridden(ref childRef) bool {
+	for _, override := range b.overrides {
+		if override.kind != ref.kind {
+			continue
+		}
+		if matched, _ := path.Match(override.name.String(), ref.name.String()); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// addWatchers registers the WatcherLists of a Handler
+func (b *BlastRadiusBreaker) addWatchers(configMaps WatcherList, secrets WatcherList) {
+	if b == nil {
+		return
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.configMapWatchers = append(b.configMapWatchers, configMaps)
+	b.secretWatchers = append(b.secretWatchers, secrets)
+}
+
+// observe records the current data of the children and trips the breaker for
+// every child which changed since it has last been seen and which is
+// referenced by too many workloads
+func (b *BlastRadiusBreaker) observe(ctx context.Context, configMaps map[types.NamespacedName]*corev1.ConfigMap, secrets map[types.NamespacedName]*corev1.Secret, configMapsConfig configMetadataList, secretsConfig configMetadataList) {
+	if b == nil {
+		return
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for _, child := range configMapsConfig {
+		ref := childRef{kind: configMapKind, name: child.name}
+		cm, ok := configMaps[child.name]
+		fingerprint := ""
+		if ok {
+			fingerprint, _ = calculateConfigHash(map[types.NamespacedName]*corev1.ConfigMap{child.name: cm}, nil, configMetadataList{{name: child.name, allKeys: true}}, nil)
+		}
+		b.observeChild(ctx, ref, cm, fingerprint)
+	}
+	for _, child := range secretsConfig {
+		ref := childRef{kind: secretKind, name: child.name}
+		s, ok := secrets[child.name]
+		fingerprint := ""
+		if ok {
+			fingerprint, _ = calculateConfigHash(nil, map[types.NamespacedName]*corev1.Secret{child.name: s}, nil, configMetadataList{{name: child.name, allKeys: true}})
+		}
+		b.observeChild(ctx, ref, s, fingerprint)
+	}
+}
+
+// observeChild must be called with the mutex held
+func (b *BlastRadiusBreaker) observeChild(ctx context.Context, ref childRef, obj Object, fingerprint string) {
+	previous, seen := b.fingerprints[ref]
+	b.fingerprints[ref] = fingerprint
+	if !seen || previous == fingerprint {
+		return
+	}
+
+	reason, err := b.exceedsLimits(ctx, ref)
+	if err != nil {
+		logf.Log.WithName("wave").Error(err, "Unable to evaluate blast radius", "child", ref.String())
+		return
+	}
+	if reason == "" {
+		delete(b.tripped, ref)
+		return
+	}
+
+	b.tripped[ref] = true
+	logf.Log.WithName("wave").V(0).Info("Pausing rollouts for changed child", "child", ref.String(), "reason", reason)
+	if obj != nil && !isBlastRadiusOverridden(obj) && !b.isOverridden(ref) {
+		b.recorder.Eventf(obj, corev1.EventTypeWarning, "RolloutPaused", "Paused rollouts because this change %s. Set annotation %s to \"true\" to continue.", reason, BlastRadiusOverrideAnnotation)
+	}
+}
+
+// exceedsLimits returns a description of the exceeded limit if a change of
+// the child would roll too many workloads or an empty string otherwise.
+// It must be called with the mutex held.
+func (b *BlastRadiusBreaker) exceedsLimits(ctx context.Context, ref childRef) (string, error) {
+	watcherLists := b.configMapWatchers
+	if ref.kind == secretKind {
+		watcherLists = b.secretWatchers
+	}
+
+	// The workloads referencing the child are counted from the watches of
+	// the Handlers so that a change does not list all workloads of the cluster
+	total := 0
+	perNamespace := make(map[string]int)
+	for _, watcherList := range watcherLists {
+		watcherList.watchersMutex.RLock()
+		for watcher := range watcherList.watchers[ref.name] {
+			total++
+			perNamespace[watcher.Namespace]++
+		}
+		watcherList.watchersMutex.RUnlock()
+	}
+
+	if b.maxWorkloads > 0 && total > b.maxWorkloads {
+		return fmt.Sprintf("would roll %d workloads which exceeds the limit of %d", total, b.maxWorkloads), nil
+	}
+
+	if b.maxNamespacePercent > 0 {
+		namespaces := make([]string, 0, len(perNamespace))
+		for namespace := range perNamespace {
+			namespaces = append(namespaces, namespace)
+		}
+		sort.Strings(namespaces)
+		for _, namespace := range namespaces {
+			workloads, err := b.countWorkloads(ctx, namespace)
+			if err != nil {
+				return "", err
+			}
+			if workloads > 0 && perNamespace[namespace]*100 > b.maxNamespacePercent*workloads {
+				return fmt.Sprintf("would roll %d of %d workloads in namespace %s which exceeds the limit of %d%%", perNamespace[namespace], workloads, namespace, b.maxNamespacePercent), nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// countWorkloads returns the number of Deployments, StatefulSets and
+// DaemonSets in the namespace. All workloads are counted, not only those
+// referencing ConfigMaps or Secrets, so that a change of a config shared by
+// all managed workloads of a namespace is not always 100% of it. The client
+// reads from the cache, so counting does not query the API server.
+func (b *BlastRadiusBreaker) countWorkloads(ctx context.Context, namespace string) (int, error) {
+	inNamespace := client.InNamespace(namespace)
+	deployments := &appsv1.DeploymentList{}
+	if err := b.client.List(ctx, deployments, inNamespace); err != nil {
+		return 0, fmt.Errorf("error listing Deployments: %v", err)
+	}
+	statefulSets := &appsv1.StatefulSetList{}
+	if err := b.client.List(ctx, statefulSets, inNamespace); err != nil {
+		return 0, fmt.Errorf("error listing StatefulSets: %v", err)
+	}
+	daemonSets := &appsv1.DaemonSetList{}
+	if err := b.client.List(ctx, daemonSets, inNamespace); err != nil {
+		return 0, fmt.Errorf("error listing DaemonSets: %v", err)
+	}
+	return len(deployments.Items) + len(statefulSets.Items) + len(daemonSets.Items), nil
+}
+
+// blockedBy returns the children which currently pause the rollout of the
+// instance. This includes children listed in the pending annotation of the
+// instance so that paused rollouts survive a restart of Wave.
+// Overridden children let their change through, so they no longer trip the
+// breaker once the override is removed again.
+func (b *BlastRadiusBreaker) blockedBy(instance metav1.Object, configMaps map[types.NamespacedName]*corev1.ConfigMap, secrets map[types.NamespacedName]*corev1.Secret, configMapsConfig configMetadataList, secretsConfig configMetadataList) []string {
+	if b == nil || isBlastRadiusOverridden(instance) {
+		return nil
+	}
+
+	pending := make(map[childRef]bool)
+	for _, s := range strings.Split(instance.GetAnnotations()[BlastRadiusPendingAnnotation], ",") {
+		if ref, ok := parseChildRef(s); ok {
+			pending[ref] = true
+		}
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	blocked := make(map[string]bool)
+	for _, child := range configMapsConfig {
+		ref := childRef{kind: configMapKind, name: child.name}
+		if cm, ok := configMaps[child.name]; (ok && isBlastRadiusOverridden(cm)) || b.isOverridden(ref) {
+			delete(b.tripped, ref)
+			continue
+		}
+		if b.tripped[ref] || pending[ref] {
+			blocked[ref.String()] = true
+		}
+	}
+	for _, child := range secretsConfig {
+		ref := childRef{kind: secretKind, name: child.name}
+		if s, ok := secrets[child.name]; (ok && isBlastRadiusOverridden(s)) || b.isOverridden(ref) {
+			delete(b.tripped, ref)
+			continue
+		}
+		if b.tripped[ref] || pending[ref] {
+			blocked[ref.String()] = true
+		}
+	}
+
+	result := make([]string, 0, len(blocked))
+	for ref := range blocked {
+		result = append(result, ref)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// isBlastRadiusOverridden returns true if the object has the override annotation
+func isBlastRadiusOverridden(obj metav1.Object) bool {
+	return obj.GetAnnotations()[BlastRadiusOverrideAnnotation] == requiredAnnotationValue
+}
+
+// setBlastRadiusPending sets the pending annotation to the given children and
+// returns true if the annotation changed
+func setBlastRadiusPending(obj metav1.Object, blockedBy []string) bool {
+	annotations := obj.GetAnnotations()
+	value := strings.Join(blockedBy, ",")
+	if current, ok := annotations[BlastRadiusPendingAnnotation]; ok && current == value {
+		return false
+	}
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[BlastRadiusPendingAnnotation] = value
+	obj.SetAnnotations(annotations)
+	return true
+}
+
+// clearBlastRadiusPending removes the pending annotation and returns true if
+// it was present
+func clearBlastRadiusPending(obj metav1.Object) bool {
+	annotations := obj.GetAnnotations()
+	if _, ok := annotations[BlastRadiusPendingAnnotation]; !ok {
+		return false
+	}
+	delete(annotations, BlastRadiusPendingAnnotation)
+	obj.SetAnnotations(annotations)
+	return true
+}
@@ -0,0 +1,215 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Wave blast radius Suite", func() {
+	var b *BlastRadiusBreaker
+	var deployments *Handler[*appsv1.Deployment]
+	var statefulSets *Handler[*appsv1.StatefulSet]
+	var recorder *record.FakeRecorder
+	var cm *corev1.ConfigMap
+	var configMaps map[types.NamespacedName]*corev1.ConfigMap
+	var configMapsConfig configMetadataList
+	var instance *appsv1.Deployment
+
+	ctx := context.Background()
+
+	BeforeEach(func() {
+		recorder = record.NewFakeRecorder(10)
+		var err error
+		b, err = NewBlastRadiusBreaker(nil, recorder, 2, 0, nil)
+		Expect(err).NotTo(HaveOccurred())
+		deployments = NewHandler[*appsv1.Deployment](nil, recorder, HandlerOptions{BlastRadiusBreaker: b})
+		statefulSets = NewHandler[*appsv1.StatefulSet](nil, recorder, HandlerOptions{BlastRadiusBreaker: b})
+
+		cm = utils.ExampleConfigMap1.DeepCopy()
+		name := GetNamespacedNameFromObject(cm)
+		configMaps = map[types.NamespacedName]*corev1.ConfigMap{name: cm}
+		configMapsConfig = configMetadataList{{name: name, required: true, allKeys: true}}
+		instance = utils.ExampleDeployment.DeepCopy()
+
+		deployments.watchChildrenForInstance(instance, configMapsConfig, configMetadataList{})
+		b.observe(ctx, configMaps, nil, configMapsConfig, configMetadataList{})
+	})
+
+	It("does not block when the child has only been seen once", func() {
+		Expect(b.blockedBy(instance, configMaps, nil, configMapsConfig, configMetadataList{})).To(BeEmpty())
+	})
+
+	Context("when a change is within the limit", func() {
+		BeforeEach(func() {
+			statefulSets.watchChildrenForInstance(&appsv1.StatefulSet{ObjectMeta: instance.ObjectMeta}, configMapsConfig, configMetadataList{})
+			cm.Data["key1"] = "modified"
+			b.observe(ctx, configMaps, nil, configMapsConfig, configMetadataList{})
+		})
+
+		It("does not block", func() {
+			Expect(b.blockedBy(instance, configMaps, nil, configMapsConfig, configMetadataList{})).To(BeEmpty())
+		})
+	})
+
+	Context("when a change exceeds the limit across kinds", func() {
+		BeforeEach(func() {
+			statefulSets.watchChildrenForInstance(&appsv1.StatefulSet{ObjectMeta: instance.ObjectMeta}, configMapsConfig, configMetadataList{})
+			other := instance.DeepCopy()
+			other.SetName("other")
+			deployments.watchChildrenForInstance(other, configMapsConfig, configMetadataList{})
+			cm.Data["key1"] = "modified"
+			b.observe(ctx, configMaps, nil, configMapsConfig, configMetadataList{})
+		})
+
+		It("blocks the workload", func() {
+			Expect(b.blockedBy(instance, configMaps, nil, configMapsConfig, configMetadataList{})).To(ConsistOf(
+				fmt.Sprintf("configmap/%s/%s", cm.GetNamespace(), cm.GetName()),
+			))
+		})
+
+		It("emits an event on the child", func() {
+			Expect(recorder.Events).To(Receive(ContainSubstring("RolloutPaused")))
+		})
+
+		It("does not block when the child is overridden", func() {
+			cm.SetAnnotations(map[string]string{BlastRadiusOverrideAnnotation: "true"})
+			Expect(b.blockedBy(instance, configMaps, nil, configMapsConfig, configMetadataList{})).To(BeEmpty())
+		})
+
+		It("does not block again after the override of the child is removed", func() {
+			cm.SetAnnotations(map[string]string{BlastRadiusOverrideAnnotation: "true"})
+			Expect(b.blockedBy(instance, configMaps, nil, configMapsConfig, configMetadataList{})).To(BeEmpty())
+
+			cm.SetAnnotations(nil)
+			b.observe(ctx, configMaps, nil, configMapsConfig, configMetadataList{})
+			Expect(b.blockedBy(instance, configMaps, nil, configMapsConfig, configMetadataList{})).To(BeEmpty())
+		})
+
+		It("blocks the next change after the override of the child is removed", func() {
+			cm.SetAnnotations(map[string]string{BlastRadiusOverrideAnnotation: "true"})
+			Expect(b.blockedBy(instance, configMaps, nil, configMapsConfig, configMetadataList{})).To(BeEmpty())
+
+			cm.SetAnnotations(nil)
+			cm.Data["key1"] = "modified again"
+			b.observe(ctx, configMaps, nil, configMapsConfig, configMetadataList{})
+			Expect(b.blockedBy(instance, configMaps, nil, configMapsConfig, configMetadataList{})).To(HaveLen(1))
+		})
+
+		It("does not block when the workload is overridden", func() {
+			instance.SetAnnotations(map[string]string{BlastRadiusOverrideAnnotation: "true"})
+			Expect(b.blockedBy(instance, configMaps, nil, configMapsConfig, configMetadataList{})).To(BeEmpty())
+		})
+
+		It("does not block when the child is overridden by a flag", func() {
+			b.overrides = []childRef{{kind: configMapKind, name: GetNamespacedName("example*", "def*")}}
+			Expect(b.blockedBy(instance, configMaps, nil, configMapsConfig, configMetadataList{})).To(BeEmpty())
+
+			b.overrides = nil
+			Expect(b.blockedBy(instance, configMaps, nil, configMapsConfig, configMetadataList{})).To(BeEmpty())
+		})
+	})
+
+	Context("with a namespace limit", func() {
+		var workloads []client.Object
+
+		BeforeEach(func() {
+			workloads = []client.Object{instance.DeepCopy()}
+		})
+
+		JustBeforeEach(func() {
+			var err error
+			b, err = NewBlastRadiusBreaker(fake.NewClientBuilder().WithObjects(workloads...).Build(), recorder, 0, 50, nil)
+			Expect(err).NotTo(HaveOccurred())
+			deployments = NewHandler[*appsv1.Deployment](nil, recorder, HandlerOptions{BlastRadiusBreaker: b})
+			deployments.watchChildrenForInstance(instance, configMapsConfig, configMetadataList{})
+			b.observe(ctx, configMaps, nil, configMapsConfig, configMetadataList{})
+		})
+
+		It("blocks when the change rolls too many workloads of the namespace", func() {
+			cm.Data["key1"] = "modified"
+			b.observe(ctx, configMaps, nil, configMapsConfig, configMetadataList{})
+			Expect(b.blockedBy(instance, configMaps, nil, configMapsConfig, configMetadataList{})).To(HaveLen(1))
+			Expect(recorder.Events).To(Receive(ContainSubstring("would roll 1 of 1 workloads in namespace default")))
+		})
+
+		Context("with workloads which do not reference the child", func() {
+			BeforeEach(func() {
+				other := &appsv1.StatefulSet{ObjectMeta: instance.ObjectMeta}
+				other.SetName("other")
+				unmanaged := &appsv1.DaemonSet{ObjectMeta: instance.ObjectMeta}
+				unmanaged.SetName("unmanaged")
+				elsewhere := instance.DeepCopy()
+				elsewhere.SetNamespace("other")
+				workloads = append(workloads, other, unmanaged, elsewhere)
+			})
+
+			It("counts all workloads of the namespace", func() {
+				Expect(b.countWorkloads(ctx, "default")).To(Equal(3))
+				Expect(b.countWorkloads(ctx, "other")).To(Equal(1))
+			})
+
+			It("does not block when 1 of 1 watched workloads changes", func() {
+				cm.Data["key1"] = "modified"
+				b.observe(ctx, configMaps, nil, configMapsConfig, configMetadataList{})
+				Expect(b.blockedBy(instance, configMaps, nil, configMapsConfig, configMetadataList{})).To(BeEmpty())
+				Expect(recorder.Events).NotTo(Receive())
+			})
+		})
+	})
+
+	DescribeTable("parses the overrides",
+		func(overrides []string, valid bool) {
+			_, err := NewBlastRadiusBreaker(nil, recorder, 1, 0, overrides)
+			if valid {
+				Expect(err).NotTo(HaveOccurred())
+			} else {
+				Expect(err).To(HaveOccurred())
+			}
+		},
+		Entry("without overrides", []string{""}, true),
+		Entry("with children", []string{"configmap/default/app", "secret/team-*/registry"}, true),
+		Entry("with an unknown kind", []string{"pod/default/app"}, false),
+		Entry("without a namespace", []string{"configmap/app"}, false),
+		Entry("with an invalid pattern", []string{"configmap/default/[app"}, false),
+	)
+
+	It("blocks workloads with a pending annotation for a child", func() {
+		setBlastRadiusPending(instance, []string{fmt.Sprintf("configmap/%s/%s", cm.GetNamespace(), cm.GetName())})
+		Expect(b.blockedBy(instance, configMaps, nil, configMapsConfig, configMetadataList{})).To(HaveLen(1))
+
+		Expect(clearBlastRadiusPending(instance)).To(BeTrue())
+		Expect(b.blockedBy(instance, configMaps, nil, configMapsConfig, configMetadataList{})).To(BeEmpty())
+	})
+
+	It("never blocks when disabled", func() {
+		var disabled *BlastRadiusBreaker
+		disabled.observe(ctx, configMaps, nil, configMapsConfig, configMetadataList{})
+		Expect(disabled.blockedBy(instance, configMaps, nil, configMapsConfig, configMetadataList{})).To(BeEmpty())
+	})
+})
@@ -0,0 +1,119 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// ChildDeletionPolicy controls how Wave handles the deletion of a child
+// which a workload references
+type ChildDeletionPolicy string
+
+const (
+	// ChildDeletionRoll updates the hash of the workload like for any other
+	// change. Workloads missing required children are not updated.
+	ChildDeletionRoll ChildDeletionPolicy = "roll"
+
+	// ChildDeletionFreeze keeps the current hash and records Warning events
+	// until the child is recreated
+	ChildDeletionFreeze ChildDeletionPolicy = "freeze"
+
+	// ChildDeletionIgnore keeps the current hash until the child is recreated
+	ChildDeletionIgnore ChildDeletionPolicy = "ignore"
+)
+
+// ParseChildDeletionPolicy parses the value of the --child-deletion-policy
+// flag or annotation
+func ParseChildDeletionPolicy(value string) (ChildDeletionPolicy, error) {
+	switch policy := ChildDeletionPolicy(value); policy {
+	case ChildDeletionRoll, ChildDeletionFreeze, ChildDeletionIgnore:
+		return policy, nil
+	}
+	return "", fmt.Errorf("invalid child deletion policy %q: must be %s, %s or %s", value, ChildDeletionRoll, ChildDeletionFreeze, ChildDeletionIgnore)
+}
+
+// childDeletionPolicy returns the policy of the instance, which may be
+// overridden by an annotation
+func (h *Handler[I]) childDeletionPolicy(instance I) ChildDeletionPolicy {
+	if value, ok := instance.GetAnnotations()[ChildDeletionPolicyAnnotation]; ok {
+		if policy, err := ParseChildDeletionPolicy(value); err == nil {
+			return policy
+		}
+	}
+	return h.defaultChildDeletionPolicy
+}
+
+// heldDeletions returns the children of the instance which were deleted since
+// its last update if their deletion must not change its hash (yet). While the
+// deletion is within the grace period it also returns the remaining time.
+// Only children recorded at the last update count as deleted. Without a
+// record, e.g. after a restart of Wave, nothing is held. It does not change
+// the record, so the webhook can call it without moving the baseline.
+func (h *Handler[I]) heldDeletions(instance I, configMaps map[types.NamespacedName]*corev1.ConfigMap, secrets map[types.NamespacedName]*corev1.Secret, configMapsConfig configMetadataList, secretsConfig configMetadataList) ([]string, time.Duration) {
+	name := GetNamespacedNameFromObject(instance)
+	fingerprints := childFingerprints(configMaps, secrets, configMapsConfig, secretsConfig)
+	recorded, ok := h.rolloutHealth.recordedFingerprints(name)
+	if !ok {
+		return nil, 0
+	}
+	changed := h.rolloutHealth.changedChildren(name, fingerprints)
+	deleted := []string{}
+	isDeleted := func(ref string) bool {
+		if slices.Contains(deleted, ref) {
+			return false
+		}
+		_, wasRecorded := recorded[ref]
+		return wasRecorded && slices.Contains(changed, ref)
+	}
+
+	deletedConfigMaps := configMetadataList{}
+	for _, child := range configMapsConfig {
+		ref := childRef{kind: configMapKind, name: child.name}.String()
+		if _, ok := configMaps[child.name]; !ok && isDeleted(ref) {
+			deleted = append(deleted, ref)
+			deletedConfigMaps = append(deletedConfigMaps, child)
+		}
+	}
+	deletedSecrets := configMetadataList{}
+	for _, child := range secretsConfig {
+		ref := childRef{kind: secretKind, name: child.name}.String()
+		if _, ok := secrets[child.name]; !ok && isDeleted(ref) {
+			deleted = append(deleted, ref)
+			deletedSecrets = append(deletedSecrets, child)
+		}
+	}
+	if len(deleted) == 0 {
+		return nil, 0
+	}
+
+	// Wait for children which are deleted and recreated, e.g. by Helm hooks
+	if last, ok := h.lastChildChange(deletedConfigMaps, deletedSecrets); ok {
+		if remaining := h.childDeletionGracePeriod - time.Since(last); remaining > 0 {
+			return deleted, remaining
+		}
+	}
+	if h.childDeletionPolicy(instance) == ChildDeletionRoll {
+		return nil, 0
+	}
+	return deleted, 0
+}
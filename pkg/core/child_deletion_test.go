@@ -0,0 +1,193 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"math"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	"golang.org/x/time/rate"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var _ = Describe("Wave child deletion Suite", func() {
+	var h *Handler[*appsv1.Deployment]
+	var c client.Client
+	var recorder *record.FakeRecorder
+	var deploymentObject *appsv1.Deployment
+	var deletable *corev1.ConfigMap
+	var opts HandlerOptions
+
+	BeforeEach(func() {
+		deploymentObject = utils.ExampleDeployment.DeepCopy()
+		deploymentObject.Annotations[RequiredAnnotation] = requiredAnnotationValue
+		delete(deploymentObject.Annotations, ExtraConfigMapsAnnotation)
+		delete(deploymentObject.Annotations, ExtraSecretsAnnotation)
+		container := &deploymentObject.Spec.Template.Spec.Containers[0]
+		container.EnvFrom = append(container.EnvFrom, corev1.EnvFromSource{
+			ConfigMapRef: &corev1.ConfigMapEnvSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "deletable"},
+				Optional:             ptr.To(true),
+			},
+		})
+		deletable = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "deletable", Namespace: deploymentObject.Namespace},
+			Data:       map[string]string{"key": "value"},
+		}
+
+		objects := []client.Object{
+			deploymentObject,
+			deletable,
+			utils.ExampleConfigMap1.DeepCopy(),
+			utils.ExampleConfigMap2.DeepCopy(),
+			utils.ExampleConfigMap3.DeepCopy(),
+			utils.ExampleConfigMap4.DeepCopy(),
+			utils.ExampleConfigMap5.DeepCopy(),
+			utils.ExampleConfigMap6.DeepCopy(),
+		}
+		for _, s := range []*corev1.Secret{
+			utils.ExampleSecret1.DeepCopy(),
+			utils.ExampleSecret2.DeepCopy(),
+			utils.ExampleSecret3.DeepCopy(),
+			utils.ExampleSecret4.DeepCopy(),
+			utils.ExampleSecret5.DeepCopy(),
+			utils.ExampleSecret6.DeepCopy(),
+		} {
+			// The fake client does not merge stringData into data like the API server
+			if s.Data == nil {
+				s.Data = map[string][]byte{}
+			}
+			for key, value := range s.StringData {
+				s.Data[key] = []byte(value)
+			}
+			objects = append(objects, s)
+		}
+		c = fake.NewClientBuilder().WithObjects(objects...).Build()
+		recorder = record.NewFakeRecorder(10)
+		opts = HandlerOptions{
+			UpdateThrottler: NewUpdateThrottler(rate.Limit(math.Inf(1)), 1),
+		}
+	})
+
+	// handle reconciles the deployment with all children and again after
+	// deleting the deletable child and returns the hashes before and after
+	handle := func() (string, string, reconcile.Result) {
+		h = NewHandler[*appsv1.Deployment](c, recorder, opts)
+		name := GetNamespacedNameFromObject(deploymentObject)
+		updated := &appsv1.Deployment{}
+		_, err := h.Handle(context.TODO(), name, &appsv1.Deployment{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.Get(context.TODO(), name, updated)).To(Succeed())
+		before := getConfigHash(updated)
+		Expect(before).NotTo(BeEmpty())
+		Expect(recorder.Events).To(Receive(ContainSubstring("ConfigChanged")))
+
+		Expect(c.Delete(context.TODO(), deletable)).To(Succeed())
+		e := &enqueueRequestForWatcher{WatcherList: h.GetWatchedConfigmaps()}
+		e.recordChange(deletable)
+		result, err := h.Handle(context.TODO(), name, &appsv1.Deployment{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(c.Get(context.TODO(), name, updated)).To(Succeed())
+		return before, getConfigHash(updated), result
+	}
+
+	It("rolls the workload by default", func() {
+		before, after, _ := handle()
+		Expect(after).NotTo(Equal(before))
+		Expect(recorder.Events).To(Receive(ContainSubstring("ConfigChanged")))
+	})
+
+	It("keeps the hash and warns with freeze", func() {
+		deploymentObject.Annotations[ChildDeletionPolicyAnnotation] = string(ChildDeletionFreeze)
+		Expect(c.Update(context.TODO(), deploymentObject)).To(Succeed())
+		before, after, _ := handle()
+		Expect(after).To(Equal(before))
+		Expect(recorder.Events).To(Receive(ContainSubstring("ChildDeleted")))
+	})
+
+	It("only warns again when the deleted children change", func() {
+		deploymentObject.Annotations[ChildDeletionPolicyAnnotation] = string(ChildDeletionFreeze)
+		Expect(c.Update(context.TODO(), deploymentObject)).To(Succeed())
+		handle()
+		Expect(recorder.Events).To(Receive(ContainSubstring("ChildDeleted")))
+
+		name := GetNamespacedNameFromObject(deploymentObject)
+		_, err := h.Handle(context.TODO(), name, &appsv1.Deployment{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(recorder.Events).NotTo(Receive())
+
+		// Once the child is back, its next deletion is reported again
+		deletable.ResourceVersion = ""
+		Expect(c.Create(context.TODO(), deletable)).To(Succeed())
+		_, err = h.Handle(context.TODO(), name, &appsv1.Deployment{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(h.reportedDeletions.reported).NotTo(HaveKey(name))
+	})
+
+	It("does not record the children in the webhook", func() {
+		h = NewHandler[*appsv1.Deployment](c, recorder, opts)
+		name := GetNamespacedNameFromObject(deploymentObject)
+		instance := &appsv1.Deployment{}
+		Expect(c.Get(context.TODO(), name, instance)).To(Succeed())
+		Expect(h.HandleWebhook(instance, instance.DeepCopy(), nil, false)).To(Succeed())
+		_, recorded := h.rolloutHealth.recordedFingerprints(name)
+		Expect(recorded).To(BeFalse())
+	})
+
+	It("keeps the hash silently with ignore", func() {
+		opts.ChildDeletionPolicy = ChildDeletionIgnore
+		before, after, _ := handle()
+		Expect(after).To(Equal(before))
+		Expect(recorder.Events).NotTo(Receive())
+	})
+
+	It("waits for the grace period", func() {
+		opts.ChildDeletionGracePeriod = time.Minute
+		before, after, result := handle()
+		Expect(after).To(Equal(before))
+		Expect(result.RequeueAfter).To(BeNumerically("~", time.Minute, time.Second))
+	})
+
+	It("does not hold workloads after a restart", func() {
+		deploymentObject.Annotations[ChildDeletionPolicyAnnotation] = string(ChildDeletionFreeze)
+		Expect(c.Update(context.TODO(), deploymentObject)).To(Succeed())
+		name := GetNamespacedNameFromObject(deploymentObject)
+		before, _, _ := handle()
+		Expect(recorder.Events).To(Receive(ContainSubstring("ChildDeleted")))
+
+		// A new Handler has no record of the children at the last update
+		h = NewHandler[*appsv1.Deployment](c, recorder, opts)
+		_, err := h.Handle(context.TODO(), name, &appsv1.Deployment{})
+		Expect(err).NotTo(HaveOccurred())
+		updated := &appsv1.Deployment{}
+		Expect(c.Get(context.TODO(), name, updated)).To(Succeed())
+		Expect(getConfigHash(updated)).NotTo(Equal(before))
+		Expect(recorder.Events).To(Receive(ContainSubstring("ConfigChanged")))
+		Expect(recorder.Events).NotTo(Receive())
+	})
+})
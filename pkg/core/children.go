@@ -19,13 +19,14 @@ package core
 import (
 	"context"
 	"fmt"
-	"reflect"
+	"sort"
 	"strings"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
@@ -35,6 +36,7 @@ type getResult struct {
 	Object
 	types.NamespacedName
 	error
+	kind string
 }
 
 // getCurrentChildren returns a list of all Secrets and ConfigMaps that are
@@ -42,6 +44,20 @@ type getResult struct {
 // (i.e. via an EnvFrom or a Volume) will result in one entry in the list, irrespective of
 // whether individual elements are also references (i.e. via an Env entry).
 func (h *Handler[I]) getCurrentChildren(configMapsConfig configMetadataList, secretsConfig configMetadataList) (map[types.NamespacedName]*corev1.ConfigMap, map[types.NamespacedName]*corev1.Secret, error) {
+	configMaps, secrets, unreadable := h.getReadableChildren(configMapsConfig, secretsConfig)
+
+	// If there were any errors, don't return any children
+	if len(unreadable) > 0 {
+		return nil, nil, fmt.Errorf("error(s) encountered when geting children: %s", describeUnreadableChildren(unreadable))
+	}
+
+	// No errors, return the list of children
+	return configMaps, secrets, nil
+}
+
+// getReadableChildren works like getCurrentChildren but reads every child on
+// its own. Children which could not be read are returned instead of an error.
+func (h *Handler[I]) getReadableChildren(configMapsConfig configMetadataList, secretsConfig configMetadataList) (map[types.NamespacedName]*corev1.ConfigMap, map[types.NamespacedName]*corev1.Secret, []unreadableChild) {
 	uniqueConfigMaps := make(map[types.NamespacedName]bool)
 	uniqueSecrets := make(map[types.NamespacedName]bool)
 
@@ -66,133 +82,44 @@ func (h *Handler[I]) getCurrentChildren(configMapsConfig configMetadataList, sec
 	}
 
 	// Range over and collect results from the gets
-	var errs []string
+	unreadable := []unreadableChild{}
 	secrets := make(map[types.NamespacedName]*corev1.Secret)
 	configMaps := make(map[types.NamespacedName]*corev1.ConfigMap)
 	for i := 0; i < len(uniqueConfigMaps)+len(uniqueSecrets); i++ {
 		result := <-resultsChan
 		if result.error != nil {
-			errs = append(errs, result.error.Error())
+			unreadable = append(unreadable, unreadableChild{childRef: childRef{kind: result.kind, name: result.NamespacedName}, err: result.error})
 		}
-		if result.Object != nil {
-			if s, ok := result.Object.(*corev1.Secret); ok {
-				secrets[result.NamespacedName] = s
-			} else if cm, ok := result.Object.(*corev1.ConfigMap); ok {
-				configMaps[result.NamespacedName] = cm
-			} else {
-				return nil, nil, fmt.Errorf("passed unknown type: %v", reflect.TypeOf(result.Object))
-			}
+		switch obj := result.Object.(type) {
+		case *corev1.Secret:
+			secrets[result.NamespacedName] = obj
+		case *corev1.ConfigMap:
+			configMaps[result.NamespacedName] = obj
 		}
 	}
-
-	// If there were any errors, don't return any children
-	if len(errs) > 0 {
-		return nil, nil, fmt.Errorf("error(s) encountered when geting children: %s", strings.Join(errs, ", "))
-	}
-
-	// No errors, return the list of children
-	return configMaps, secrets, nil
+	sort.Slice(unreadable, func(i, j int) bool {
+		return unreadable[i].String() < unreadable[j].String()
+	})
+	return configMaps, secrets, unreadable
 }
 
 // getChildNamesByType parses the Deployment object and returns two maps,
 // the first containing ConfigMap metadata for all referenced ConfigMaps, keyed on the name of the ConfigMap,
-// the second containing Secret metadata for all referenced Secrets, keyed on the name of the Secrets
+// the second containing Secret metadata for all referenced Secrets, keyed on the name of the Secrets.
+// The references are found by the ReferenceExtractors.
 func getChildNamesByType[I InstanceType](obj I) (configMetadataList, configMetadataList) {
 	// Create sets for storing the names fo the ConfigMaps/Secrets
 	configMaps := configMetadataList{}
 	secrets := configMetadataList{}
 
-	// Range through all Volumes and check the VolumeSources for ConfigMaps
-	// and Secrets
-	for _, vol := range GetPodTemplate(obj).Spec.Volumes {
-		if cm := vol.VolumeSource.ConfigMap; cm != nil {
-			configMaps = append(configMaps, configMetadata{required: isRequired(cm.Optional), allKeys: true, name: GetNamespacedName(cm.Name, obj.GetNamespace())})
-		}
-		if s := vol.VolumeSource.Secret; s != nil {
-			secrets = append(secrets, configMetadata{required: isRequired(s.Optional), allKeys: true, name: GetNamespacedName(s.SecretName, obj.GetNamespace())})
-		}
-
-		if projection := vol.VolumeSource.Projected; projection != nil {
-			for _, source := range projection.Sources {
-				if cm := source.ConfigMap; cm != nil {
-					if cm.Items == nil {
-						configMaps = append(configMaps, configMetadata{required: isRequired(cm.Optional), allKeys: true, name: GetNamespacedName(cm.Name, obj.GetNamespace())})
-					} else {
-						keys := make(map[string]struct{})
-						for _, item := range cm.Items {
-							keys[item.Key] = struct{}{}
-						}
-						configMaps = append(configMaps, configMetadata{required: isRequired(cm.Optional), allKeys: false, keys: keys, name: GetNamespacedName(cm.Name, obj.GetNamespace())})
-					}
-				}
-				if s := source.Secret; s != nil {
-					if s.Items == nil {
-						secrets = append(secrets, configMetadata{required: isRequired(s.Optional), allKeys: true, name: GetNamespacedName(s.Name, obj.GetNamespace())})
-					} else {
-						keys := make(map[string]struct{})
-						for _, item := range s.Items {
-							keys[item.Key] = struct{}{}
-						}
-						secrets = append(secrets, configMetadata{required: isRequired(s.Optional), allKeys: false, keys: keys, name: GetNamespacedName(s.Name, obj.GetNamespace())})
-					}
-				}
-			}
-		}
-	}
-
-	// Parse deployment annotations for cms/secrets used inside the pod
-	if annotations := obj.GetAnnotations(); annotations != nil {
-		if configMapString, ok := annotations[ExtraConfigMapsAnnotation]; ok {
-			for _, cm := range strings.Split(configMapString, ",") {
-				parts := strings.Split(cm, "/")
-				if len(parts) == 1 {
-					configMaps = append(configMaps, configMetadata{required: false, allKeys: true, name: GetNamespacedName(parts[0], obj.GetNamespace())})
-				} else if len(parts) == 2 {
-					configMaps = append(configMaps, configMetadata{required: false, allKeys: true, name: GetNamespacedName(parts[1], parts[0])})
-				}
-			}
-		}
-		if secretString, ok := annotations[ExtraSecretsAnnotation]; ok {
-			for _, secret := range strings.Split(secretString, ",") {
-				parts := strings.Split(secret, "/")
-				if len(parts) == 1 {
-					secrets = append(secrets, configMetadata{required: false, allKeys: true, name: GetNamespacedName(parts[0], obj.GetNamespace())})
-				} else if len(parts) == 2 {
-					secrets = append(secrets, configMetadata{required: false, allKeys: true, name: GetNamespacedName(parts[1], parts[0])})
-				}
-			}
-		}
-	}
-
-	// Range through all Containers and their respective EnvFrom,
-	// then check the EnvFromSources for ConfigMaps and Secrets
-	for _, container := range GetPodTemplate(obj).Spec.Containers {
-		for _, env := range container.EnvFrom {
-			if cm := env.ConfigMapRef; cm != nil {
-				configMaps = append(configMaps, configMetadata{required: isRequired(cm.Optional), allKeys: true, name: GetNamespacedName(cm.Name, obj.GetNamespace())})
-			}
-			if s := env.SecretRef; s != nil {
-				secrets = append(secrets, configMetadata{required: isRequired(s.Optional), allKeys: true, name: GetNamespacedName(s.Name, obj.GetNamespace())})
-			}
-		}
-	}
-
-	// Range through all Containers and their respective Env
-	for _, container := range GetPodTemplate(obj).Spec.Containers {
-		for _, env := range container.Env {
-			if valFrom := env.ValueFrom; valFrom != nil {
-				if cm := valFrom.ConfigMapKeyRef; cm != nil {
-					keys := map[string]struct{}{
-						cm.Key: {},
-					}
-					configMaps = append(configMaps, configMetadata{required: isRequired(cm.Optional), allKeys: false, keys: keys, name: GetNamespacedName(cm.Name, obj.GetNamespace())})
-				}
-				if s := valFrom.SecretKeyRef; s != nil {
-					keys := map[string]struct{}{
-						s.Key: {},
-					}
-					secrets = append(secrets, configMetadata{required: isRequired(s.Optional), allKeys: false, keys: keys, name: GetNamespacedName(s.Name, obj.GetNamespace())})
-				}
+	template := GetPodTemplate(obj)
+	for _, extractor := range ReferenceExtractors {
+		for _, ref := range extractor.ExtractReferences(obj, template) {
+			switch ref.Kind {
+			case configMapKind:
+				configMaps = append(configMaps, ref.metadata())
+			case secretKind:
+				secrets = append(secrets, ref.metadata())
 			}
 		}
 	}
@@ -201,6 +128,15 @@ func getChildNamesByType[I InstanceType](obj I) (configMetadataList, configMetad
 }
 
 func (h *Handler[I]) checkRequiredChildren(configMaps map[types.NamespacedName]*corev1.ConfigMap, secrets map[types.NamespacedName]*corev1.Secret, configMapsConfig configMetadataList, secretsConfig configMetadataList) error {
+	if errors := missingRequiredChildren(configMaps, secrets, configMapsConfig, secretsConfig); len(errors) > 0 {
+		return fmt.Errorf("not all required children exist: %s", strings.Join(errors, ", "))
+	}
+	return nil
+}
+
+// missingRequiredChildren returns a description of every required child or
+// key which does not exist
+func missingRequiredChildren(configMaps map[types.NamespacedName]*corev1.ConfigMap, secrets map[types.NamespacedName]*corev1.Secret, configMapsConfig configMetadataList, secretsConfig configMetadataList) []string {
 	errors := []string{}
 	for _, childConfig := range configMapsConfig {
 		if !childConfig.required {
@@ -239,10 +175,7 @@ func (h *Handler[I]) checkRequiredChildren(configMaps map[types.NamespacedName]*
 			}
 		}
 	}
-	if len(errors) > 0 {
-		return fmt.Errorf("not all required children exist: %s", strings.Join(errors, ", "))
-	}
-	return nil
+	return errors
 }
 
 func isRequired(b *bool) bool {
@@ -252,26 +185,34 @@ func isRequired(b *bool) bool {
 // getConfigMap gets a ConfigMap with the given name and namespace from the
 // API server.
 func (h *Handler[I]) getConfigMap(name types.NamespacedName) getResult {
-	return h.getObject(name, &corev1.ConfigMap{})
+	result := h.getObject(name, &corev1.ConfigMap{})
+	result.kind = configMapKind
+	return result
 }
 
 // getSecret gets a Secret with the given name and namespace from the
 // API server.
 func (h *Handler[I]) getSecret(name types.NamespacedName) getResult {
-	return h.getObject(name, &corev1.Secret{})
+	result := h.getObject(name, &corev1.Secret{})
+	result.kind = secretKind
+	return result
 }
 
 // getObject gets the Object with the given name and namespace from the API
-// server
+// server. Objects in namespaces which are not cached are read directly.
 func (h *Handler[I]) getObject(name types.NamespacedName, obj Object) getResult {
-	err := h.Get(context.TODO(), name, obj)
+	var reader client.Reader = h.Client
+	if !h.watchesNamespace(name.Namespace) {
+		reader = h.apiReader
+	}
+	err := reader.Get(context.TODO(), name, obj)
 	if err != nil {
 		if errors.IsNotFound(err) {
-			return getResult{nil, name, nil}
+			return getResult{NamespacedName: name}
 		}
-		return getResult{nil, name, err}
+		return getResult{NamespacedName: name, error: err}
 	}
-	return getResult{obj, name, nil}
+	return getResult{Object: obj, NamespacedName: name}
 }
 
 // getExistingChildren returns a list of all Secrets and ConfigMaps that are
@@ -324,3 +265,31 @@ func isOwnedBy(child, owner metav1.Object) bool {
 	}
 	return false
 }
+
+// parseExtraChildren parses the value of an extra-configmaps or extra-secrets
+// annotation. Entries are in the form name or namespace/name. It also returns
+// all entries which are not valid references.
+func parseExtraChildren(value string, namespace string) (configMetadataList, []string) {
+	children := configMetadataList{}
+	invalid := []string{}
+	for _, entry := range strings.Split(value, ",") {
+		parts := strings.Split(entry, "/")
+		switch len(parts) {
+		case 1:
+			children = append(children, configMetadata{required: false, allKeys: true, name: GetNamespacedName(parts[0], namespace)})
+		case 2:
+			children = append(children, configMetadata{required: false, allKeys: true, name: GetNamespacedName(parts[1], parts[0])})
+			if len(validation.IsDNS1123Label(parts[0])) > 0 {
+				invalid = append(invalid, entry)
+				continue
+			}
+		default:
+			invalid = append(invalid, entry)
+			continue
+		}
+		if len(validation.IsDNS1123Subdomain(parts[len(parts)-1])) > 0 {
+			invalid = append(invalid, entry)
+		}
+	}
+	return children, invalid
+}
@@ -19,15 +19,27 @@ package core
 import (
 	corev1 "k8s.io/api/core/v1"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
 // add adds a new Controller to mgr with r as the reconcile.Reconciler
 func AddController[I InstanceType](name string, typeInstance I, mgr manager.Manager, r reconcile.Reconciler, h *Handler[I]) error {
-	return ctrl.NewControllerManagedBy(mgr).
+	b := ctrl.NewControllerManagedBy(mgr).
 		For(typeInstance).
 		Watches(&corev1.ConfigMap{}, EnqueueRequestForWatcher(h.GetWatchedConfigmaps())).
-		Watches(&corev1.Secret{}, EnqueueRequestForWatcher(h.GetWatchedSecrets())).
-		Complete(r)
+		Watches(&corev1.Secret{}, EnqueueRequestForWatcher(h.GetWatchedSecrets()))
+	if h.watchesNamespaces() {
+		// Reconcile all workloads of a namespace when it opts in or out or
+		// starts or stops matching the namespace selector
+		b = b.Watches(&corev1.Namespace{}, handler.EnqueueRequestsFromMapFunc(h.requestsForNamespace), builder.WithPredicates(h.namespaceChanged()))
+	}
+	if h.watchImagePullSecrets {
+		// Reconcile the workloads running as a ServiceAccount when its image
+		// pull Secrets change
+		b = b.Watches(&corev1.ServiceAccount{}, handler.EnqueueRequestsFromMapFunc(h.requestsForServiceAccount), builder.WithPredicates(serviceAccountChanged()))
+	}
+	return b.Complete(r)
 }
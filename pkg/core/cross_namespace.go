@@ -0,0 +1,177 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// CrossNamespacePolicy restricts which namespaces the workloads of a
+// namespace may reference children in. Children in the namespace of the
+// workload can always be referenced. A nil policy allows all references.
+type CrossNamespacePolicy struct {
+	rules []crossNamespaceRule
+}
+
+// crossNamespaceRule allows workloads in namespaces matching source to
+// reference children in namespaces matching one of targets
+type crossNamespaceRule struct {
+	source  string
+	targets []string
+}
+
+// ParseCrossNamespacePolicy parses the value of the
+// --cross-namespace-references flag. Rules are separated by semicolons and
+// have the form source=target,target. Namespaces can be names or patterns
+// like tenant-*. An empty value returns a nil policy.
+func ParseCrossNamespacePolicy(value string) (*CrossNamespacePolicy, error) {
+	if value == "" {
+		return nil, nil
+	}
+	p := &CrossNamespacePolicy{}
+	for _, entry := range strings.Split(value, ";") {
+		source, targets, ok := strings.Cut(entry, "=")
+		if !ok || source == "" {
+			return nil, fmt.Errorf("invalid cross-namespace rule %q: must be source=target,target", entry)
+		}
+		rule := crossNamespaceRule{source: source}
+		if targets != "" {
+			rule.targets = strings.Split(targets, ",")
+		}
+		for _, pattern := range append([]string{source}, rule.targets...) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid cross-namespace rule %q: %v", entry, err)
+			}
+		}
+		p.rules = append(p.rules, rule)
+	}
+	return p, nil
+}
+
+// allows returns true if workloads in the source namespace may reference
+// children in the target namespace
+func (p *CrossNamespacePolicy) allows(source, target string) bool {
+	if p == nil || source == target {
+		return true
+	}
+	for _, rule := range p.rules {
+		if matched, _ := path.Match(rule.source, source); !matched {
+			continue
+		}
+		for _, pattern := range rule.targets {
+			if matched, _ := path.Match(pattern, target); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// UnwatchedReferencePolicy controls how Wave handles references to children
+// in namespaces it does not cache
+type UnwatchedReferencePolicy string
+
+const (
+	// UnwatchedReferenceReport ignores the children and reports them in
+	// Warning events and admission warnings
+	UnwatchedReferenceReport UnwatchedReferencePolicy = "report"
+
+	// UnwatchedReferenceRead reads the children directly from the API
+	// server. Their changes are picked up when the workload is reconciled.
+	UnwatchedReferenceRead UnwatchedReferencePolicy = "read"
+)
+
+// ParseUnwatchedReferencePolicy parses the value of the
+// --unwatched-references flag
+func ParseUnwatchedReferencePolicy(value string) (UnwatchedReferencePolicy, error) {
+	switch policy := UnwatchedReferencePolicy(value); policy {
+	case UnwatchedReferenceReport, UnwatchedReferenceRead:
+		return policy, nil
+	}
+	return "", fmt.Errorf("invalid unwatched reference policy %q: must be %s or %s", value, UnwatchedReferenceReport, UnwatchedReferenceRead)
+}
+
+// referencedChildren returns the children of the instance which Wave may read
+// and a description of every reference it ignores because of the
+// cross-namespace policy or because the namespace is not cached
+func (h *Handler[I]) referencedChildren(instance I) (configMetadataList, configMetadataList, []string) {
+	configMapsConfig, secretsConfig := getChildNamesByType(h.sourceInstance(instance))
+	pullSecrets, ignored := h.imagePullSecrets(instance)
+	secretsConfig = append(secretsConfig, pullSecrets...)
+	filter := func(kind string, children configMetadataList) configMetadataList {
+		allowed := configMetadataList{}
+		for _, child := range children {
+			switch {
+			case !h.crossNamespacePolicy.allows(instance.GetNamespace(), child.name.Namespace):
+				ignored = append(ignored, fmt.Sprintf("%s %s is in a namespace which workloads in %s may not reference", kind, child.name, instance.GetNamespace()))
+			case !h.watchesNamespace(child.name.Namespace) && h.unwatchedReferencePolicy != UnwatchedReferenceRead:
+				ignored = append(ignored, fmt.Sprintf("%s %s is in a namespace which Wave does not watch", kind, child.name))
+			default:
+				allowed = append(allowed, child)
+			}
+		}
+		return allowed
+	}
+	configMapsConfig = filter(configMapKind, configMapsConfig)
+	secretsConfig = filter(secretKind, secretsConfig)
+	sort.Strings(ignored)
+	return configMapsConfig, secretsConfig, dedupe(ignored)
+}
+
+// ignoredReferencesTracker remembers the references last reported for every
+// workload, e.g. as ignored, so that they are only reported again when they
+// change
+type ignoredReferencesTracker struct {
+	mutex    sync.Mutex
+	reported map[types.NamespacedName]string
+}
+
+func newIgnoredReferencesTracker() *ignoredReferencesTracker {
+	return &ignoredReferencesTracker{reported: make(map[types.NamespacedName]string)}
+}
+
+// changed records the ignored references of the workload and returns true if
+// there are any and they differ from the ones recorded before
+func (t *ignoredReferencesTracker) changed(name types.NamespacedName, ignored []string) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if len(ignored) == 0 {
+		delete(t.reported, name)
+		return false
+	}
+	sorted := append([]string{}, ignored...)
+	sort.Strings(sorted)
+	value := strings.Join(sorted, ", ")
+	if t.reported[name] == value {
+		return false
+	}
+	t.reported[name] = value
+	return true
+}
+
+// forget removes the workload from the tracker
+func (t *ignoredReferencesTracker) forget(name types.NamespacedName) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	delete(t.reported, name)
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Wave cross-namespace Suite", func() {
+	var deploymentObject *appsv1.Deployment
+	var shared *corev1.ConfigMap
+
+	BeforeEach(func() {
+		deploymentObject = utils.ExampleDeployment.DeepCopy()
+		deploymentObject.Annotations[RequiredAnnotation] = requiredAnnotationValue
+		delete(deploymentObject.Annotations, ExtraSecretsAnnotation)
+		deploymentObject.Annotations[ExtraConfigMapsAnnotation] = "shared/config,other/config"
+		shared = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "config", Namespace: "shared"},
+			Data:       map[string]string{"key": "value"},
+		}
+	})
+
+	Context("ParseCrossNamespacePolicy", func() {
+		It("returns nil for an empty value", func() {
+			p, err := ParseCrossNamespacePolicy("")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(p).To(BeNil())
+			Expect(p.allows("team-a", "other")).To(BeTrue())
+		})
+
+		It("allows the targets of matching rules", func() {
+			p, err := ParseCrossNamespacePolicy("team-a=shared,team-a-*;*=common")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(p.allows("team-a", "shared")).To(BeTrue())
+			Expect(p.allows("team-a", "team-a-config")).To(BeTrue())
+			Expect(p.allows("team-a", "common")).To(BeTrue())
+			Expect(p.allows("team-b", "common")).To(BeTrue())
+			Expect(p.allows("team-b", "shared")).To(BeFalse())
+			Expect(p.allows("team-b", "team-b")).To(BeTrue())
+		})
+
+		It("denies all cross-namespace references without targets", func() {
+			p, err := ParseCrossNamespacePolicy("*=")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(p.allows("team-a", "shared")).To(BeFalse())
+		})
+
+		It("returns an error for invalid rules", func() {
+			_, err := ParseCrossNamespacePolicy("team-a")
+			Expect(err).To(HaveOccurred())
+			_, err = ParseCrossNamespacePolicy("team-a=shared-[")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("referencedChildren", func() {
+		It("ignores references the policy does not allow", func() {
+			policy, err := ParseCrossNamespacePolicy("default=shared")
+			Expect(err).NotTo(HaveOccurred())
+			h := NewHandler[*appsv1.Deployment](fake.NewClientBuilder().Build(), record.NewFakeRecorder(10), HandlerOptions{
+				CrossNamespacePolicy: policy,
+			})
+
+			configMapsConfig, _, ignored := h.referencedChildren(deploymentObject)
+			names := []types.NamespacedName{}
+			for _, child := range configMapsConfig {
+				names = append(names, child.name)
+			}
+			Expect(names).To(ContainElement(types.NamespacedName{Namespace: "shared", Name: "config"}))
+			Expect(names).NotTo(ContainElement(types.NamespacedName{Namespace: "other", Name: "config"}))
+			Expect(ignored).To(Equal([]string{"configmap other/config is in a namespace which workloads in default may not reference"}))
+		})
+
+		It("reports references to namespaces which are not watched", func() {
+			h := NewHandler[*appsv1.Deployment](fake.NewClientBuilder().Build(), record.NewFakeRecorder(10), HandlerOptions{
+				WatchedNamespaces: []string{"default", "shared"},
+			})
+
+			_, _, ignored := h.referencedChildren(deploymentObject)
+			Expect(ignored).To(Equal([]string{"configmap other/config is in a namespace which Wave does not watch"}))
+		})
+
+		It("reads references to namespaces which are not watched directly", func() {
+			h := NewHandler[*appsv1.Deployment](fake.NewClientBuilder().Build(), record.NewFakeRecorder(10), HandlerOptions{
+				WatchedNamespaces:        []string{"default"},
+				UnwatchedReferencePolicy: UnwatchedReferenceRead,
+				APIReader:                fake.NewClientBuilder().WithObjects(shared).Build(),
+			})
+
+			configMapsConfig, secretsConfig, ignored := h.referencedChildren(deploymentObject)
+			Expect(ignored).To(BeEmpty())
+			configMaps, _, err := h.getCurrentChildren(configMapsConfig, secretsConfig)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(configMaps).To(HaveKey(types.NamespacedName{Namespace: "shared", Name: "config"}))
+		})
+	})
+
+	It("only reports ignored references when they change", func() {
+		t := newIgnoredReferencesTracker()
+		name := GetNamespacedNameFromObject(deploymentObject)
+		Expect(t.changed(name, []string{"a", "b"})).To(BeTrue())
+		Expect(t.changed(name, []string{"b", "a"})).To(BeFalse())
+		Expect(t.changed(name, []string{"a"})).To(BeTrue())
+		Expect(t.changed(name, nil)).To(BeFalse())
+		Expect(t.changed(name, []string{"a"})).To(BeTrue())
+		t.forget(name)
+		Expect(t.changed(name, []string{"a"})).To(BeTrue())
+	})
+
+	It("parses the unwatched reference policy", func() {
+		Expect(ParseUnwatchedReferencePolicy("read")).To(Equal(UnwatchedReferenceRead))
+		_, err := ParseUnwatchedReferencePolicy("ignore")
+		Expect(err).To(HaveOccurred())
+	})
+})
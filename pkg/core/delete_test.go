@@ -27,6 +27,7 @@ import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/wave-k8s/wave/test/utils"
+	"golang.org/x/time/rate"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -57,7 +58,7 @@ var _ = Describe("Wave migration Suite", func() {
 		var cerr error
 		c, cerr = client.New(cfg, client.Options{Scheme: scheme.Scheme})
 		Expect(cerr).NotTo(HaveOccurred())
-		h = NewHandler[*appsv1.Deployment](c, mgr.GetEventRecorderFor("wave"), math.Inf(1), 1)
+		h = NewHandler[*appsv1.Deployment](c, mgr.GetEventRecorderFor("wave"), HandlerOptions{UpdateThrottler: NewUpdateThrottler(rate.Limit(math.Inf(1)), 1)})
 		m = utils.Matcher{Client: c}
 
 		// Create some configmaps and secrets
@@ -0,0 +1,81 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"errors"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// reportDryRun logs and records an event for an update of the instance which
+// was skipped because the controller runs in dry-run mode
+func (h *Handler[I]) reportDryRun(instance I, oldHash string, hash string, changed []string, schedulingChange bool) {
+	log := logf.Log.WithName("wave").WithValues("namespace", instance.GetNamespace(), "name", instance.GetName(), "dryRun", true)
+
+	children := "unknown"
+	if len(changed) > 0 {
+		children = strings.Join(changed, ", ")
+	}
+	if hash != oldHash {
+		log.V(0).Info("Would update instance hash", "oldHash", oldHash, "hash", hash, "children", children)
+		h.recorder.Eventf(instance, corev1.EventTypeNormal, "DryRunConfigChanged", "Would update configuration hash from %q to %q (changed: %s)", oldHash, hash, children)
+	}
+	if schedulingChange {
+		log.V(0).Info("Would enable scheduling since all children became available")
+		h.recorder.Eventf(instance, corev1.EventTypeNormal, "DryRunSchedulingEnabled", "Would enable scheduling since all children became available")
+	}
+}
+
+// reportWebhookDryRun runs the webhook on a copy of the instance and reports
+// the mutation it would apply without mutating the instance. Events are not
+// recorded for admission requests which are dry runs themselves.
+func (h *Handler[I]) reportWebhookDryRun(instance I, oldInstance I, requestDryRun bool, isCreate bool) error {
+	log := logf.Log.WithName("wave").WithValues("namespace", instance.GetNamespace(), "name", instance.GetName(), "dryRun", true, "isCreate", isCreate)
+	recordEvent := func(eventtype, reason, messageFmt string, args ...interface{}) {
+		if !requestDryRun {
+			h.recorder.Eventf(instance, eventtype, reason, messageFmt, args...)
+		}
+	}
+	mutated := instance.DeepCopyObject().(I)
+	if err := h.updatePodController(mutated, oldInstance, true, isCreate); err != nil {
+		var rejected *rejectedUpdateError
+		if !errors.As(err, &rejected) {
+			return err
+		}
+		log.V(0).Info("Would reject update due to missing children", "children", rejected.children)
+		recordEvent(corev1.EventTypeWarning, "DryRunUpdateRejected", "Would reject update due to missing children: %s", rejected.children)
+		return nil
+	}
+
+	if !isSchedulingDisabled(instance) && isSchedulingDisabled(mutated) {
+		log.V(0).Info("Would disable scheduling due to missing children")
+		recordEvent(corev1.EventTypeNormal, "DryRunSchedulingDisabled", "Would disable scheduling due to missing children")
+	}
+	if status, ok := mutated.GetAnnotations()[MissingChildrenAnnotation]; ok && status != instance.GetAnnotations()[MissingChildrenAnnotation] {
+		log.V(0).Info("Would apply missing children policy", "status", status)
+		recordEvent(corev1.EventTypeWarning, "DryRunMissingChildren", "Would apply missing children policy %s", status)
+	}
+	oldHash, hash := h.currentHash(instance), h.currentHash(mutated)
+	if hash != oldHash {
+		log.V(0).Info("Would update instance hash", "oldHash", oldHash, "hash", hash)
+		recordEvent(corev1.EventTypeNormal, "DryRunConfigChanged", "Would update configuration hash from %q to %q", oldHash, hash)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"math"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	"golang.org/x/time/rate"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Wave dry-run Suite", func() {
+	var h *Handler[*appsv1.Deployment]
+	var c client.Client
+	var recorder *record.FakeRecorder
+	var deploymentObject *appsv1.Deployment
+
+	BeforeEach(func() {
+		deploymentObject = utils.ExampleDeployment.DeepCopy()
+		deploymentObject.Annotations[RequiredAnnotation] = requiredAnnotationValue
+		delete(deploymentObject.Annotations, ExtraConfigMapsAnnotation)
+		delete(deploymentObject.Annotations, ExtraSecretsAnnotation)
+		objects := []client.Object{
+			deploymentObject,
+			utils.ExampleConfigMap1.DeepCopy(),
+			utils.ExampleConfigMap2.DeepCopy(),
+			utils.ExampleConfigMap3.DeepCopy(),
+			utils.ExampleConfigMap4.DeepCopy(),
+			utils.ExampleConfigMap5.DeepCopy(),
+			utils.ExampleConfigMap6.DeepCopy(),
+		}
+		for _, s := range []*corev1.Secret{
+			utils.ExampleSecret1.DeepCopy(),
+			utils.ExampleSecret2.DeepCopy(),
+			utils.ExampleSecret3.DeepCopy(),
+			utils.ExampleSecret4.DeepCopy(),
+			utils.ExampleSecret5.DeepCopy(),
+			utils.ExampleSecret6.DeepCopy(),
+		} {
+			// The fake client does not merge stringData into data like the API server
+			if s.Data == nil {
+				s.Data = map[string][]byte{}
+			}
+			for key, value := range s.StringData {
+				s.Data[key] = []byte(value)
+			}
+			objects = append(objects, s)
+		}
+		c = fake.NewClientBuilder().WithObjects(objects...).Build()
+		recorder = record.NewFakeRecorder(10)
+		h = NewHandler[*appsv1.Deployment](c, recorder, HandlerOptions{
+			UpdateThrottler: NewUpdateThrottler(rate.Limit(math.Inf(1)), 1),
+			DryRun:          true,
+		})
+	})
+
+	It("reports the hash update without updating the instance", func() {
+		name := GetNamespacedNameFromObject(deploymentObject)
+		_, err := h.Handle(context.TODO(), name, &appsv1.Deployment{})
+		Expect(err).NotTo(HaveOccurred())
+
+		updated := &appsv1.Deployment{}
+		Expect(c.Get(context.TODO(), name, updated)).To(Succeed())
+		Expect(getConfigHash(updated)).To(BeEmpty())
+		Expect(recorder.Events).To(Receive(ContainSubstring("DryRunConfigChanged")))
+	})
+
+	It("reports the webhook mutation without mutating the instance", func() {
+		original := deploymentObject.DeepCopy()
+		Expect(h.HandleWebhook(deploymentObject, nil, nil, true)).To(Succeed())
+		Expect(deploymentObject).To(Equal(original))
+		Expect(recorder.Events).To(Receive(ContainSubstring("DryRunConfigChanged")))
+	})
+
+	It("does not record events for admission requests which are dry runs", func() {
+		dryRun := true
+		Expect(h.HandleWebhook(deploymentObject, nil, &dryRun, true)).To(Succeed())
+		Expect(recorder.Events).NotTo(Receive())
+	})
+})
@@ -0,0 +1,187 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// ConfigMapKind is the Kind of ChildReferences to ConfigMaps
+	ConfigMapKind = configMapKind
+
+	// SecretKind is the Kind of ChildReferences to Secrets
+	SecretKind = secretKind
+)
+
+// ReferenceExtractor finds the ConfigMaps and Secrets a workload depends on.
+// obj is the workload and template its pod template. A child may be returned
+// several times, e.g. once per referenced key.
+type ReferenceExtractor interface {
+	ExtractReferences(obj metav1.Object, template *corev1.PodTemplateSpec) []ChildReference
+}
+
+// ReferenceExtractorFunc adapts a function to a ReferenceExtractor
+type ReferenceExtractorFunc func(obj metav1.Object, template *corev1.PodTemplateSpec) []ChildReference
+
+// ExtractReferences calls f(obj, template)
+func (f ReferenceExtractorFunc) ExtractReferences(obj metav1.Object, template *corev1.PodTemplateSpec) []ChildReference {
+	return f(obj, template)
+}
+
+var (
+	// VolumeExtractor finds ConfigMap, Secret and projected volumes
+	VolumeExtractor ReferenceExtractor = ReferenceExtractorFunc(extractVolumeReferences)
+
+	// AnnotationExtractor finds the children listed in the extra-configmaps
+	// and extra-secrets annotations
+	AnnotationExtractor ReferenceExtractor = ReferenceExtractorFunc(extractAnnotationReferences)
+
+	// EnvFromExtractor finds the envFrom sources of all containers
+	EnvFromExtractor ReferenceExtractor = ReferenceExtractorFunc(extractEnvFromReferences)
+
+	// EnvExtractor finds the configMapKeyRef and secretKeyRef environment
+	// variables of all containers
+	EnvExtractor ReferenceExtractor = ReferenceExtractorFunc(extractEnvReferences)
+)
+
+// ReferenceExtractors are called in order to find the children of every
+// workload. Custom builds of Wave can append extractors for their own
+// conventions in an init function.
+var ReferenceExtractors = []ReferenceExtractor{
+	VolumeExtractor,
+	AnnotationExtractor,
+	EnvFromExtractor,
+	EnvExtractor,
+}
+
+// referenceTo returns a ChildReference to a child in the namespace of obj
+func referenceTo(kind string, obj metav1.Object, name string, optional *bool, keys []string) ChildReference {
+	return ChildReference{Kind: kind, Name: GetNamespacedName(name, obj.GetNamespace()), Required: isRequired(optional), Keys: keys}
+}
+
+// itemKeys returns the keys of the items or nil if all keys are projected
+func itemKeys(items []corev1.KeyToPath) []string {
+	if items == nil {
+		return nil
+	}
+	keys := []string{}
+	for _, item := range items {
+		keys = append(keys, item.Key)
+	}
+	return keys
+}
+
+func extractVolumeReferences(obj metav1.Object, template *corev1.PodTemplateSpec) []ChildReference {
+	refs := []ChildReference{}
+	for _, vol := range template.Spec.Volumes {
+		if cm := vol.VolumeSource.ConfigMap; cm != nil {
+			refs = append(refs, referenceTo(configMapKind, obj, cm.Name, cm.Optional, nil))
+		}
+		if s := vol.VolumeSource.Secret; s != nil {
+			refs = append(refs, referenceTo(secretKind, obj, s.SecretName, s.Optional, nil))
+		}
+
+		if projection := vol.VolumeSource.Projected; projection != nil {
+			for _, source := range projection.Sources {
+				if cm := source.ConfigMap; cm != nil {
+					refs = append(refs, referenceTo(configMapKind, obj, cm.Name, cm.Optional, itemKeys(cm.Items)))
+				}
+				if s := source.Secret; s != nil {
+					refs = append(refs, referenceTo(secretKind, obj, s.Name, s.Optional, itemKeys(s.Items)))
+				}
+			}
+		}
+	}
+	return refs
+}
+
+func extractAnnotationReferences(obj metav1.Object, _ *corev1.PodTemplateSpec) []ChildReference {
+	refs := []ChildReference{}
+	annotations := obj.GetAnnotations()
+	if configMapString, ok := annotations[ExtraConfigMapsAnnotation]; ok {
+		extra, _ := parseExtraChildren(configMapString, obj.GetNamespace())
+		refs = append(refs, childReferenceList(configMapKind, extra)...)
+	}
+	if secretString, ok := annotations[ExtraSecretsAnnotation]; ok {
+		extra, _ := parseExtraChildren(secretString, obj.GetNamespace())
+		refs = append(refs, childReferenceList(secretKind, extra)...)
+	}
+	return refs
+}
+
+func extractEnvFromReferences(obj metav1.Object, template *corev1.PodTemplateSpec) []ChildReference {
+	refs := []ChildReference{}
+	for _, container := range template.Spec.Containers {
+		for _, env := range container.EnvFrom {
+			if cm := env.ConfigMapRef; cm != nil {
+				refs = append(refs, referenceTo(configMapKind, obj, cm.Name, cm.Optional, nil))
+			}
+			if s := env.SecretRef; s != nil {
+				refs = append(refs, referenceTo(secretKind, obj, s.Name, s.Optional, nil))
+			}
+		}
+	}
+	return refs
+}
+
+func extractEnvReferences(obj metav1.Object, template *corev1.PodTemplateSpec) []ChildReference {
+	refs := []ChildReference{}
+	for _, container := range template.Spec.Containers {
+		for _, env := range container.Env {
+			if valFrom := env.ValueFrom; valFrom != nil {
+				if cm := valFrom.ConfigMapKeyRef; cm != nil {
+					refs = append(refs, referenceTo(configMapKind, obj, cm.Name, cm.Optional, []string{cm.Key}))
+				}
+				if s := valFrom.SecretKeyRef; s != nil {
+					refs = append(refs, referenceTo(secretKind, obj, s.Name, s.Optional, []string{s.Key}))
+				}
+			}
+		}
+	}
+	return refs
+}
+
+// childReferenceList converts every entry of children to a ChildReference
+// without merging them
+func childReferenceList(kind string, children configMetadataList) []ChildReference {
+	refs := []ChildReference{}
+	for _, child := range children {
+		ref := ChildReference{Kind: kind, Name: child.name, Required: child.required}
+		if !child.allKeys {
+			ref.Keys = []string{}
+			for key := range child.keys {
+				ref.Keys = append(ref.Keys, key)
+			}
+		}
+		refs = append(refs, ref)
+	}
+	return refs
+}
+
+// metadata converts the ChildReference to a configMetadata
+func (r ChildReference) metadata() configMetadata {
+	child := configMetadata{name: r.Name, required: r.Required, allKeys: r.Keys == nil}
+	if r.Keys != nil {
+		child.keys = make(map[string]struct{})
+		for _, key := range r.Keys {
+			child.keys[key] = struct{}{}
+		}
+	}
+	return child
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+)
+
+var _ = Describe("Wave reference extractor Suite", func() {
+	var deploymentObject *appsv1.Deployment
+
+	BeforeEach(func() {
+		deploymentObject = utils.ExampleDeployment.DeepCopy()
+	})
+
+	It("extracts the keys of projected volumes", func() {
+		deploymentObject.Spec.Template.Spec.Volumes = []corev1.Volume{{
+			Name: "projected",
+			VolumeSource: corev1.VolumeSource{Projected: &corev1.ProjectedVolumeSource{Sources: []corev1.VolumeProjection{
+				{ConfigMap: &corev1.ConfigMapProjection{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "cm"},
+					Items:                []corev1.KeyToPath{{Key: "key1"}, {Key: "key2"}},
+				}},
+				{Secret: &corev1.SecretProjection{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "secret"},
+					Optional:             ptr.To(true),
+				}},
+			}}},
+		}}
+
+		refs := VolumeExtractor.ExtractReferences(deploymentObject, &deploymentObject.Spec.Template)
+		Expect(refs).To(Equal([]ChildReference{
+			{Kind: ConfigMapKind, Name: types.NamespacedName{Namespace: "default", Name: "cm"}, Required: true, Keys: []string{"key1", "key2"}},
+			{Kind: SecretKind, Name: types.NamespacedName{Namespace: "default", Name: "secret"}},
+		}))
+		Expect(refs[0].metadata()).To(Equal(configMetadata{
+			name:     types.NamespacedName{Namespace: "default", Name: "cm"},
+			required: true,
+			keys:     map[string]struct{}{"key1": {}, "key2": {}},
+		}))
+		Expect(refs[1].metadata()).To(Equal(configMetadata{
+			name:    types.NamespacedName{Namespace: "default", Name: "secret"},
+			allKeys: true,
+		}))
+	})
+
+	Context("with a custom extractor", func() {
+		var defaults []ReferenceExtractor
+
+		BeforeEach(func() {
+			defaults = ReferenceExtractors
+			ReferenceExtractors = append(ReferenceExtractors[:len(ReferenceExtractors):len(ReferenceExtractors)], ReferenceExtractorFunc(func(obj metav1.Object, template *corev1.PodTemplateSpec) []ChildReference {
+				refs := []ChildReference{}
+				for _, container := range template.Spec.Containers {
+					for _, env := range container.Env {
+						if env.Name == "CONFIG_CM_NAME" {
+							refs = append(refs, ChildReference{Kind: ConfigMapKind, Name: types.NamespacedName{Namespace: obj.GetNamespace(), Name: env.Value}, Required: true})
+						}
+					}
+				}
+				return refs
+			}))
+		})
+
+		AfterEach(func() {
+			ReferenceExtractors = defaults
+		})
+
+		It("adds the children it returns", func() {
+			container := &deploymentObject.Spec.Template.Spec.Containers[0]
+			container.Env = append(container.Env, corev1.EnvVar{Name: "CONFIG_CM_NAME", Value: "app-config"})
+
+			configMapsConfig, _ := getChildNamesByType(deploymentObject)
+			Expect(configMapsConfig).To(ContainElement(configMetadata{
+				name:     types.NamespacedName{Namespace: "default", Name: "app-config"},
+				required: true,
+				allKeys:  true,
+			}))
+		})
+	})
+})
@@ -0,0 +1,102 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Flags holds the command line flags which decide which workloads Wave
+// manages and which children their configuration hash covers. The manager
+// and the kubectl plugin bind the same flags so that the plugin answers
+// exactly like the controller.
+type Flags struct {
+	EnableConfigSnapshots    bool
+	UnreadableChildrenPolicy string
+	WatchImagePullSecrets    bool
+	NamespaceOptIn           bool
+	DefaultMode              string
+	WorkloadSelector         string
+	ControllerClass          string
+	ExcludeNamespaces        string
+	NamespaceSelector        string
+	CrossNamespaceReferences string
+	UnwatchedReferences      string
+	Namespaces               string
+}
+
+// BindFlags registers the flags on the FlagSet
+func (f *Flags) BindFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&f.EnableConfigSnapshots, "enable-config-snapshots", false, "Allow workloads to opt into immutable snapshots of their ConfigMaps and Secrets via the wave.pusher.com/snapshot-config annotation")
+	fs.StringVar(&f.UnreadableChildrenPolicy, "unreadable-children-policy", string(UnreadableChildrenBlock), "How workloads referencing ConfigMaps or Secrets which Wave cannot read are handled: block keeps the current hash, hash-readable calculates the hash from the children which can be read. Can be overridden per workload with the wave.pusher.com/on-unreadable-children annotation.")
+	fs.BoolVar(&f.WatchImagePullSecrets, "watch-image-pull-secrets", false, "Treat the imagePullSecrets of the pods and of their ServiceAccount as children of workloads with the wave.pusher.com/image-pull-secrets annotation set to \"true\". Requires permission to watch ServiceAccounts.")
+	fs.BoolVar(&f.NamespaceOptIn, "namespace-opt-in", false, "Enable Wave for all workloads in namespaces with the wave.pusher.com/update-on-config-change label or annotation set to \"true\". Workloads can opt out with the annotation set to \"false\".")
+	fs.StringVar(&f.DefaultMode, "default-mode", string(DefaultModeOptIn), "Whether workloads without the wave.pusher.com/update-on-config-change annotation are managed: opt-in manages only workloads which opt in, opt-out manages all workloads unless the annotation is set to \"false\"")
+	fs.StringVar(&f.WorkloadSelector, "workload-selector", "", "Label selector which limits the Deployments, StatefulSets and DaemonSets Wave manages and mutates. Defaults to all workloads.")
+	fs.StringVar(&f.ControllerClass, "controller-class", "", "Only manage workloads whose wave.pusher.com/controller-class annotation, or label if there is no annotation, has this value to run multiple Wave installations. The default class manages workloads without either.")
+	fs.StringVar(&f.ExcludeNamespaces, "exclude-namespaces", "", "Comma-separated list of namespaces or patterns like tenant-* in which Wave ignores workloads. Namespaces excluded by name are not cached.")
+	fs.StringVar(&f.NamespaceSelector, "namespace-selector", "", "Label selector for the namespaces in which Wave manages workloads. Namespaces are checked whenever a workload is handled, so new or relabeled namespaces are picked up without a restart.")
+	fs.StringVar(&f.CrossNamespaceReferences, "cross-namespace-references", "", "Semicolon-separated rules like team-a=shared,team-a-* which allow workloads in the source namespace to reference ConfigMaps and Secrets in the target namespaces. Namespaces can be names or patterns. References across namespaces which no rule allows are ignored. Allows all references if empty.")
+	fs.StringVar(&f.UnwatchedReferences, "unwatched-references", string(UnwatchedReferenceReport), "How references to ConfigMaps and Secrets in namespaces outside --namespaces are handled: report ignores them and records Warning events, read reads them directly from the API server")
+	fs.StringVar(&f.Namespaces, "namespaces", "", "Comma-separated list of namespaces to watch. Defaults to all namespaces.")
+}
+
+// HandlerOptions parses the flags into the HandlerOptions they control
+func (f *Flags) HandlerOptions() (HandlerOptions, error) {
+	opts := HandlerOptions{
+		EnableSnapshots:       f.EnableConfigSnapshots,
+		WatchImagePullSecrets: f.WatchImagePullSecrets,
+		NamespaceOptIn:        f.NamespaceOptIn,
+		ControllerClass:       f.ControllerClass,
+	}
+
+	var err error
+	if opts.UnreadableChildrenPolicy, err = ParseUnreadableChildrenPolicy(f.UnreadableChildrenPolicy); err != nil {
+		return opts, fmt.Errorf("invalid --unreadable-children-policy: %v", err)
+	}
+	if opts.DefaultMode, err = ParseDefaultMode(f.DefaultMode); err != nil {
+		return opts, fmt.Errorf("invalid --default-mode: %v", err)
+	}
+	if opts.WorkloadSelector, err = labels.Parse(f.WorkloadSelector); err != nil {
+		return opts, fmt.Errorf("invalid --workload-selector: %v", err)
+	}
+	nsSelector, err := labels.Parse(f.NamespaceSelector)
+	if err != nil {
+		return opts, fmt.Errorf("invalid --namespace-selector: %v", err)
+	}
+	var excluded []string
+	if f.ExcludeNamespaces != "" {
+		excluded = strings.Split(f.ExcludeNamespaces, ",")
+	}
+	if opts.NamespaceFilter, err = NewNamespaceFilter(excluded, nsSelector); err != nil {
+		return opts, fmt.Errorf("invalid --exclude-namespaces: %v", err)
+	}
+	if opts.CrossNamespacePolicy, err = ParseCrossNamespacePolicy(f.CrossNamespaceReferences); err != nil {
+		return opts, fmt.Errorf("invalid --cross-namespace-references: %v", err)
+	}
+	if opts.UnwatchedReferencePolicy, err = ParseUnwatchedReferencePolicy(f.UnwatchedReferences); err != nil {
+		return opts, fmt.Errorf("invalid --unwatched-references: %v", err)
+	}
+	if f.Namespaces != "" {
+		opts.WatchedNamespaces = strings.Split(f.Namespaces, ",")
+	}
+	return opts, nil
+}
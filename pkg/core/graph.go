@@ -0,0 +1,187 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// DependencyGraphPath is the path on which the DependencyGraph is served
+const DependencyGraphPath = "/debug/wave/graph"
+
+// DependencyGraph exposes the children watched by the Handlers of all kinds
+// and the workloads referencing them. It only contains names, never any
+// configuration values.
+type DependencyGraph struct {
+	mutex    sync.Mutex
+	watchers []graphWatchers
+}
+
+// graphWatchers holds the WatcherLists of the Handler of one kind
+type graphWatchers struct {
+	kind       string
+	configMaps WatcherList
+	secrets    WatcherList
+}
+
+// GraphNode is a child or a workload in the DependencyGraph
+type GraphNode struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+}
+
+// String returns the GraphNode in the form kind/namespace/name
+func (n GraphNode) String() string {
+	return fmt.Sprintf("%s/%s/%s", n.Kind, n.Namespace, n.Name)
+}
+
+// GraphEdge is a reference from a workload to a child
+type GraphEdge struct {
+	Child    GraphNode `json:"child"`
+	Workload GraphNode `json:"workload"`
+}
+
+// NewDependencyGraph constructs a new DependencyGraph
+func NewDependencyGraph() *DependencyGraph {
+	return &DependencyGraph{}
+}
+
+// addWatchers adds the WatcherLists of a Handler to the graph
+func (g *DependencyGraph) addWatchers(kind string, configMaps WatcherList, secrets WatcherList) {
+	if g == nil {
+		return
+	}
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.watchers = append(g.watchers, graphWatchers{kind: strings.ToLower(kind), configMaps: configMaps, secrets: secrets})
+}
+
+// Edges returns all edges of the graph sorted by child and workload. If
+// filter is set only the edges from or to that node are returned.
+func (g *DependencyGraph) Edges(filter *GraphNode) []GraphEdge {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	edges := []GraphEdge{}
+	add := func(kind string, childKind string, list WatcherList) {
+		list.watchersMutex.RLock()
+		defer list.watchersMutex.RUnlock()
+		for child, watchers := range list.watchers {
+			for workload := range watchers {
+				edge := GraphEdge{
+					Child:    GraphNode{Kind: childKind, Namespace: child.Namespace, Name: child.Name},
+					Workload: GraphNode{Kind: kind, Namespace: workload.Namespace, Name: workload.Name},
+				}
+				if filter == nil || *filter == edge.Child || *filter == edge.Workload {
+					edges = append(edges, edge)
+				}
+			}
+		}
+	}
+	for _, w := range g.watchers {
+		add(w.kind, configMapKind, w.configMaps)
+		add(w.kind, secretKind, w.secrets)
+	}
+
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].Child != edges[j].Child {
+			return edges[i].Child.String() < edges[j].Child.String()
+		}
+		return edges[i].Workload.String() < edges[j].Workload.String()
+	})
+	return edges
+}
+
+// parseGraphNode parses a node in the form kind/namespace/name. Workload kinds
+// may be abbreviated like in kubectl (e.g. deploy).
+func parseGraphNode(s string) (GraphNode, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) != 3 || parts[1] == "" || parts[2] == "" {
+		return GraphNode{}, fmt.Errorf("invalid reference %q, expected kind/namespace/name", s)
+	}
+	kind := strings.ToLower(parts[0])
+	if kind != configMapKind && kind != secretKind {
+		obj, err := newWorkload(kind)
+		if err != nil {
+			return GraphNode{}, err
+		}
+		kind = strings.ToLower(kindOf(obj.(Object)))
+	}
+	return GraphNode{Kind: kind, Namespace: parts[1], Name: parts[2]}, nil
+}
+
+// writeDOT writes the edges in the Graphviz DOT format
+func writeDOT(w io.Writer, edges []GraphEdge) error {
+	if _, err := fmt.Fprintln(w, "digraph wave {"); err != nil {
+		return err
+	}
+	for _, edge := range edges {
+		if _, err := fmt.Fprintf(w, "  %q -> %q;\n", edge.Child.String(), edge.Workload.String()); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintln(w, "}")
+	return err
+}
+
+// ServeHTTP serves the graph as JSON (default) or as Graphviz DOT
+// (?format=dot). The graph can be limited to a single child or workload with
+// ?node=kind/namespace/name, e.g. ?node=secret/default/db-credentials.
+func (g *DependencyGraph) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var filter *GraphNode
+	if node := r.URL.Query().Get("node"); node != "" {
+		parsed, err := parseGraphNode(node)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		filter = &parsed
+	}
+	edges := g.Edges(filter)
+
+	var err error
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "json":
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(struct {
+			Edges []GraphEdge `json:"edges"`
+		}{Edges: edges})
+	case "dot":
+		w.Header().Set("Content-Type", "text/vnd.graphviz")
+		err = writeDOT(w, edges)
+	default:
+		http.Error(w, fmt.Sprintf("unsupported format %q, expected json or dot", format), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		logf.Log.WithName("wave").Error(err, "Unable to write dependency graph")
+	}
+}
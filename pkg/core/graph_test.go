@@ -0,0 +1,87 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+var _ = Describe("Wave dependency graph Suite", func() {
+	var g *DependencyGraph
+	var deployment = GraphNode{Kind: "deployment", Namespace: "default", Name: "example"}
+	var configMap = GraphNode{Kind: configMapKind, Namespace: "default", Name: "example1"}
+	var secret = GraphNode{Kind: secretKind, Namespace: "default", Name: "example1"}
+
+	get := func(url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		g.ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+		return w
+	}
+
+	BeforeEach(func() {
+		g = NewDependencyGraph()
+		deployments := NewHandler[*appsv1.Deployment](nil, record.NewFakeRecorder(10), HandlerOptions{DependencyGraph: g})
+		statefulSets := NewHandler[*appsv1.StatefulSet](nil, record.NewFakeRecorder(10), HandlerOptions{DependencyGraph: g})
+
+		instance := utils.ExampleDeployment.DeepCopy()
+		configMapsConfig := configMetadataList{{name: GetNamespacedName("example1", "default")}}
+		secretsConfig := configMetadataList{{name: GetNamespacedName("example1", "default")}}
+		deployments.watchChildrenForInstance(instance, configMapsConfig, secretsConfig)
+		statefulSets.watchChildrenForInstance(&appsv1.StatefulSet{ObjectMeta: instance.ObjectMeta}, configMapsConfig, configMetadataList{})
+	})
+
+	It("returns the edges of all kinds", func() {
+		statefulSet := GraphNode{Kind: "statefulset", Namespace: "default", Name: "example"}
+		Expect(g.Edges(nil)).To(Equal([]GraphEdge{
+			{Child: configMap, Workload: deployment},
+			{Child: configMap, Workload: statefulSet},
+			{Child: secret, Workload: deployment},
+		}))
+	})
+
+	It("filters the edges by child or workload", func() {
+		Expect(g.Edges(&secret)).To(Equal([]GraphEdge{{Child: secret, Workload: deployment}}))
+		Expect(g.Edges(&deployment)).To(HaveLen(2))
+	})
+
+	It("serves the graph as JSON", func() {
+		w := get("/debug/wave/graph?node=deploy/default/example")
+		Expect(w.Code).To(Equal(http.StatusOK))
+		Expect(w.Body.String()).To(MatchJSON(`{"edges": [
+			{"child": {"kind": "configmap", "namespace": "default", "name": "example1"}, "workload": {"kind": "deployment", "namespace": "default", "name": "example"}},
+			{"child": {"kind": "secret", "namespace": "default", "name": "example1"}, "workload": {"kind": "deployment", "namespace": "default", "name": "example"}}
+		]}`))
+	})
+
+	It("serves the graph as DOT", func() {
+		w := get("/debug/wave/graph?format=dot&node=secret/default/example1")
+		Expect(w.Code).To(Equal(http.StatusOK))
+		Expect(w.Body.String()).To(Equal("digraph wave {\n  \"secret/default/example1\" -> \"deployment/default/example\";\n}\n"))
+	})
+
+	It("rejects invalid queries", func() {
+		Expect(get("/debug/wave/graph?node=job/default/example").Code).To(Equal(http.StatusBadRequest))
+		Expect(get("/debug/wave/graph?format=yaml").Code).To(Equal(http.StatusBadRequest))
+	})
+})
@@ -19,11 +19,13 @@ package core
 import (
 	"context"
 	"fmt"
+	"strings"
 	"sync"
+	"time"
 
-	"golang.org/x/time/rate"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -34,30 +36,238 @@ import (
 // Handler performs the main business logic of the Wave controller
 type Handler[I InstanceType] struct {
 	client.Client
-	recorder          record.EventRecorder
-	watchedConfigmaps WatcherList
-	watchedSecrets    WatcherList
-	updateThrottler   *UpdateThrottler
+	kind                string
+	recorder            record.EventRecorder
+	watchedConfigmaps   WatcherList
+	watchedSecrets      WatcherList
+	updateThrottler     *UpdateThrottler
+	blastRadiusBreaker  *BlastRadiusBreaker
+	rolloutAfter        *rolloutAfterTracker
+	ignoredReferences   *ignoredReferencesTracker
+	ignoredUpstreams    *ignoredReferencesTracker
+	reportedDeletions   *ignoredReferencesTracker
+	rolloutAfterTimeout time.Duration
+	rolloutHealth       *rolloutHealthTracker
+	enableSnapshots     bool
+	apiReader           client.Reader
+	namespaceReader     client.Reader
+	missingChildren     *workloadSet
+	unreadableChildren  *workloadSet
+	dryRun              bool
+	validationMode      ValidationMode
+	watchedNamespaces   map[string]bool
+	schedulingGates     bool
+	stripHashOnOptOut   bool
+
+	defaultMissingChildrenPolicy MissingChildrenPolicy
+	schedulingTimeout            time.Duration
+	schedulingTimeoutAction      SchedulingTimeoutAction
+	schedulingTimedOut           *workloadSet
+	defaultChildDeletionPolicy   ChildDeletionPolicy
+	childDeletionGracePeriod     time.Duration
+	namespaceOptIn               bool
+	defaultMode                  DefaultMode
+	workloadSelector             labels.Selector
+	controllerClass              string
+	namespaceFilter              *NamespaceFilter
+	crossNamespacePolicy         *CrossNamespacePolicy
+	unwatchedReferencePolicy     UnwatchedReferencePolicy
+
+	defaultUnreadableChildrenPolicy UnreadableChildrenPolicy
+	watchImagePullSecrets           bool
+	serviceAccountReader            client.Reader
+	// upstreams hashes the workloads in rollout-after annotations like
+	// their own Handlers do
+	upstreams *Inspector
+}
+
+// HandlerOptions holds the state and settings which are shared between the
+// Handlers of all kinds
+type HandlerOptions struct {
+	// UpdateThrottler limits the rate of updates globally
+	UpdateThrottler *UpdateThrottler
+	// BlastRadiusBreaker pauses rollouts of shared configuration changes.
+	// It is disabled if nil.
+	BlastRadiusBreaker *BlastRadiusBreaker
+	// RolloutAfterTimeout is the maximum time to wait for upstream workloads
+	// (default DefaultRolloutAfterTimeout)
+	RolloutAfterTimeout time.Duration
+	// RolloutStallTimeout is the time after which a rollout whose ready
+	// replicas do not improve is considered stalled (default DefaultRolloutStallTimeout)
+	RolloutStallTimeout time.Duration
+	// EnableSnapshots allows workloads to opt into immutable snapshots of
+	// their children
+	EnableSnapshots bool
+	// DependencyGraph exposes the watched children of all kinds.
+	// It is disabled if nil.
+	DependencyGraph *DependencyGraph
+	// APIReader reads ReplicaSets and ControllerRevisions when collecting
+	// unreferenced snapshots without caching them (defaults to the client)
+	APIReader client.Reader
+	// DryRun reports the changes the controller and the webhooks would make
+	// without updating any object
+	DryRun bool
+	// ValidationMode controls how the validating webhook treats malformed
+	// Wave annotations (default ValidationModeWarn)
+	ValidationMode ValidationMode
+	// WatchedNamespaces are the namespaces Wave caches (default all namespaces)
+	WatchedNamespaces []string
+	// DependencyProtector checks changes of children against the required
+	// references of workloads. It is disabled if nil.
+	DependencyProtector *DependencyProtector
+	// UseSchedulingGates disables scheduling with a scheduling gate instead
+	// of an invalid scheduler
+	UseSchedulingGates bool
+	// StripHashOnOptOut removes the config hash from workloads which opt out
+	// of Wave if their pod template changes anyway to restore scheduling
+	StripHashOnOptOut bool
+	// MissingChildrenPolicy controls how the webhook handles updates which
+	// add required references to missing children (default MissingChildrenProceed)
+	MissingChildrenPolicy MissingChildrenPolicy
+	// SchedulingTimeout is the time after which Wave escalates for workloads
+	// whose scheduling is disabled because of missing children. It is
+	// disabled if zero.
+	SchedulingTimeout time.Duration
+	// SchedulingTimeoutAction is applied after the SchedulingTimeout
+	// (default SchedulingTimeoutWarn)
+	SchedulingTimeoutAction SchedulingTimeoutAction
+	// ChildDeletionPolicy controls how the deletion of a referenced child is
+	// handled (default ChildDeletionRoll)
+	ChildDeletionPolicy ChildDeletionPolicy
+	// ChildDeletionGracePeriod is the time Wave waits for a deleted child to
+	// be recreated before it applies the ChildDeletionPolicy
+	ChildDeletionGracePeriod time.Duration
+	// NamespaceOptIn enables Wave for all workloads in namespaces with the
+	// required annotation as a label or annotation
+	NamespaceOptIn bool
+	// DefaultMode controls whether workloads without the required annotation
+	// are managed (default DefaultModeOptIn)
+	DefaultMode DefaultMode
+	// WorkloadSelector limits the workloads Wave considers. All workloads
+	// are considered if nil.
+	WorkloadSelector labels.Selector
+	// ControllerClass selects the workloads of this Wave installation by
+	// their controller class annotation. The default class owns workloads
+	// without the annotation.
+	ControllerClass string
+	// NamespaceFilter excludes and selects the namespaces Wave manages
+	// workloads in. All namespaces are managed if nil.
+	NamespaceFilter *NamespaceFilter
+	// CrossNamespacePolicy restricts which namespaces workloads may
+	// reference children in. All references are allowed if nil.
+	CrossNamespacePolicy *CrossNamespacePolicy
+	// UnwatchedReferencePolicy controls how references to children in
+	// namespaces which are not cached are handled (default UnwatchedReferenceReport)
+	UnwatchedReferencePolicy UnwatchedReferencePolicy
+	// UnreadableChildrenPolicy controls how workloads referencing children
+	// which cannot be read are handled (default UnreadableChildrenBlock)
+	UnreadableChildrenPolicy UnreadableChildrenPolicy
+	// WatchImagePullSecrets treats the image pull Secrets of the pods and
+	// their ServiceAccount as children of workloads which opt in
+	WatchImagePullSecrets bool
 }
 
 // NewHandler constructs a new instance of Handler
-func NewHandler[I InstanceType](c client.Client, r record.EventRecorder, updateRate float64, updateBurst int) *Handler[I] {
-	return &Handler[I]{Client: c, recorder: r,
+func NewHandler[I InstanceType](c client.Client, r record.EventRecorder, opts HandlerOptions) *Handler[I] {
+	h := newHandler[I](c, r, opts)
+	h.upstreams = newInspector(c, opts)
+	h.blastRadiusBreaker.addWatchers(h.watchedConfigmaps, h.watchedSecrets)
+	opts.DependencyGraph.addWatchers(h.kind, h.watchedConfigmaps, h.watchedSecrets)
+	opts.DependencyProtector.addHandler(h)
+	return h
+}
+
+// newHandler constructs a Handler without registering it with the state
+// shared between Handlers
+func newHandler[I InstanceType](c client.Client, r record.EventRecorder, opts HandlerOptions) *Handler[I] {
+	var instance I
+	kind := kindOf(instance)
+	h := &Handler[I]{Client: c, kind: kind, recorder: r,
 		watchedConfigmaps: WatcherList{
 			watchers:      make(map[types.NamespacedName]map[types.NamespacedName]bool),
 			watchersMutex: &sync.RWMutex{},
+			lastChanged:   make(map[types.NamespacedName]time.Time),
 		},
 		watchedSecrets: WatcherList{
 			watchers:      make(map[types.NamespacedName]map[types.NamespacedName]bool),
 			watchersMutex: &sync.RWMutex{},
+			lastChanged:   make(map[types.NamespacedName]time.Time),
+		},
+		updateThrottler:    opts.UpdateThrottler,
+		blastRadiusBreaker: opts.BlastRadiusBreaker,
+		ignoredReferences:  newIgnoredReferencesTracker(),
+		ignoredUpstreams:   newIgnoredReferencesTracker(),
+		reportedDeletions:  newIgnoredReferencesTracker(),
+		rolloutAfter: &rolloutAfterTracker{
+			waitingSince: make(map[types.NamespacedName]time.Time),
 		},
-		updateThrottler: NewUpdateThrottler(rate.Limit(updateRate), updateBurst),
+		rolloutAfterTimeout: opts.RolloutAfterTimeout,
+		rolloutHealth:       newRolloutHealthTracker(opts.RolloutStallTimeout),
+		enableSnapshots:     opts.EnableSnapshots,
+		apiReader:           opts.APIReader,
+		missingChildren:     newWorkloadSet(workloadsMissingChildren.WithLabelValues(kind)),
+		unreadableChildren:  newWorkloadSet(workloadsUnreadableChildren.WithLabelValues(kind)),
+		dryRun:              opts.DryRun,
+		validationMode:      opts.ValidationMode,
+		schedulingGates:     opts.UseSchedulingGates,
+		stripHashOnOptOut:   opts.StripHashOnOptOut,
+
+		defaultMissingChildrenPolicy: opts.MissingChildrenPolicy,
+		schedulingTimeout:            opts.SchedulingTimeout,
+		schedulingTimeoutAction:      opts.SchedulingTimeoutAction,
+		schedulingTimedOut:           newWorkloadSet(workloadsSchedulingTimedOut.WithLabelValues(kind)),
+		defaultChildDeletionPolicy:   opts.ChildDeletionPolicy,
+		childDeletionGracePeriod:     opts.ChildDeletionGracePeriod,
+		namespaceOptIn:               opts.NamespaceOptIn,
+		defaultMode:                  opts.DefaultMode,
+		workloadSelector:             opts.WorkloadSelector,
+		controllerClass:              opts.ControllerClass,
+		namespaceFilter:              opts.NamespaceFilter,
+		crossNamespacePolicy:         opts.CrossNamespacePolicy,
+		unwatchedReferencePolicy:     opts.UnwatchedReferencePolicy,
+
+		defaultUnreadableChildrenPolicy: opts.UnreadableChildrenPolicy,
+		watchImagePullSecrets:           opts.WatchImagePullSecrets,
+	}
+	if h.rolloutAfterTimeout <= 0 {
+		h.rolloutAfterTimeout = DefaultRolloutAfterTimeout
+	}
+	if h.apiReader == nil {
+		h.apiReader = c
+	}
+	h.namespaceReader = c
+	h.serviceAccountReader = c
+	if h.validationMode == "" {
+		h.validationMode = ValidationModeWarn
+	}
+	if h.defaultChildDeletionPolicy == "" {
+		h.defaultChildDeletionPolicy = ChildDeletionRoll
+	}
+	if h.defaultUnreadableChildrenPolicy == "" {
+		h.defaultUnreadableChildrenPolicy = UnreadableChildrenBlock
+	}
+	if h.unwatchedReferencePolicy == "" {
+		h.unwatchedReferencePolicy = UnwatchedReferenceReport
+	}
+	if h.defaultMissingChildrenPolicy == "" {
+		h.defaultMissingChildrenPolicy = MissingChildrenProceed
 	}
+	if len(opts.WatchedNamespaces) > 0 {
+		h.watchedNamespaces = make(map[string]bool)
+		for _, namespace := range opts.WatchedNamespaces {
+			h.watchedNamespaces[namespace] = true
+		}
+	}
+	return h
 }
 
-// HandleWebhook is called by the webhook
-func (h *Handler[I]) HandleWebhook(instance I, dryRun *bool, isCreate bool) error {
-	return h.updatePodController(instance, (dryRun != nil && *dryRun), isCreate)
+// HandleWebhook is called by the webhook. oldInstance is the object before
+// the update and only used if isCreate is false.
+func (h *Handler[I]) HandleWebhook(instance I, oldInstance I, dryRun *bool, isCreate bool) error {
+	if h.dryRun {
+		return h.reportWebhookDryRun(instance, oldInstance, (dryRun != nil && *dryRun), isCreate)
+	}
+	return h.updatePodController(instance, oldInstance, (dryRun != nil && *dryRun), isCreate)
 }
 
 // Handle is called by the controller to reconcile its object
@@ -66,6 +276,13 @@ func (h *Handler[I]) Handle(ctx context.Context, namespacesName types.Namespaced
 	if err != nil {
 		if errors.IsNotFound(err) {
 			h.RemoveWatches(namespacesName)
+			h.rolloutAfter.done(namespacesName)
+			h.rolloutHealth.forget(namespacesName)
+			h.ignoredReferences.forget(namespacesName)
+			h.ignoredUpstreams.forget(namespacesName)
+			h.reportedDeletions.forget(namespacesName)
+			h.missingChildren.set(namespacesName, false)
+			h.unreadableChildren.set(namespacesName, false)
 			// Object not found, return.  Created objects are automatically garbage collected.
 			return reconcile.Result{}, nil
 		}
@@ -80,46 +297,161 @@ func (h *Handler[I]) Handle(ctx context.Context, namespacesName types.Namespaced
 func (h *Handler[I]) handlePodController(ctx context.Context, instance I) (reconcile.Result, error) {
 	log := logf.Log.WithName("wave").WithValues("namespace", instance.GetNamespace(), "name", instance.GetName())
 
+	// Leave workloads of other Wave installations alone but clean up after
+	// workloads this installation no longer owns
+	if !h.ownsInstance(instance) {
+		h.removeWatchesForInstance(instance)
+		h.missingChildren.set(GetNamespacedNameFromObject(instance), false)
+		h.unreadableChildren.set(GetNamespacedNameFromObject(instance), false)
+		h.schedulingTimedOut.set(GetNamespacedNameFromObject(instance), false)
+		h.ignoredReferences.forget(GetNamespacedNameFromObject(instance))
+		h.ignoredUpstreams.forget(GetNamespacedNameFromObject(instance))
+		h.reportedDeletions.forget(GetNamespacedNameFromObject(instance))
+		reconcilesSkippedTotal.WithLabelValues(h.kind, skipReasonNotOwned).Inc()
+		if h.releasesInstance(instance) {
+			return h.optOut(ctx, instance)
+		}
+		return reconcile.Result{}, nil
+	}
+
 	// To cleanup legacy ownerReferences and finalizer
 	if hasFinalizer(instance) {
-		log.V(0).Info("Removing old finalizer")
-		return h.deleteOwnerReferencesAndFinalizer(instance)
+		if h.dryRun {
+			log.V(0).Info("Would remove old finalizer", "dryRun", true)
+		} else {
+			log.V(0).Info("Removing old finalizer")
+			return h.deleteOwnerReferencesAndFinalizer(instance)
+		}
 	}
 
-	// If the required annotation isn't present, ignore the instance
-	if !hasRequiredAnnotation(instance) {
+	// If the required annotation isn't present, clean up after Wave and
+	// ignore the instance
+	if !h.isEnabled(instance) {
 		h.removeWatchesForInstance(instance)
-		return reconcile.Result{}, nil
+		h.missingChildren.set(GetNamespacedNameFromObject(instance), false)
+		h.unreadableChildren.set(GetNamespacedNameFromObject(instance), false)
+		h.schedulingTimedOut.set(GetNamespacedNameFromObject(instance), false)
+		h.ignoredReferences.forget(GetNamespacedNameFromObject(instance))
+		h.ignoredUpstreams.forget(GetNamespacedNameFromObject(instance))
+		h.reportedDeletions.forget(GetNamespacedNameFromObject(instance))
+		reconcilesSkippedTotal.WithLabelValues(h.kind, skipReasonNotEnabled).Inc()
+		return h.optOut(ctx, instance)
 	}
 
 	log.V(5).Info("Reconciling")
 
 	// Get all children and add watches
-	configMapsConfig, secretsConfig := getChildNamesByType(instance)
+	source := h.sourceInstance(instance)
+	configMapsConfig, secretsConfig, ignored := h.referencedChildren(instance)
 	h.watchChildrenForInstance(instance, configMapsConfig, secretsConfig)
+	// Only report the ignored references when they change instead of on
+	// every reconcile
+	if h.ignoredReferences.changed(GetNamespacedNameFromObject(instance), ignored) {
+		log.V(1).Info("Ignoring references", "references", ignored)
+		h.recorder.Eventf(instance, corev1.EventTypeWarning, "ReferencesIgnored", "Ignored references: %s", strings.Join(ignored, ", "))
+	}
 
 	// Get content of children
-	configMaps, secrets, err := h.getCurrentChildren(configMapsConfig, secretsConfig)
-	if err != nil {
-		return reconcile.Result{}, fmt.Errorf("error fetching current children: %v", err)
+	configMaps, secrets, unreadable := h.getReadableChildren(configMapsConfig, secretsConfig)
+	h.unreadableChildren.set(GetNamespacedNameFromObject(instance), len(unreadable) > 0)
+	unreadableChange := setUnreadableChildrenStatus(instance, unreadable)
+	if len(unreadable) > 0 {
+		h.reportUnreadableChildren(instance, unreadable)
+		if h.unreadableChildrenPolicy(instance) != UnreadableChildrenHashReadable {
+			reconcilesSkippedTotal.WithLabelValues(h.kind, skipReasonUnreadableChildren).Inc()
+			if unreadableChange && !h.dryRun {
+				if err := h.Update(ctx, instance); err != nil {
+					return reconcile.Result{}, fmt.Errorf("error updating instance %s/%s: %v", instance.GetNamespace(), instance.GetName(), err)
+				}
+			}
+			return reconcile.Result{}, fmt.Errorf("error fetching current children: %s", describeUnreadableChildren(unreadable))
+		}
+		configMapsConfig, secretsConfig = withoutUnreadableChildren(configMapsConfig, secretsConfig, unreadable)
 	}
 
-	err = h.checkRequiredChildren(configMaps, secrets, configMapsConfig, secretsConfig)
-	if err != nil {
-		// We are missing children but we added watchers for all children so we are done
+	missing := missingRequiredChildren(configMaps, secrets, configMapsConfig, secretsConfig)
+	h.missingChildren.set(GetNamespacedNameFromObject(instance), len(missing) > 0)
+
+	// Without a record of the children, e.g. after a restart of Wave, the
+	// current children are the baseline for deletions
+	if _, ok := h.rolloutHealth.recordedFingerprints(GetNamespacedNameFromObject(instance)); !ok {
+		h.rolloutHealth.setFingerprints(GetNamespacedNameFromObject(instance), childFingerprints(configMaps, secrets, configMapsConfig, secretsConfig))
+	}
+
+	// Keep the current hash while deleted children may be recreated or if
+	// the workload does not roll on deletions
+	deleted, requeueAfter := h.heldDeletions(instance, configMaps, secrets, configMapsConfig, secretsConfig)
+	if len(deleted) > 0 {
+		reconcilesSkippedTotal.WithLabelValues(h.kind, skipReasonChildDeleted).Inc()
+		if requeueAfter > 0 {
+			log.V(1).Info("Waiting for deleted children to be recreated", "children", deleted)
+			return reconcile.Result{RequeueAfter: requeueAfter}, nil
+		}
+		// Only report the deleted children when they change instead of on
+		// every reconcile
+		if h.childDeletionPolicy(instance) == ChildDeletionFreeze && h.reportedDeletions.changed(GetNamespacedNameFromObject(instance), deleted) {
+			log.V(0).Info("Keeping configuration hash since children were deleted", "children", deleted)
+			h.recorder.Eventf(instance, corev1.EventTypeWarning, "ChildDeleted", "Kept configuration hash since children were deleted: %s", strings.Join(deleted, ", "))
+		}
 		return reconcile.Result{}, nil
 	}
+	h.reportedDeletions.forget(GetNamespacedNameFromObject(instance))
+
+	if len(missing) > 0 {
+		// We are missing children but we added watchers for all children so
+		// we are done unless scheduling has been disabled for too long
+		reconcilesSkippedTotal.WithLabelValues(h.kind, skipReasonMissingChildren).Inc()
+		return h.checkSchedulingTimeout(ctx, instance, missing)
+	}
+	h.schedulingTimedOut.set(GetNamespacedNameFromObject(instance), false)
+	statusChange := clearMissingChildrenStatus(instance) || unreadableChange
 
 	hash, err := calculateConfigHash(configMaps, secrets, configMapsConfig, secretsConfig)
 	if err != nil {
 		return reconcile.Result{}, fmt.Errorf("error calculating configuration hash: %v", err)
 	}
 
+	// Pause the rollout if a shared child changed which affects too many workloads
+	oldHash := h.currentHash(instance)
+	h.blastRadiusBreaker.observe(ctx, configMaps, secrets, configMapsConfig, secretsConfig)
+	if hash != oldHash && oldHash != "" {
+		if blockedBy := h.blastRadiusBreaker.blockedBy(instance, configMaps, secrets, configMapsConfig, secretsConfig); len(blockedBy) > 0 {
+			reconcilesSkippedTotal.WithLabelValues(h.kind, skipReasonBlastRadius).Inc()
+			return h.pauseRollout(ctx, instance, blockedBy)
+		}
+
+		// Wait for upstream workloads to complete their rollout first
+		delay, err := h.delayForRolloutAfter(ctx, instance, configMapsConfig, secretsConfig)
+		if err != nil {
+			return reconcile.Result{}, fmt.Errorf("error checking upstream workloads: %v", err)
+		}
+		if delay {
+			reconcilesSkippedTotal.WithLabelValues(h.kind, skipReasonRolloutAfter).Inc()
+			return reconcile.Result{RequeueAfter: rolloutAfterRequeueInterval}, nil
+		}
+	} else {
+		// The change was reverted or never needed a rollout
+		h.rolloutAfter.done(GetNamespacedNameFromObject(instance))
+	}
+	pendingChange := clearBlastRadiusPending(instance)
+
 	// Update the desired state of the Deployment in a DeepCopy
-	oldHash := getConfigHash(instance)
-	setConfigHash(instance, hash)
+	snapshotChange := false
+	if h.snapshotsEnabled(instance) {
+		if hash != oldHash || referencesLiveChildren(instance, configMaps, secrets) {
+			if err := h.applySnapshots(ctx, instance, source, configMaps, secrets, hash, !h.dryRun); err != nil {
+				return reconcile.Result{}, err
+			}
+			snapshotChange = true
+		}
+	} else {
+		// Mount the children again if the instance stopped using snapshots
+		snapshotChange = restoreSnapshotSources(instance)
+		setConfigHash(instance, hash)
+	}
 
 	schedulingChange := false
+	gated := hasSchedulingGate(&GetPodTemplate(instance).Spec)
 	if isSchedulingDisabled(instance) {
 		log.V(0).Info("Enabled scheduling since all children became available.")
 		h.recorder.Eventf(instance, corev1.EventTypeNormal, "SchedulingEnabled", "Enabled scheduling since all children became available.")
@@ -127,15 +459,31 @@ func (h *Handler[I]) handlePodController(ctx context.Context, instance I) (recon
 		schedulingChange = true
 	}
 
-	// If the desired state doesn't match the existing state, update it
-	if hash != oldHash || schedulingChange {
-		instanceName := GetNamespacedNameFromObject(instance)
+	instanceName := GetNamespacedNameFromObject(instance)
+	fingerprints := childFingerprints(configMaps, secrets, configMapsConfig, secretsConfig)
+	changed := h.rolloutHealth.changedChildren(instanceName, fingerprints)
+	if hash != oldHash && oldHash != "" {
+		// Follow the rollout caused by the configuration change
+		startRolloutTracking(instance, changed)
+	}
 
+	// If the desired state doesn't match the existing state, update it
+	if hash != oldHash || schedulingChange || pendingChange || snapshotChange || statusChange {
 		// Wait for rate limiter (stalls the pipeline until allowed)
 		if err := h.updateThrottler.Wait(ctx, instanceName); err != nil {
 			return reconcile.Result{}, fmt.Errorf("error waiting for rate limit: %v", err)
 		}
 
+		if h.dryRun {
+			// Keep the first fingerprints seen as the baseline so the report
+			// names all children changed since then
+			if changed == nil {
+				h.rolloutHealth.setFingerprints(instanceName, fingerprints)
+			}
+			h.reportDryRun(instance, oldHash, hash, changed, schedulingChange)
+			return reconcile.Result{}, nil
+		}
+
 		log.V(0).Info("Updating instance hash", "hash", hash)
 		h.recorder.Eventf(instance, corev1.EventTypeNormal, "ConfigChanged", "Configuration hash updated to %s", hash)
 
@@ -143,38 +491,102 @@ func (h *Handler[I]) handlePodController(ctx context.Context, instance I) (recon
 		if err != nil {
 			return reconcile.Result{}, fmt.Errorf("error updating instance %s/%s: %v", instance.GetNamespace(), instance.GetName(), err)
 		}
+		h.rolloutHealth.setFingerprints(instanceName, fingerprints)
+		if schedulingChange && gated {
+			if err := h.clearSchedulingGates(ctx, instance); err != nil {
+				log.Error(err, "Unable to remove scheduling gates from pending pods")
+			}
+		}
+		if hash != oldHash {
+			h.observeHashChange(instance, oldHash, configMapsConfig, secretsConfig)
+		}
+		if snapshotChange {
+			if err := h.collectSnapshots(ctx, instance.GetNamespace()); err != nil {
+				log.Error(err, "Unable to collect unreferenced snapshots")
+			}
+		}
+		if hash != oldHash && oldHash != "" {
+			return reconcile.Result{RequeueAfter: h.rolloutHealth.start(instanceName)}, nil
+		}
+		return reconcile.Result{}, nil
+	}
+
+	h.rolloutHealth.setFingerprints(instanceName, fingerprints)
+	reconcilesSkippedTotal.WithLabelValues(h.kind, skipReasonUnchanged).Inc()
+	return h.trackRollout(ctx, instance)
+}
+
+// observeHashChange records the metrics of an update of the configuration hash
+func (h *Handler[I]) observeHashChange(instance I, oldHash string, configMapsConfig configMetadataList, secretsConfig configMetadataList) {
+	hashChangesTotal.WithLabelValues(h.kind, instance.GetNamespace()).Inc()
+	if oldHash == "" {
+		return
+	}
+	if changed, ok := h.lastChildChange(configMapsConfig, secretsConfig); ok {
+		configChangeLatencySeconds.WithLabelValues(h.kind).Observe(time.Since(changed).Seconds())
+	}
+}
+
+// pauseRollout marks the instance as pending without updating its hash
+func (h *Handler[I]) pauseRollout(ctx context.Context, instance I, blockedBy []string) (reconcile.Result, error) {
+	if !setBlastRadiusPending(instance, blockedBy) {
+		return reconcile.Result{}, nil
+	}
+
+	log := logf.Log.WithName("wave").WithValues("namespace", instance.GetNamespace(), "name", instance.GetName())
+	if h.dryRun {
+		log.V(0).Info("Would pause rollout due to blast radius limit", "children", blockedBy, "dryRun", true)
+		h.recorder.Eventf(instance, corev1.EventTypeWarning, "DryRunRolloutPaused", "Would pause rollout because changes to %s exceed the blast radius limit", strings.Join(blockedBy, ", "))
+		return reconcile.Result{}, nil
+	}
+	log.V(0).Info("Pausing rollout due to blast radius limit", "children", blockedBy)
+	h.recorder.Eventf(instance, corev1.EventTypeWarning, "RolloutPaused", "Paused rollout because changes to %s exceed the blast radius limit", strings.Join(blockedBy, ", "))
+
+	err := h.Update(ctx, instance)
+	if err != nil {
+		return reconcile.Result{}, fmt.Errorf("error updating instance %s/%s: %v", instance.GetNamespace(), instance.GetName(), err)
 	}
 	return reconcile.Result{}, nil
 }
 
 // handlePodController will only update the hash. Everything else is left to the reconciler.
-func (h *Handler[I]) updatePodController(instance I, dryRun bool, isCreate bool) error {
+func (h *Handler[I]) updatePodController(instance I, oldInstance I, dryRun bool, isCreate bool) error {
 	log := logf.Log.WithName("wave").WithValues("namespace", instance.GetNamespace(), "name", instance.GetName(), "dryRun", dryRun, "isCreate", isCreate)
 	log.V(5).Info("Running webhook")
 
 	// If the required annotation isn't present, ignore the instance
-	if !hasRequiredAnnotation(instance) {
+	if !h.isEnabled(instance) {
 		return nil
 	}
 
 	// Get all children that the instance currently references
-	configMapsConfig, secretsConfig := getChildNamesByType(instance)
-	configMaps, secrets, err := h.getCurrentChildren(configMapsConfig, secretsConfig)
-	if err != nil {
-		return fmt.Errorf("error fetching current children: %v", err)
+	source := h.sourceInstance(instance)
+	configMapsConfig, secretsConfig, _ := h.referencedChildren(instance)
+	configMaps, secrets, unreadable := h.getReadableChildren(configMapsConfig, secretsConfig)
+	setUnreadableChildrenStatus(instance, unreadable)
+	if len(unreadable) > 0 {
+		if h.unreadableChildrenPolicy(instance) != UnreadableChildrenHashReadable {
+			log.V(0).Info("Unable to read children. Skipping mutation!", "children", describeUnreadableChildren(unreadable))
+			return nil
+		}
+		configMapsConfig, secretsConfig = withoutUnreadableChildren(configMapsConfig, secretsConfig, unreadable)
 	}
 
-	err = h.checkRequiredChildren(configMaps, secrets, configMapsConfig, secretsConfig)
+	err := h.checkRequiredChildren(configMaps, secrets, configMapsConfig, secretsConfig)
 	if err != nil {
 		if isCreate {
 			if !dryRun {
 				log.V(0).Info("Not all required children found yet. Disabling scheduling!", "err", err)
 				h.recorder.Eventf(instance, corev1.EventTypeNormal, "SchedulingDisabled", "Disabled scheduling due to missing children: %s", err)
 			}
-			disableScheduling(instance)
-		} else {
-			log.V(0).Info("Not all required children found yet. Skipping mutation!", "err", err)
+			h.blockScheduling(instance)
+			return nil
 		}
+		return h.handleMissingChildrenOnUpdate(instance, oldInstance, dryRun)
+	}
+
+	if deleted, _ := h.heldDeletions(instance, configMaps, secrets, configMapsConfig, secretsConfig); len(deleted) > 0 {
+		log.V(0).Info("Children were deleted. Skipping mutation!", "children", deleted)
 		return nil
 	}
 
@@ -183,13 +595,50 @@ func (h *Handler[I]) updatePodController(instance I, dryRun bool, isCreate bool)
 		return fmt.Errorf("error calculating configuration hash: %v", err)
 	}
 
+	// Keep the current hash if the rollout is paused by the blast radius limit
+	// or has to wait for upstream workloads
+	oldHash := h.currentHash(instance)
+	if hash != oldHash && oldHash != "" {
+		if blockedBy := h.blastRadiusBreaker.blockedBy(instance, configMaps, secrets, configMapsConfig, secretsConfig); len(blockedBy) > 0 {
+			log.V(0).Info("Rollout paused due to blast radius limit. Skipping mutation!", "children", blockedBy)
+			setBlastRadiusPending(instance, blockedBy)
+			return nil
+		}
+
+		reason, err := h.pendingUpstream(context.TODO(), instance, configMapsConfig, secretsConfig)
+		if err != nil {
+			return fmt.Errorf("error checking upstream workloads: %v", err)
+		}
+		if reason != "" {
+			log.V(0).Info("Upstream workloads are pending. Skipping mutation!", "reason", reason)
+			return nil
+		}
+	}
+	clearBlastRadiusPending(instance)
+	clearMissingChildrenStatus(instance)
+
 	// Update the desired state of the Deployment
-	oldHash := getConfigHash(instance)
-	setConfigHash(instance, hash)
+	if h.snapshotsEnabled(instance) {
+		if hash != oldHash || referencesLiveChildren(instance, configMaps, secrets) {
+			if err := h.applySnapshots(context.TODO(), instance, source, configMaps, secrets, hash, !dryRun); err != nil {
+				return err
+			}
+		}
+	} else {
+		restoreSnapshotSources(instance)
+		setConfigHash(instance, hash)
+	}
+
+	if oldHash != hash && oldHash != "" {
+		// Follow the rollout caused by the configuration change
+		fingerprints := childFingerprints(configMaps, secrets, configMapsConfig, secretsConfig)
+		startRolloutTracking(instance, h.rolloutHealth.changedChildren(GetNamespacedNameFromObject(instance), fingerprints))
+	}
 
 	if !dryRun && oldHash != hash {
 		log.V(0).Info("Updating instance hash", "hash", hash)
 		h.recorder.Eventf(instance, corev1.EventTypeNormal, "ConfigChanged", "Configuration hash updated to %s", hash)
+		h.observeHashChange(instance, oldHash, configMapsConfig, secretsConfig)
 	}
 
 	return nil
@@ -0,0 +1,120 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// defaultServiceAccountName is the ServiceAccount of pods which do not set one
+const defaultServiceAccountName = "default"
+
+// hasImagePullSecretsAnnotation returns true if the workload opts into
+// treating its image pull Secrets as children
+func hasImagePullSecretsAnnotation(obj client.Object) bool {
+	return obj.GetAnnotations()[ImagePullSecretsAnnotation] == requiredAnnotationValue
+}
+
+// serviceAccountName returns the name of the ServiceAccount of the pods
+func serviceAccountName(template *corev1.PodTemplateSpec) string {
+	if template.Spec.ServiceAccountName != "" {
+		return template.Spec.ServiceAccountName
+	}
+	return defaultServiceAccountName
+}
+
+// imagePullSecrets returns the image pull Secrets of the pod template and of
+// its ServiceAccount if image pull Secrets are watched and the instance opts
+// in. The Secrets are optional since pods start without them as long as the
+// image is cached. A ServiceAccount which cannot be read is returned as an
+// ignored reference.
+func (h *Handler[I]) imagePullSecrets(instance I) (configMetadataList, []string) {
+	if !h.watchImagePullSecrets || !hasImagePullSecretsAnnotation(instance) {
+		return nil, nil
+	}
+
+	template := GetPodTemplate(h.sourceInstance(instance))
+	secrets := configMetadataList{}
+	for _, ref := range template.Spec.ImagePullSecrets {
+		secrets = append(secrets, configMetadata{required: false, allKeys: true, name: GetNamespacedName(ref.Name, instance.GetNamespace())})
+	}
+
+	serviceAccount := &corev1.ServiceAccount{}
+	name := GetNamespacedName(serviceAccountName(template), instance.GetNamespace())
+	if err := h.serviceAccountReader.Get(context.TODO(), name, serviceAccount); err != nil {
+		if errors.IsNotFound(err) {
+			return secrets, nil
+		}
+		return secrets, []string{fmt.Sprintf("serviceaccount %s could not be read: %v", name, err)}
+	}
+	for _, ref := range serviceAccount.ImagePullSecrets {
+		secrets = append(secrets, configMetadata{required: false, allKeys: true, name: GetNamespacedName(ref.Name, instance.GetNamespace())})
+	}
+	return secrets, nil
+}
+
+// serviceAccountChanged only passes changes of the image pull Secrets of
+// ServiceAccounts
+func serviceAccountChanged() predicate.Funcs {
+	return predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			old, okOld := e.ObjectOld.(*corev1.ServiceAccount)
+			updated, okNew := e.ObjectNew.(*corev1.ServiceAccount)
+			return !okOld || !okNew || !reflect.DeepEqual(old.ImagePullSecrets, updated.ImagePullSecrets)
+		},
+	}
+}
+
+// requestsForServiceAccount returns a reconcile.Request for every workload of
+// the Handler's kind which runs as the ServiceAccount and watches its image
+// pull Secrets
+func (h *Handler[I]) requestsForServiceAccount(ctx context.Context, serviceAccount client.Object) []reconcile.Request {
+	list, err := newWorkloadList(h.kind)
+	if err != nil {
+		return nil
+	}
+	if err := h.List(ctx, list, client.InNamespace(serviceAccount.GetNamespace())); err != nil {
+		logf.Log.WithName("wave").Error(err, "Unable to list workloads", "namespace", serviceAccount.GetNamespace(), "kind", h.kind)
+		return nil
+	}
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return nil
+	}
+	requests := []reconcile.Request{}
+	for _, item := range items {
+		instance, ok := item.(I)
+		if !ok || !hasImagePullSecretsAnnotation(instance) {
+			continue
+		}
+		if serviceAccountName(GetPodTemplate(instance)) == serviceAccount.GetName() {
+			requests = append(requests, reconcile.Request{NamespacedName: GetNamespacedNameFromObject(instance)})
+		}
+	}
+	return requests
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var _ = Describe("Wave image pull Secrets Suite", func() {
+	var c client.Client
+	var deploymentObject *appsv1.Deployment
+	var serviceAccount *corev1.ServiceAccount
+
+	BeforeEach(func() {
+		deploymentObject = utils.ExampleDeployment.DeepCopy()
+		deploymentObject.Annotations[RequiredAnnotation] = requiredAnnotationValue
+		deploymentObject.Annotations[ImagePullSecretsAnnotation] = "true"
+		deploymentObject.Spec.Template.Spec.ServiceAccountName = "app"
+		deploymentObject.Spec.Template.Spec.ImagePullSecrets = []corev1.LocalObjectReference{{Name: "pod-pull"}}
+		serviceAccount = &corev1.ServiceAccount{
+			ObjectMeta:       metav1.ObjectMeta{Name: "app", Namespace: deploymentObject.Namespace},
+			ImagePullSecrets: []corev1.LocalObjectReference{{Name: "sa-pull"}},
+		}
+		c = fake.NewClientBuilder().WithObjects(deploymentObject, serviceAccount).Build()
+	})
+
+	pullSecrets := func(h *Handler[*appsv1.Deployment]) []types.NamespacedName {
+		_, secretsConfig, _ := h.referencedChildren(deploymentObject)
+		names := []types.NamespacedName{}
+		for _, child := range secretsConfig {
+			if child.name.Name == "pod-pull" || child.name.Name == "sa-pull" {
+				Expect(child.required).To(BeFalse())
+				names = append(names, child.name)
+			}
+		}
+		return names
+	}
+
+	It("adds the image pull Secrets of the pods and their ServiceAccount", func() {
+		h := NewHandler[*appsv1.Deployment](c, record.NewFakeRecorder(10), HandlerOptions{WatchImagePullSecrets: true})
+		Expect(pullSecrets(h)).To(Equal([]types.NamespacedName{
+			{Namespace: "default", Name: "pod-pull"},
+			{Namespace: "default", Name: "sa-pull"},
+		}))
+	})
+
+	It("ignores image pull Secrets of workloads which do not opt in", func() {
+		delete(deploymentObject.Annotations, ImagePullSecretsAnnotation)
+		h := NewHandler[*appsv1.Deployment](c, record.NewFakeRecorder(10), HandlerOptions{WatchImagePullSecrets: true})
+		Expect(pullSecrets(h)).To(BeEmpty())
+	})
+
+	It("ignores image pull Secrets unless they are watched", func() {
+		h := NewHandler[*appsv1.Deployment](c, record.NewFakeRecorder(10), HandlerOptions{})
+		Expect(pullSecrets(h)).To(BeEmpty())
+	})
+
+	It("reconciles the workloads running as a ServiceAccount", func() {
+		h := NewHandler[*appsv1.Deployment](c, record.NewFakeRecorder(10), HandlerOptions{WatchImagePullSecrets: true})
+		Expect(h.requestsForServiceAccount(context.TODO(), serviceAccount)).To(Equal([]reconcile.Request{
+			{NamespacedName: GetNamespacedNameFromObject(deploymentObject)},
+		}))
+
+		other := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: deploymentObject.Namespace}}
+		Expect(h.requestsForServiceAccount(context.TODO(), other)).To(BeEmpty())
+	})
+
+	It("only passes changes of the image pull Secrets", func() {
+		updated := serviceAccount.DeepCopy()
+		updated.Labels = map[string]string{"team": "a"}
+		Expect(serviceAccountChanged().Update(event.UpdateEvent{ObjectOld: serviceAccount, ObjectNew: updated})).To(BeFalse())
+
+		updated.ImagePullSecrets = append(updated.ImagePullSecrets, corev1.LocalObjectReference{Name: "rotated"})
+		Expect(serviceAccountChanged().Update(event.UpdateEvent{ObjectOld: serviceAccount, ObjectNew: updated})).To(BeTrue())
+	})
+})
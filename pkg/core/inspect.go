@@ -0,0 +1,212 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"time"
+
+	"golang.org/x/time/rate"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ChildReference describes a ConfigMap or Secret referenced by a workload
+type ChildReference struct {
+	// Kind is either configmap or secret
+	Kind     string
+	Name     types.NamespacedName
+	Required bool
+	// Keys holds the referenced keys or is nil if all keys are referenced
+	Keys []string
+}
+
+// Inspector answers questions about workloads of any kind exactly the way
+// the controller does, e.g. for the kubectl plugin
+type Inspector struct {
+	client       client.Client
+	deployments  *Handler[*appsv1.Deployment]
+	statefulSets *Handler[*appsv1.StatefulSet]
+	daemonSets   *Handler[*appsv1.DaemonSet]
+}
+
+// NewInspector constructs a new Inspector. The options have to match the ones
+// of the controller, e.g. by parsing the same Flags.
+func NewInspector(c client.Client, opts HandlerOptions) *Inspector {
+	return newInspector(c, opts)
+}
+
+// newInspector constructs an Inspector whose Handlers are not registered with
+// the state shared between the Handlers of the controller
+func newInspector(c client.Client, opts HandlerOptions) *Inspector {
+	if opts.UpdateThrottler == nil {
+		opts.UpdateThrottler = NewUpdateThrottler(rate.Limit(math.Inf(1)), 1)
+	}
+	// The Inspector never records events
+	r := &record.FakeRecorder{}
+	return &Inspector{
+		client:       c,
+		deployments:  newHandler[*appsv1.Deployment](c, r, opts),
+		statefulSets: newHandler[*appsv1.StatefulSet](c, r, opts),
+		daemonSets:   newHandler[*appsv1.DaemonSet](c, r, opts),
+	}
+}
+
+// IsEnabled returns true if the controller manages the workload
+func (i *Inspector) IsEnabled(obj client.Object) bool {
+	switch o := obj.(type) {
+	case *appsv1.Deployment:
+		return i.deployments.isEnabled(o)
+	case *appsv1.StatefulSet:
+		return i.statefulSets.isEnabled(o)
+	case *appsv1.DaemonSet:
+		return i.daemonSets.isEnabled(o)
+	}
+	panic(fmt.Sprintf("Invalid type %s", reflect.TypeOf(obj)))
+}
+
+// Dependencies returns the ConfigMaps and Secrets referenced by the workload
+func (i *Inspector) Dependencies(obj client.Object) []ChildReference {
+	switch o := obj.(type) {
+	case *appsv1.Deployment:
+		return i.deployments.dependencies(o)
+	case *appsv1.StatefulSet:
+		return i.statefulSets.dependencies(o)
+	case *appsv1.DaemonSet:
+		return i.daemonSets.dependencies(o)
+	}
+	panic(fmt.Sprintf("Invalid type %s", reflect.TypeOf(obj)))
+}
+
+// referencedChildren returns the children of the workload its Handler hashes
+func (i *Inspector) referencedChildren(obj client.Object) (configMetadataList, configMetadataList) {
+	var configMapsConfig, secretsConfig configMetadataList
+	switch o := obj.(type) {
+	case *appsv1.Deployment:
+		configMapsConfig, secretsConfig, _ = i.deployments.referencedChildren(o)
+	case *appsv1.StatefulSet:
+		configMapsConfig, secretsConfig, _ = i.statefulSets.referencedChildren(o)
+	case *appsv1.DaemonSet:
+		configMapsConfig, secretsConfig, _ = i.daemonSets.referencedChildren(o)
+	default:
+		panic(fmt.Sprintf("Invalid type %s", reflect.TypeOf(obj)))
+	}
+	return configMapsConfig, secretsConfig
+}
+
+// ConfigHashes returns the configuration hash the workload was last updated
+// with and the hash of its current children. It returns an error if required
+// children are missing or if children cannot be read and the workload does
+// not hash the readable children.
+func (i *Inspector) ConfigHashes(ctx context.Context, obj client.Object) (string, string, error) {
+	switch o := obj.(type) {
+	case *appsv1.Deployment:
+		return i.deployments.configHashes(o)
+	case *appsv1.StatefulSet:
+		return i.statefulSets.configHashes(o)
+	case *appsv1.DaemonSet:
+		return i.daemonSets.configHashes(o)
+	}
+	panic(fmt.Sprintf("Invalid type %s", reflect.TypeOf(obj)))
+}
+
+// RequestRehash sets the RehashRequestedAnnotation on the workload. The
+// update makes the controller reconcile the workload.
+func (i *Inspector) RequestRehash(ctx context.Context, obj client.Object) error {
+	patch := client.MergeFrom(obj.DeepCopyObject().(client.Object))
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[RehashRequestedAnnotation] = time.Now().UTC().Format(time.RFC3339)
+	obj.SetAnnotations(annotations)
+	if err := i.client.Patch(ctx, obj, patch); err != nil {
+		return fmt.Errorf("error requesting rehash of %s %s/%s: %v", KindOf(obj), obj.GetNamespace(), obj.GetName(), err)
+	}
+	return nil
+}
+
+// dependencies returns the children of the instance merged by child
+func (h *Handler[I]) dependencies(instance I) []ChildReference {
+	configMapsConfig, secretsConfig, _ := h.referencedChildren(instance)
+	return append(childReferences(configMapKind, configMapsConfig), childReferences(secretKind, secretsConfig)...)
+}
+
+// configHashes returns the current and the desired hash of the instance
+func (h *Handler[I]) configHashes(instance I) (string, string, error) {
+	current := h.currentHash(instance)
+	configMapsConfig, secretsConfig, _ := h.referencedChildren(instance)
+	configMaps, secrets, unreadable := h.getReadableChildren(configMapsConfig, secretsConfig)
+	if len(unreadable) > 0 {
+		if h.unreadableChildrenPolicy(instance) != UnreadableChildrenHashReadable {
+			return current, "", fmt.Errorf("error fetching current children: %s", describeUnreadableChildren(unreadable))
+		}
+		configMapsConfig, secretsConfig = withoutUnreadableChildren(configMapsConfig, secretsConfig, unreadable)
+	}
+	if err := h.checkRequiredChildren(configMaps, secrets, configMapsConfig, secretsConfig); err != nil {
+		return current, "", err
+	}
+	desired, err := calculateConfigHash(configMaps, secrets, configMapsConfig, secretsConfig)
+	if err != nil {
+		return current, "", fmt.Errorf("error calculating configuration hash: %v", err)
+	}
+	return current, desired, nil
+}
+
+// childReferences merges all references to the same child. A child is
+// required if any reference is required and all keys are referenced if any
+// reference covers all keys.
+func childReferences(kind string, children configMetadataList) []ChildReference {
+	byName := make(map[types.NamespacedName]*ChildReference)
+	allKeys := make(map[types.NamespacedName]bool)
+	keys := make(map[types.NamespacedName]map[string]bool)
+	for _, child := range children {
+		ref, ok := byName[child.name]
+		if !ok {
+			ref = &ChildReference{Kind: kind, Name: child.name}
+			byName[child.name] = ref
+			keys[child.name] = make(map[string]bool)
+		}
+		ref.Required = ref.Required || child.required
+		allKeys[child.name] = allKeys[child.name] || child.allKeys
+		for key := range child.keys {
+			keys[child.name][key] = true
+		}
+	}
+
+	refs := []ChildReference{}
+	for name, ref := range byName {
+		if !allKeys[name] {
+			ref.Keys = []string{}
+			for key := range keys[name] {
+				ref.Keys = append(ref.Keys, key)
+			}
+			sort.Strings(ref.Keys)
+		}
+		refs = append(refs, *ref)
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		return refs[i].Name.String() < refs[j].Name.String()
+	})
+	return refs
+}
@@ -0,0 +1,48 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+)
+
+var _ = Describe("Wave inspector Suite", func() {
+	var i *Inspector
+
+	BeforeEach(func() {
+		i = NewInspector(nil, HandlerOptions{})
+	})
+
+	It("merges the references to a child", func() {
+		refs := i.Dependencies(utils.ExampleDeployment.DeepCopy())
+		Expect(refs).To(ContainElements(
+			// Mounted as a volume and referenced by key
+			ChildReference{Kind: configMapKind, Name: GetNamespacedName("example1", "default"), Required: true},
+			// Only referenced by keys
+			ChildReference{Kind: configMapKind, Name: GetNamespacedName("example3", "default"), Required: true, Keys: []string{"key1", "key2", "key4"}},
+			// Only referenced by the extra-configmaps annotation
+			ChildReference{Kind: configMapKind, Name: GetNamespacedName("test-cm1", "ns1")},
+			ChildReference{Kind: secretKind, Name: GetNamespacedName("volume-optional", "default")},
+		))
+	})
+
+	It("returns the same references for all kinds", func() {
+		Expect(i.Dependencies(utils.ExampleStatefulSet.DeepCopy())).To(Equal(i.Dependencies(utils.ExampleDeployment.DeepCopy())))
+	})
+})
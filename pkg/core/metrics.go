@@ -0,0 +1,152 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// Reasons for which a reconcile does not update the workload
+const (
+	skipReasonNotEnabled         = "not_enabled"
+	skipReasonMissingChildren    = "missing_children"
+	skipReasonBlastRadius        = "blast_radius"
+	skipReasonRolloutAfter       = "rollout_after"
+	skipReasonUnchanged          = "unchanged"
+	skipReasonChildDeleted       = "child_deleted"
+	skipReasonNotOwned           = "not_owned"
+	skipReasonUnreadableChildren = "unreadable_children"
+)
+
+var (
+	// rolloutsTotal counts the rollouts triggered by Wave by their outcome
+	rolloutsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "wave_rollouts_total",
+		Help: "Number of rollouts triggered by Wave by outcome (succeeded, stalled)",
+	}, []string{"kind", "namespace", "result"})
+
+	// rolloutDurationSeconds observes the time from the hash update to the outcome of the rollout
+	rolloutDurationSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "wave_rollout_duration_seconds",
+		Help:    "Time from a configuration hash update to the outcome of the resulting rollout",
+		Buckets: prometheus.ExponentialBuckets(5, 2, 10),
+	}, []string{"kind", "result"})
+
+	// hashChangesTotal counts the updates of the configuration hash
+	hashChangesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "wave_config_hash_changes_total",
+		Help: "Number of configuration hash updates of workloads",
+	}, []string{"kind", "namespace"})
+
+	// reconcilesSkippedTotal counts the reconciles which did not update the workload
+	reconcilesSkippedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "wave_reconciles_skipped_total",
+		Help: "Number of reconciles which did not update the workload by reason (not_enabled, missing_children, blast_radius, rollout_after, unchanged, child_deleted, not_owned, unreadable_children)",
+	}, []string{"kind", "reason"})
+
+	// workloadsMissingChildren is the number of workloads blocked on missing required children
+	workloadsMissingChildren = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "wave_workloads_missing_children",
+		Help: "Number of workloads which are blocked on missing required ConfigMaps or Secrets",
+	}, []string{"kind"})
+
+	// workloadsUnreadableChildren is the number of workloads referencing
+	// children which cannot be read
+	workloadsUnreadableChildren = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "wave_workloads_unreadable_children",
+		Help: "Number of workloads referencing ConfigMaps or Secrets which Wave cannot read",
+	}, []string{"kind"})
+
+	// childReadErrorsTotal counts the children which could not be read
+	childReadErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "wave_child_read_errors_total",
+		Help: "Number of failed reads of ConfigMaps and Secrets by reason (forbidden, error)",
+	}, []string{"kind", "child_kind", "reason"})
+
+	// workloadsSchedulingTimedOut is the number of workloads whose scheduling
+	// has been disabled for longer than the scheduling timeout
+	workloadsSchedulingTimedOut = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "wave_workloads_scheduling_timed_out",
+		Help: "Number of workloads whose scheduling has been disabled because of missing children for longer than the scheduling timeout",
+	}, []string{"kind"})
+
+	// watchedChildren is the number of ConfigMaps and Secrets watched for a kind of workload
+	watchedChildren = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "wave_watched_children",
+		Help: "Number of ConfigMaps and Secrets watched for a kind of workload",
+	}, []string{"kind", "child_kind"})
+
+	// updateThrottleWaitSeconds observes the time updates wait for the UpdateThrottler
+	updateThrottleWaitSeconds = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "wave_update_throttle_wait_seconds",
+		Help:    "Time an update waits for the global update rate limit",
+		Buckets: prometheus.ExponentialBuckets(0.001, 4, 10),
+	})
+
+	// configChangeLatencySeconds observes the time from an update or deletion of a child to the update of the workload
+	configChangeLatencySeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "wave_config_change_latency_seconds",
+		Help:    "Time from an update or deletion of a ConfigMap or Secret to the resulting update of the workload",
+		Buckets: prometheus.ExponentialBuckets(0.01, 4, 10),
+	}, []string{"kind"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		rolloutsTotal,
+		rolloutDurationSeconds,
+		hashChangesTotal,
+		reconcilesSkippedTotal,
+		workloadsMissingChildren,
+		workloadsUnreadableChildren,
+		childReadErrorsTotal,
+		workloadsSchedulingTimedOut,
+		watchedChildren,
+		updateThrottleWaitSeconds,
+		configChangeLatencySeconds,
+	)
+}
+
+// workloadSet tracks a set of workloads of one kind in a gauge
+type workloadSet struct {
+	mutex sync.Mutex
+	names map[types.NamespacedName]bool
+	gauge prometheus.Gauge
+}
+
+func newWorkloadSet(gauge prometheus.Gauge) *workloadSet {
+	return &workloadSet{
+		names: make(map[types.NamespacedName]bool),
+		gauge: gauge,
+	}
+}
+
+// set adds the workload to or removes it from the set
+func (s *workloadSet) set(name types.NamespacedName, member bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if member {
+		s.names[name] = true
+	} else {
+		delete(s.names, name)
+	}
+	s.gauge.Set(float64(len(s.names)))
+}
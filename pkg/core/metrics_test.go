@@ -0,0 +1,91 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+var _ = Describe("Wave metrics Suite", func() {
+	Context("workloadSet", func() {
+		It("counts every workload once", func() {
+			gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "test"})
+			set := newWorkloadSet(gauge)
+			a := GetNamespacedName("a", "default")
+			b := GetNamespacedName("b", "default")
+
+			set.set(a, true)
+			set.set(a, true)
+			set.set(b, true)
+			Expect(testutil.ToFloat64(gauge)).To(Equal(2.0))
+
+			set.set(a, false)
+			set.set(a, false)
+			Expect(testutil.ToFloat64(gauge)).To(Equal(1.0))
+		})
+	})
+
+	Context("watched children", func() {
+		var h *Handler[*appsv1.StatefulSet]
+		var instance *appsv1.StatefulSet
+		var configMapsConfig configMetadataList
+
+		BeforeEach(func() {
+			h = NewHandler[*appsv1.StatefulSet](nil, record.NewFakeRecorder(10), HandlerOptions{})
+			instance = &appsv1.StatefulSet{ObjectMeta: utils.ExampleDeployment.ObjectMeta}
+			configMapsConfig = configMetadataList{{name: GetNamespacedNameFromObject(utils.ExampleConfigMap1)}}
+			h.watchChildrenForInstance(instance, configMapsConfig, configMetadataList{})
+		})
+
+		It("exposes the number of watched children", func() {
+			Expect(testutil.ToFloat64(watchedChildren.WithLabelValues("StatefulSet", configMapKind))).To(Equal(1.0))
+			h.removeWatchesForInstance(instance)
+			Expect(testutil.ToFloat64(watchedChildren.WithLabelValues("StatefulSet", configMapKind))).To(Equal(0.0))
+		})
+
+		It("records the last change of watched children", func() {
+			_, ok := h.lastChildChange(configMapsConfig, configMetadataList{})
+			Expect(ok).To(BeFalse())
+
+			e := &enqueueRequestForWatcher{WatcherList: h.GetWatchedConfigmaps()}
+			q := workqueue.NewTypedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[reconcile.Request]())
+			defer q.ShutDown()
+			e.Create(context.TODO(), event.CreateEvent{Object: utils.ExampleConfigMap1.DeepCopy()}, q)
+			_, ok = h.lastChildChange(configMapsConfig, configMetadataList{})
+			Expect(ok).To(BeFalse())
+
+			e.recordChange(utils.ExampleConfigMap2.DeepCopy())
+			_, ok = h.lastChildChange(configMapsConfig, configMetadataList{})
+			Expect(ok).To(BeFalse())
+
+			e.recordChange(utils.ExampleConfigMap1.DeepCopy())
+			_, ok = h.lastChildChange(configMapsConfig, configMetadataList{})
+			Expect(ok).To(BeTrue())
+		})
+	})
+})
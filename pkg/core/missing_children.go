@@ -0,0 +1,150 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// MissingChildrenPolicy controls how the webhook handles updates of workloads
+// which add required references to children that do not exist yet
+type MissingChildrenPolicy string
+
+const (
+	// MissingChildrenHold rejects the update so that the workload keeps its
+	// previous pod template until the children exist
+	MissingChildrenHold MissingChildrenPolicy = "hold"
+
+	// MissingChildrenGate disables scheduling of the new pods until the
+	// children exist
+	MissingChildrenGate MissingChildrenPolicy = "gate"
+
+	// MissingChildrenProceed lets the update through unchanged
+	MissingChildrenProceed MissingChildrenPolicy = "proceed"
+)
+
+// ParseMissingChildrenPolicy parses the value of the
+// --missing-children-policy flag or annotation
+func ParseMissingChildrenPolicy(value string) (MissingChildrenPolicy, error) {
+	switch policy := MissingChildrenPolicy(value); policy {
+	case MissingChildrenHold, MissingChildrenGate, MissingChildrenProceed:
+		return policy, nil
+	}
+	return "", fmt.Errorf("invalid missing children policy %q: must be %s, %s or %s", value, MissingChildrenHold, MissingChildrenGate, MissingChildrenProceed)
+}
+
+// rejectedUpdateError is returned by the webhook to reject an update which
+// adds required references to missing children
+type rejectedUpdateError struct {
+	children string
+}
+
+// Error returns the message shown to the client
+func (e *rejectedUpdateError) Error() string {
+	return fmt.Sprintf("update adds required references to missing children: %s. Create the children first or set the %s annotation", e.children, MissingChildrenPolicyAnnotation)
+}
+
+// missingChildrenPolicy returns the policy of the instance, which may be
+// overridden by an annotation
+func (h *Handler[I]) missingChildrenPolicy(instance I) MissingChildrenPolicy {
+	if value, ok := instance.GetAnnotations()[MissingChildrenPolicyAnnotation]; ok {
+		if policy, err := ParseMissingChildrenPolicy(value); err == nil {
+			return policy
+		}
+	}
+	return h.defaultMissingChildrenPolicy
+}
+
+// handleMissingChildrenOnUpdate applies the missing children policy if the
+// update of the instance adds required references to children which do not
+// exist. References which were already missing before are left alone, as are
+// children which cannot be read.
+func (h *Handler[I]) handleMissingChildrenOnUpdate(instance I, oldInstance I, dryRun bool) error {
+	log := logf.Log.WithName("wave").WithValues("namespace", instance.GetNamespace(), "name", instance.GetName(), "dryRun", dryRun)
+
+	configMapsConfig, secretsConfig, _ := h.referencedChildren(instance)
+	oldConfigMapsConfig, oldSecretsConfig, _ := h.referencedChildren(oldInstance)
+	configMaps, secrets, unreadable := h.getReadableChildren(append(configMapsConfig, oldConfigMapsConfig...), append(secretsConfig, oldSecretsConfig...))
+	configMapsConfig, secretsConfig = withoutUnreadableChildren(configMapsConfig, secretsConfig, unreadable)
+	oldConfigMapsConfig, oldSecretsConfig = withoutUnreadableChildren(oldConfigMapsConfig, oldSecretsConfig, unreadable)
+
+	previouslyMissing := make(map[string]bool)
+	for _, missing := range missingRequiredChildren(configMaps, secrets, oldConfigMapsConfig, oldSecretsConfig) {
+		previouslyMissing[missing] = true
+	}
+	added := []string{}
+	for _, missing := range missingRequiredChildren(configMaps, secrets, configMapsConfig, secretsConfig) {
+		if !previouslyMissing[missing] {
+			added = append(added, missing)
+			previouslyMissing[missing] = true
+		}
+	}
+	if len(added) == 0 {
+		log.V(0).Info("Not all required children found yet. Skipping mutation!")
+		return nil
+	}
+
+	policy := h.missingChildrenPolicy(instance)
+	children := strings.Join(added, ", ")
+	var reason, message string
+	switch policy {
+	case MissingChildrenHold:
+		if !dryRun {
+			log.V(0).Info("Rejecting update which adds references to missing children", "policy", policy, "children", added)
+			h.recorder.Eventf(instance, corev1.EventTypeWarning, "UpdateRejected", "Rejected update due to missing children: %s", children)
+		}
+		return &rejectedUpdateError{children: children}
+	case MissingChildrenGate:
+		h.blockScheduling(instance)
+		reason, message = "SchedulingDisabled", fmt.Sprintf("Disabled scheduling due to missing children: %s", children)
+	default:
+		reason, message = "MissingChildren", fmt.Sprintf("Proceeding with the update despite missing children: %s", children)
+	}
+	setMissingChildrenStatus(instance, fmt.Sprintf("%s: %s", policy, children))
+
+	if !dryRun {
+		log.V(0).Info("Update adds references to missing children", "policy", policy, "children", added)
+		h.recorder.Eventf(instance, corev1.EventTypeWarning, reason, message)
+	}
+	return nil
+}
+
+// setMissingChildrenStatus sets the missing children annotation
+func setMissingChildrenStatus[I InstanceType](instance I, status string) {
+	annotations := instance.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[MissingChildrenAnnotation] = status
+	instance.SetAnnotations(annotations)
+}
+
+// clearMissingChildrenStatus removes the missing children annotation and
+// returns true if it was present
+func clearMissingChildrenStatus[I InstanceType](instance I) bool {
+	annotations := instance.GetAnnotations()
+	if _, ok := annotations[MissingChildrenAnnotation]; !ok {
+		return false
+	}
+	delete(annotations, MissingChildrenAnnotation)
+	instance.SetAnnotations(annotations)
+	return true
+}
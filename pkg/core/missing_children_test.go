@@ -0,0 +1,157 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"fmt"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+var _ = Describe("Wave missing children Suite", func() {
+	var h *Handler[*appsv1.Deployment]
+	var recorder *record.FakeRecorder
+	var oldObject *appsv1.Deployment
+	var newObject *appsv1.Deployment
+	var objects []client.Object
+
+	BeforeEach(func() {
+		oldObject = utils.ExampleDeployment.DeepCopy()
+		oldObject.Annotations[RequiredAnnotation] = requiredAnnotationValue
+		delete(oldObject.Annotations, ExtraConfigMapsAnnotation)
+		delete(oldObject.Annotations, ExtraSecretsAnnotation)
+		objects = []client.Object{
+			utils.ExampleConfigMap1.DeepCopy(),
+			utils.ExampleConfigMap2.DeepCopy(),
+			utils.ExampleConfigMap3.DeepCopy(),
+			utils.ExampleConfigMap4.DeepCopy(),
+			utils.ExampleConfigMap5.DeepCopy(),
+			utils.ExampleConfigMap6.DeepCopy(),
+		}
+		for _, s := range []*corev1.Secret{
+			utils.ExampleSecret1.DeepCopy(),
+			utils.ExampleSecret2.DeepCopy(),
+			utils.ExampleSecret3.DeepCopy(),
+			utils.ExampleSecret4.DeepCopy(),
+			utils.ExampleSecret5.DeepCopy(),
+			utils.ExampleSecret6.DeepCopy(),
+		} {
+			// The fake client does not merge stringData into data like the API server
+			if s.Data == nil {
+				s.Data = map[string][]byte{}
+			}
+			for key, value := range s.StringData {
+				s.Data[key] = []byte(value)
+			}
+			objects = append(objects, s)
+		}
+		c := fake.NewClientBuilder().WithObjects(objects...).Build()
+		recorder = record.NewFakeRecorder(10)
+		h = NewHandler[*appsv1.Deployment](c, recorder, HandlerOptions{})
+
+		newObject = oldObject.DeepCopy()
+		container := &newObject.Spec.Template.Spec.Containers[0]
+		container.EnvFrom = append(container.EnvFrom, corev1.EnvFromSource{
+			ConfigMapRef: &corev1.ConfigMapEnvSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "missing"},
+			},
+		})
+	})
+
+	It("proceeds with the update by default", func() {
+		expected := newObject.Spec.Template.DeepCopy()
+		Expect(h.HandleWebhook(newObject, oldObject, nil, false)).To(Succeed())
+		Expect(newObject.Spec.Template).To(Equal(*expected))
+		Expect(newObject.Annotations[MissingChildrenAnnotation]).To(Equal("proceed: missing required configmap default/missing"))
+		Expect(recorder.Events).To(Receive(ContainSubstring("MissingChildren")))
+	})
+
+	It("rejects the update with hold", func() {
+		newObject.Annotations[MissingChildrenPolicyAnnotation] = string(MissingChildrenHold)
+		err := h.HandleWebhook(newObject, oldObject, nil, false)
+		Expect(err).To(MatchError(ContainSubstring("missing required configmap default/missing")))
+		Expect(newObject.Annotations).NotTo(HaveKey(MissingChildrenAnnotation))
+		Expect(recorder.Events).To(Receive(ContainSubstring("UpdateRejected")))
+	})
+
+	It("leaves children which cannot be read alone", func() {
+		c := fake.NewClientBuilder().WithObjects(objects...).WithInterceptorFuncs(interceptor.Funcs{
+			Get: func(ctx context.Context, c client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+				if _, ok := obj.(*corev1.Secret); ok && key.Name == "restricted" {
+					return errors.NewForbidden(schema.GroupResource{Resource: "secrets"}, key.Name, nil)
+				}
+				return c.Get(ctx, key, obj, opts...)
+			},
+		}).Build()
+		h = NewHandler[*appsv1.Deployment](c, recorder, HandlerOptions{UnreadableChildrenPolicy: UnreadableChildrenHashReadable})
+		for _, obj := range []*appsv1.Deployment{oldObject, newObject} {
+			container := &obj.Spec.Template.Spec.Containers[0]
+			container.EnvFrom = append(container.EnvFrom, corev1.EnvFromSource{
+				SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "restricted"}},
+			})
+		}
+		newObject.Annotations[MissingChildrenPolicyAnnotation] = string(MissingChildrenHold)
+		err := h.HandleWebhook(newObject, oldObject, nil, false)
+		Expect(err).To(MatchError(HaveSuffix(fmt.Sprintf("missing children: missing required configmap default/missing. Create the children first or set the %s annotation", MissingChildrenPolicyAnnotation))))
+	})
+
+	It("reports the rejection in dry-run mode", func() {
+		h = NewHandler[*appsv1.Deployment](h.Client, recorder, HandlerOptions{DryRun: true})
+		newObject.Annotations[MissingChildrenPolicyAnnotation] = string(MissingChildrenHold)
+		expected := newObject.DeepCopy()
+		Expect(h.HandleWebhook(newObject, oldObject, nil, false)).To(Succeed())
+		Expect(newObject).To(Equal(expected))
+		Expect(recorder.Events).To(Receive(ContainSubstring("DryRunUpdateRejected")))
+	})
+
+	It("disables scheduling with gate", func() {
+		newObject.Annotations[MissingChildrenPolicyAnnotation] = string(MissingChildrenGate)
+		Expect(h.HandleWebhook(newObject, oldObject, nil, false)).To(Succeed())
+		Expect(isSchedulingDisabled(newObject)).To(BeTrue())
+		Expect(recorder.Events).To(Receive(ContainSubstring("SchedulingDisabled")))
+	})
+
+	It("ignores children which were missing before", func() {
+		oldObject = newObject.DeepCopy()
+		newObject.Annotations[MissingChildrenPolicyAnnotation] = string(MissingChildrenHold)
+		newObject.Spec.Template.Labels["changed"] = "true"
+		Expect(h.HandleWebhook(newObject, oldObject, nil, false)).To(Succeed())
+		Expect(newObject.Spec.Template.Labels).To(HaveKey("changed"))
+		Expect(newObject.Annotations).NotTo(HaveKey(MissingChildrenAnnotation))
+		Expect(recorder.Events).NotTo(Receive())
+	})
+
+	Context("clearMissingChildrenStatus", func() {
+		It("returns whether the annotation was present", func() {
+			Expect(clearMissingChildrenStatus(newObject)).To(BeFalse())
+			setMissingChildrenStatus(newObject, "gate: configmap default/missing")
+			Expect(clearMissingChildrenStatus(newObject)).To(BeTrue())
+			Expect(newObject.Annotations).NotTo(HaveKey(MissingChildrenAnnotation))
+		})
+	})
+})
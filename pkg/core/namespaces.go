@@ -17,9 +17,19 @@ limitations under the License.
 package core
 
 import (
+	"context"
+	"fmt"
+	"path"
+	"slices"
 	"strings"
 
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
 )
 
 // BuildCacheDefaultNamespaces builds a cache config to watch namespaces
@@ -34,3 +44,98 @@ func BuildCacheDefaultNamespaces(namespaces string) map[string]cache.Config {
 	}
 	return defaultNamespaces
 }
+
+// NamespaceFilter limits the namespaces Wave manages workloads in by
+// excluding namespaces by name or pattern and by selecting namespaces by
+// label. The labels are checked whenever a workload is handled so that
+// namespaces created or relabeled later are picked up.
+type NamespaceFilter struct {
+	excluded []string
+	selector labels.Selector
+}
+
+// NewNamespaceFilter returns a NamespaceFilter. Excluded entries are
+// namespace names or patterns like tenant-*.
+func NewNamespaceFilter(excluded []string, selector labels.Selector) (*NamespaceFilter, error) {
+	f := &NamespaceFilter{selector: selector}
+	for _, pattern := range excluded {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid namespace pattern %q: %v", pattern, err)
+		}
+		f.excluded = append(f.excluded, pattern)
+	}
+	if f.selector != nil && f.selector.Empty() {
+		f.selector = nil
+	}
+	return f, nil
+}
+
+// excludes returns true if the namespace is excluded by name or pattern
+func (f *NamespaceFilter) excludes(namespace string) bool {
+	if f == nil {
+		return false
+	}
+	for _, pattern := range f.excluded {
+		if matched, _ := path.Match(pattern, namespace); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// excludesFromCache returns true if the namespace is excluded by name and
+// therefore not cached
+func (f *NamespaceFilter) excludesFromCache(namespace string) bool {
+	return f != nil && slices.Contains(f.excluded, namespace)
+}
+
+// selects returns true if the labels of the namespace match the selector
+func (f *NamespaceFilter) selects(namespace client.Object) bool {
+	return f == nil || f.selector == nil || f.selector.Matches(labels.Set(namespace.GetLabels()))
+}
+
+// hasSelector returns true if namespaces are selected by label
+func (f *NamespaceFilter) hasSelector() bool {
+	return f != nil && f.selector != nil
+}
+
+// CacheConfig builds a cache config which excludes the namespaces excluded by
+// name. Patterns and the label selector are only applied by the Handlers.
+func (f *NamespaceFilter) CacheConfig() map[string]cache.Config {
+	if f == nil {
+		return nil
+	}
+	selectors := []fields.Selector{}
+	for _, pattern := range f.excluded {
+		if !strings.ContainsAny(pattern, `*?[\`) {
+			selectors = append(selectors, fields.OneTermNotEqualSelector("metadata.namespace", pattern))
+		}
+	}
+	if len(selectors) == 0 {
+		// Default: All namespaces
+		return nil
+	}
+	return map[string]cache.Config{
+		cache.AllNamespaces: {FieldSelector: fields.AndSelectors(selectors...)},
+	}
+}
+
+// managesNamespace returns true if the namespace passes the NamespaceFilter
+func (h *Handler[I]) managesNamespace(name string) bool {
+	if h.namespaceFilter.excludes(name) {
+		return false
+	}
+	if !h.namespaceFilter.hasSelector() {
+		return true
+	}
+	namespace := &corev1.Namespace{}
+	if err := h.namespaceReader.Get(context.TODO(), types.NamespacedName{Name: name}, namespace); err != nil {
+		logf.Log.WithName("wave").Error(err, "Unable to get namespace", "namespace", name)
+		return false
+	}
+	return h.namespaceFilter.selects(namespace)
+}
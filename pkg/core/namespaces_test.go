@@ -19,6 +19,7 @@ package core
 import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/fields"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
 )
 
@@ -42,4 +43,28 @@ var _ = Describe("Wave Namespace Suite", func() {
 			}))
 		})
 	})
+
+	Context("NamespaceFilter", func() {
+		It("Excludes namespaces by name and pattern", func() {
+			f, err := NewNamespaceFilter([]string{"kube-system", "tenant-*"}, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(f.excludes("kube-system")).To(BeTrue())
+			Expect(f.excludes("tenant-a")).To(BeTrue())
+			Expect(f.excludes("default")).To(BeFalse())
+			Expect(f.excludesFromCache("tenant-a")).To(BeFalse())
+		})
+
+		It("Only excludes namespaces by name from the cache", func() {
+			f, err := NewNamespaceFilter([]string{"kube-system", "tenant-*"}, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(f.CacheConfig()).To(Equal(map[string]cache.Config{
+				cache.AllNamespaces: {FieldSelector: fields.AndSelectors(fields.OneTermNotEqualSelector("metadata.namespace", "kube-system"))},
+			}))
+		})
+
+		It("Returns an error for invalid patterns", func() {
+			_, err := NewNamespaceFilter([]string{"tenant-["}, nil)
+			Expect(err).To(HaveOccurred())
+		})
+	})
 })
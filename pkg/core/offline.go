@@ -0,0 +1,148 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Manifests holds the objects Wave reads from manifests instead of a cluster
+// when it calculates configuration hashes offline
+type Manifests struct {
+	ConfigMaps      []*corev1.ConfigMap
+	Secrets         []*corev1.Secret
+	Namespaces      []*corev1.Namespace
+	ServiceAccounts []*corev1.ServiceAccount
+}
+
+// newOfflineInspector returns an Inspector whose Handlers read Namespaces and
+// ServiceAccounts from the manifests instead of a cluster
+func newOfflineInspector(opts HandlerOptions, manifests Manifests) *Inspector {
+	i := newInspector(nil, opts)
+	reader := offlineReader{
+		namespaces:      make(map[string]*corev1.Namespace),
+		serviceAccounts: make(map[types.NamespacedName]*corev1.ServiceAccount),
+	}
+	for _, namespace := range manifests.Namespaces {
+		reader.namespaces[namespace.GetName()] = namespace
+	}
+	for _, serviceAccount := range manifests.ServiceAccounts {
+		reader.serviceAccounts[GetNamespacedNameFromObject(serviceAccount)] = serviceAccount
+	}
+	i.deployments.namespaceReader, i.deployments.serviceAccountReader = reader, reader
+	i.statefulSets.namespaceReader, i.statefulSets.serviceAccountReader = reader, reader
+	i.daemonSets.namespaceReader, i.daemonSets.serviceAccountReader = reader, reader
+	return i
+}
+
+// IsWaveEnabled returns true if the controller manages the workload with the
+// given options, e.g. in opt-out mode or in a namespace which opted in. The
+// labels and annotations of the namespace of the workload are taken from the
+// Namespaces of the manifests, other namespaces have none.
+func IsWaveEnabled(obj client.Object, opts HandlerOptions, manifests Manifests) bool {
+	return newOfflineInspector(opts, manifests).IsEnabled(obj)
+}
+
+// offlineReader serves Namespaces and ServiceAccounts to Handlers which run
+// without a cluster
+type offlineReader struct {
+	namespaces      map[string]*corev1.Namespace
+	serviceAccounts map[types.NamespacedName]*corev1.ServiceAccount
+}
+
+// Get returns the Namespace or ServiceAccount. Unknown Namespaces are returned
+// as empty Namespaces, unknown ServiceAccounts are not found.
+func (r offlineReader) Get(_ context.Context, key client.ObjectKey, obj client.Object, _ ...client.GetOption) error {
+	switch o := obj.(type) {
+	case *corev1.Namespace:
+		if known, ok := r.namespaces[key.Name]; ok {
+			known.DeepCopyInto(o)
+			return nil
+		}
+		*o = corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: key.Name}}
+		return nil
+	case *corev1.ServiceAccount:
+		if known, ok := r.serviceAccounts[key]; ok {
+			known.DeepCopyInto(o)
+			return nil
+		}
+		return errors.NewNotFound(corev1.Resource("serviceaccounts"), key.Name)
+	}
+	return fmt.Errorf("unsupported type %T", obj)
+}
+
+// List is not supported without a cluster
+func (r offlineReader) List(_ context.Context, list client.ObjectList, _ ...client.ListOption) error {
+	return fmt.Errorf("unsupported list %T", list)
+}
+
+// CalculateWorkloadConfigHash calculates the configuration hash of a
+// Deployment, StatefulSet or DaemonSet from the ConfigMaps and Secrets of the
+// manifests the same way the controller does with the given options, e.g. to
+// set the ConfigHashAnnotation before the workload is applied. References the
+// controller ignores, like cross-namespace references which are not allowed,
+// are not hashed and image pull Secrets are hashed if the workload opts in.
+// It also returns the references which could not be resolved from the
+// manifests.
+func CalculateWorkloadConfigHash(obj client.Object, opts HandlerOptions, manifests Manifests) (string, []string, error) {
+	configMapsConfig, secretsConfig := newOfflineInspector(opts, manifests).referencedChildren(obj)
+
+	configMapsByName := make(map[types.NamespacedName]*corev1.ConfigMap)
+	for _, cm := range manifests.ConfigMaps {
+		configMapsByName[GetNamespacedNameFromObject(cm)] = cm
+	}
+	secretsByName := make(map[types.NamespacedName]*corev1.Secret)
+	for _, s := range manifests.Secrets {
+		secretsByName[GetNamespacedNameFromObject(s)] = s
+	}
+
+	unresolved := []string{}
+	seen := make(map[string]bool)
+	addUnresolved := func(kind string, child configMetadata) {
+		ref := fmt.Sprintf("%s %s/%s", kind, child.name.Namespace, child.name.Name)
+		if !child.required {
+			ref += " (optional)"
+		}
+		if !seen[ref] {
+			seen[ref] = true
+			unresolved = append(unresolved, ref)
+		}
+	}
+	for _, child := range configMapsConfig {
+		if _, ok := configMapsByName[child.name]; !ok {
+			addUnresolved(configMapKind, child)
+		}
+	}
+	for _, child := range secretsConfig {
+		if _, ok := secretsByName[child.name]; !ok {
+			addUnresolved(secretKind, child)
+		}
+	}
+
+	hash, err := calculateConfigHash(configMapsByName, secretsByName, configMapsConfig, secretsConfig)
+	if err != nil {
+		return "", nil, fmt.Errorf("error calculating configuration hash: %v", err)
+	}
+	return hash, unresolved, nil
+}
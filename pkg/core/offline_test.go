@@ -0,0 +1,189 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Wave offline hash Suite", func() {
+	var deploymentObject *appsv1.Deployment
+	var configMaps []*corev1.ConfigMap
+	var secrets []*corev1.Secret
+	var manifests Manifests
+
+	BeforeEach(func() {
+		deploymentObject = utils.ExampleDeployment.DeepCopy()
+		configMaps = []*corev1.ConfigMap{
+			utils.ExampleConfigMap1.DeepCopy(),
+			utils.ExampleConfigMap2.DeepCopy(),
+			utils.ExampleConfigMap3.DeepCopy(),
+			utils.ExampleConfigMap4.DeepCopy(),
+			utils.ExampleConfigMap5.DeepCopy(),
+			utils.ExampleConfigMap6.DeepCopy(),
+		}
+		secrets = []*corev1.Secret{
+			utils.ExampleSecret1.DeepCopy(),
+			utils.ExampleSecret2.DeepCopy(),
+			utils.ExampleSecret3.DeepCopy(),
+			utils.ExampleSecret4.DeepCopy(),
+			utils.ExampleSecret5.DeepCopy(),
+			utils.ExampleSecret6.DeepCopy(),
+		}
+		manifests = Manifests{ConfigMaps: configMaps, Secrets: secrets}
+	})
+
+	It("calculates the same hash as the controller", func() {
+		configMapsConfig, secretsConfig := getChildNamesByType(deploymentObject)
+		configMapsByName := map[types.NamespacedName]*corev1.ConfigMap{}
+		for _, cm := range configMaps {
+			configMapsByName[GetNamespacedNameFromObject(cm)] = cm
+		}
+		secretsByName := map[types.NamespacedName]*corev1.Secret{}
+		for _, s := range secrets {
+			secretsByName[GetNamespacedNameFromObject(s)] = s
+		}
+		expected, err := calculateConfigHash(configMapsByName, secretsByName, configMapsConfig, secretsConfig)
+		Expect(err).NotTo(HaveOccurred())
+
+		hash, _, err := CalculateWorkloadConfigHash(deploymentObject, HandlerOptions{}, manifests)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hash).To(Equal(expected))
+	})
+
+	It("reports unresolved references", func() {
+		_, unresolved, err := CalculateWorkloadConfigHash(deploymentObject, HandlerOptions{}, Manifests{ConfigMaps: configMaps[1:], Secrets: secrets})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(unresolved).To(ContainElements(
+			"configmap default/example1",
+			"configmap default/volume-optional (optional)",
+		))
+		Expect(unresolved).NotTo(ContainElement("configmap default/example2"))
+	})
+
+	DescribeTable("considers workloads enabled like the controller",
+		func(annotations map[string]string, opts HandlerOptions, namespaceLabels map[string]string, expected bool) {
+			for key, value := range annotations {
+				deploymentObject.Annotations[key] = value
+			}
+			namespace := &corev1.Namespace{}
+			namespace.SetName(deploymentObject.GetNamespace())
+			namespace.SetLabels(namespaceLabels)
+			Expect(IsWaveEnabled(deploymentObject, opts, Manifests{Namespaces: []*corev1.Namespace{namespace}})).To(Equal(expected))
+		},
+		Entry("without the required annotation", nil, HandlerOptions{}, nil, false),
+		Entry("with the required annotation", map[string]string{RequiredAnnotation: "true"}, HandlerOptions{}, nil, true),
+		Entry("in opt-out mode", nil, HandlerOptions{DefaultMode: DefaultModeOptOut}, nil, true),
+		Entry("opted out in opt-out mode", map[string]string{RequiredAnnotation: "false"}, HandlerOptions{DefaultMode: DefaultModeOptOut}, nil, false),
+		Entry("in a namespace which opted in", nil, HandlerOptions{NamespaceOptIn: true}, map[string]string{RequiredAnnotation: "true"}, true),
+		Entry("in a namespace which did not opt in", nil, HandlerOptions{NamespaceOptIn: true}, nil, false),
+		Entry("of another controller class", map[string]string{RequiredAnnotation: "true", ControllerClassAnnotation: "team-a"}, HandlerOptions{}, nil, false),
+		Entry("of the controller class", map[string]string{RequiredAnnotation: "true", ControllerClassAnnotation: "team-a"}, HandlerOptions{ControllerClass: "team-a"}, nil, true),
+		Entry("not matching the workload selector", map[string]string{RequiredAnnotation: "true"}, HandlerOptions{WorkloadSelector: labels.SelectorFromSet(labels.Set{"wave": "enabled"})}, nil, false),
+	)
+
+	It("treats unknown namespaces as namespaces without labels", func() {
+		Expect(IsWaveEnabled(deploymentObject, HandlerOptions{NamespaceOptIn: true}, Manifests{})).To(BeFalse())
+	})
+
+	Context("with options which change the references the controller hashes", func() {
+		BeforeEach(func() {
+			deploymentObject.Annotations[ExtraConfigMapsAnnotation] = "shared/config,other/config"
+			deploymentObject.Annotations[ImagePullSecretsAnnotation] = requiredAnnotationValue
+			deploymentObject.Spec.Template.Spec.ServiceAccountName = "app"
+			deploymentObject.Spec.Template.Spec.ImagePullSecrets = []corev1.LocalObjectReference{{Name: "pod-pull"}}
+			for _, namespace := range []string{"shared", "other"} {
+				manifests.ConfigMaps = append(manifests.ConfigMaps, &corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{Name: "config", Namespace: namespace},
+					Data:       map[string]string{"key": namespace},
+				})
+			}
+			for _, name := range []string{"pod-pull", "sa-pull"} {
+				manifests.Secrets = append(manifests.Secrets, &corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: deploymentObject.GetNamespace()},
+					Data:       map[string][]byte{".dockerconfigjson": []byte(name)},
+				})
+			}
+			manifests.ServiceAccounts = []*corev1.ServiceAccount{{
+				ObjectMeta:       metav1.ObjectMeta{Name: "app", Namespace: deploymentObject.GetNamespace()},
+				ImagePullSecrets: []corev1.LocalObjectReference{{Name: "sa-pull"}},
+			}}
+		})
+
+		// controllerHash calculates the hash like the controller does from a
+		// cluster with the objects of the manifests
+		controllerHash := func(opts HandlerOptions) string {
+			objects := []client.Object{}
+			for _, cm := range manifests.ConfigMaps {
+				objects = append(objects, cm)
+			}
+			for _, s := range manifests.Secrets {
+				objects = append(objects, s)
+			}
+			for _, sa := range manifests.ServiceAccounts {
+				objects = append(objects, sa)
+			}
+			h := NewHandler[*appsv1.Deployment](fake.NewClientBuilder().WithObjects(objects...).Build(), record.NewFakeRecorder(10), opts)
+			configMapsConfig, secretsConfig, _ := h.referencedChildren(deploymentObject)
+			current, currentSecrets, err := h.getCurrentChildren(configMapsConfig, secretsConfig)
+			Expect(err).NotTo(HaveOccurred())
+			hash, err := calculateConfigHash(current, currentSecrets, configMapsConfig, secretsConfig)
+			Expect(err).NotTo(HaveOccurred())
+			return hash
+		}
+
+		DescribeTable("calculates the same hash as the controller",
+			func(opts func() HandlerOptions) {
+				hash, _, err := CalculateWorkloadConfigHash(deploymentObject, opts(), manifests)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(hash).To(Equal(controllerHash(opts())))
+
+				defaultHash, _, err := CalculateWorkloadConfigHash(deploymentObject, HandlerOptions{}, manifests)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(hash).NotTo(Equal(defaultHash))
+			},
+			Entry("with --cross-namespace-references", func() HandlerOptions {
+				policy, err := ParseCrossNamespacePolicy("default=shared")
+				Expect(err).NotTo(HaveOccurred())
+				return HandlerOptions{CrossNamespacePolicy: policy}
+			}),
+			Entry("with --namespaces and the report policy", func() HandlerOptions {
+				return HandlerOptions{WatchedNamespaces: []string{"default", "shared"}}
+			}),
+			Entry("with --watch-image-pull-secrets", func() HandlerOptions {
+				return HandlerOptions{WatchImagePullSecrets: true}
+			}),
+		)
+
+		It("hashes the image pull Secrets of unknown ServiceAccounts like missing ones", func() {
+			manifests.ServiceAccounts = nil
+			hash, _, err := CalculateWorkloadConfigHash(deploymentObject, HandlerOptions{WatchImagePullSecrets: true}, manifests)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(hash).To(Equal(controllerHash(HandlerOptions{WatchImagePullSecrets: true})))
+		})
+	})
+})
@@ -0,0 +1,162 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// managedAnnotations are set on workloads by Wave and removed when a
+// workload opts out
+var managedAnnotations = []string{
+	BlastRadiusPendingAnnotation,
+	MissingChildrenAnnotation,
+	RehashRequestedAnnotation,
+	RolloutStatusAnnotation,
+	RolloutTriggerAnnotation,
+	SchedulingDisabledSinceAnnotation,
+	SchedulingDisabledByAnnotation,
+	UnreadableChildrenAnnotation,
+}
+
+// cleanupInstance restores scheduling and the references to snapshotted
+// children and removes the annotations set by Wave. With stripHash the config
+// hash is removed as well, but only if the pod template changes anyway so that
+// no rollout is triggered. It returns whether scheduling was restored and
+// whether the instance changed.
+func cleanupInstance[I InstanceType](instance I, stripHash bool) (bool, bool) {
+	changed := false
+	annotations := instance.GetAnnotations()
+	for _, key := range managedAnnotations {
+		if _, ok := annotations[key]; ok {
+			delete(annotations, key)
+			changed = true
+		}
+	}
+	instance.SetAnnotations(annotations)
+
+	restoredSources := restoreSnapshotSources(instance)
+	restored := isSchedulingDisabled(instance)
+	if !restored && !restoredSources {
+		return false, changed
+	}
+	if restored {
+		restoreScheduling(instance)
+	}
+	if stripHash {
+		podTemplate := GetPodTemplate(instance)
+		delete(podTemplate.Annotations, ConfigHashAnnotation)
+		SetPodTemplate(instance, podTemplate)
+	}
+	return restored, true
+}
+
+// optOut cleans up an instance which is not enabled for Wave (anymore)
+func (h *Handler[I]) optOut(ctx context.Context, instance I) (reconcile.Result, error) {
+	log := logf.Log.WithName("wave").WithValues("namespace", instance.GetNamespace(), "name", instance.GetName())
+
+	gated := hasSchedulingGate(&GetPodTemplate(instance).Spec)
+	snapshotted := hasSnapshotReferences(instance)
+	restored, changed := cleanupInstance(instance, h.stripHashOnOptOut)
+	if !changed {
+		return reconcile.Result{}, nil
+	}
+
+	message := "Removed Wave annotations since Wave is disabled for this workload"
+	switch {
+	case restored:
+		message = "Restored scheduling since Wave is disabled for this workload"
+	case snapshotted:
+		message = "Restored the references to the snapshotted children since Wave is disabled for this workload"
+	}
+	if h.dryRun {
+		log.V(0).Info("Would clean up instance since Wave is disabled", "restoreScheduling", restored, "restoreReferences", snapshotted, "dryRun", true)
+		h.recorder.Eventf(instance, corev1.EventTypeNormal, "DryRunWaveDisabled", "Would clean up: %s", message)
+		return reconcile.Result{}, nil
+	}
+
+	log.V(0).Info("Cleaning up instance since Wave is disabled", "restoreScheduling", restored, "restoreReferences", snapshotted)
+	if err := h.updateThrottler.Wait(ctx, GetNamespacedNameFromObject(instance)); err != nil {
+		return reconcile.Result{}, fmt.Errorf("error waiting for rate limit: %v", err)
+	}
+	if err := h.Update(ctx, instance); err != nil {
+		return reconcile.Result{}, fmt.Errorf("error updating instance %s/%s: %v", instance.GetNamespace(), instance.GetName(), err)
+	}
+	h.recorder.Eventf(instance, corev1.EventTypeNormal, "WaveDisabled", message)
+	if restored && gated {
+		if err := h.clearSchedulingGates(ctx, instance); err != nil {
+			log.Error(err, "Unable to remove scheduling gates from pending pods")
+		}
+	}
+	return reconcile.Result{}, nil
+}
+
+// cleanupAll cleans up all workloads of the Handler's kind in the watched
+// namespaces as if they opted out
+func (h *Handler[I]) cleanupAll(ctx context.Context, list client.ObjectList) error {
+	namespaces := []string{""}
+	if h.watchedNamespaces != nil {
+		namespaces = []string{}
+		for namespace := range h.watchedNamespaces {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+
+	var errs []error
+	for _, namespace := range namespaces {
+		listOpts := []client.ListOption{client.InNamespace(namespace)}
+		if h.workloadSelector != nil {
+			listOpts = append(listOpts, client.MatchingLabelsSelector{Selector: h.workloadSelector})
+		}
+		if err := h.apiReader.List(ctx, list, listOpts...); err != nil {
+			return fmt.Errorf("error listing %ss: %v", h.kind, err)
+		}
+		items, err := meta.ExtractList(list)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			if !h.ownsInstance(item.(I)) {
+				continue
+			}
+			if _, err := h.optOut(ctx, item.(I)); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Cleanup restores scheduling and removes the annotations set by Wave from
+// all workloads, e.g. before Wave is uninstalled
+func Cleanup(ctx context.Context, c client.Client, r record.EventRecorder, opts HandlerOptions) error {
+	return errors.Join(
+		NewHandler[*appsv1.Deployment](c, r, opts).cleanupAll(ctx, &appsv1.DeploymentList{}),
+		NewHandler[*appsv1.StatefulSet](c, r, opts).cleanupAll(ctx, &appsv1.StatefulSetList{}),
+		NewHandler[*appsv1.DaemonSet](c, r, opts).cleanupAll(ctx, &appsv1.DaemonSetList{}),
+	)
+}
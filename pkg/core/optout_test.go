@@ -0,0 +1,154 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"math"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	"golang.org/x/time/rate"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Wave opt-out Suite", func() {
+	var deploymentObject *appsv1.Deployment
+
+	BeforeEach(func() {
+		deploymentObject = utils.ExampleDeployment.DeepCopy()
+		setConfigHash(deploymentObject, "hash")
+		deploymentObject.Annotations[RolloutStatusAnnotation] = RolloutSucceeded
+	})
+
+	Context("cleanupInstance", func() {
+		It("removes the annotations set by Wave", func() {
+			restored, changed := cleanupInstance(deploymentObject, true)
+			Expect(restored).To(BeFalse())
+			Expect(changed).To(BeTrue())
+			Expect(deploymentObject.Annotations).NotTo(HaveKey(RolloutStatusAnnotation))
+			Expect(getConfigHash(deploymentObject)).To(Equal("hash"))
+		})
+
+		It("restores scheduling and strips the hash", func() {
+			disableScheduling(deploymentObject)
+			restored, changed := cleanupInstance(deploymentObject, true)
+			Expect(restored).To(BeTrue())
+			Expect(changed).To(BeTrue())
+			Expect(isSchedulingDisabled(deploymentObject)).To(BeFalse())
+			Expect(GetPodTemplate(deploymentObject).Spec.SchedulerName).To(Equal("default-scheduler"))
+			Expect(getConfigHash(deploymentObject)).To(BeEmpty())
+		})
+
+		It("keeps the hash unless configured otherwise", func() {
+			disableScheduling(deploymentObject)
+			cleanupInstance(deploymentObject, false)
+			Expect(getConfigHash(deploymentObject)).To(Equal("hash"))
+		})
+
+		It("restores the references to snapshotted children", func() {
+			h := NewHandler[*appsv1.Deployment](nil, record.NewFakeRecorder(10), HandlerOptions{EnableSnapshots: true})
+			cm := utils.ExampleConfigMap1.DeepCopy()
+			s := utils.ExampleSecret1.DeepCopy()
+			Expect(h.applySnapshots(context.TODO(), deploymentObject, deploymentObject, map[types.NamespacedName]*corev1.ConfigMap{GetNamespacedNameFromObject(cm): cm}, map[types.NamespacedName]*corev1.Secret{GetNamespacedNameFromObject(s): s}, "hash", false)).To(Succeed())
+
+			restored, changed := cleanupInstance(deploymentObject, true)
+			Expect(restored).To(BeFalse())
+			Expect(changed).To(BeTrue())
+			Expect(deploymentObject.Spec.Template.Spec).To(Equal(utils.ExampleDeployment.Spec.Template.Spec))
+			Expect(deploymentObject.Annotations).NotTo(HaveKey(SnapshotHashAnnotation))
+			Expect(deploymentObject.Spec.Template.Annotations).NotTo(HaveKey(ConfigSnapshotsAnnotation))
+			Expect(getConfigHash(deploymentObject)).To(BeEmpty())
+		})
+
+		It("does not change workloads Wave never touched", func() {
+			delete(deploymentObject.Annotations, RolloutStatusAnnotation)
+			_, changed := cleanupInstance(deploymentObject, true)
+			Expect(changed).To(BeFalse())
+		})
+	})
+
+	It("leaves workloads of other controller classes alone", func() {
+		deploymentObject.Annotations[ControllerClassAnnotation] = "team-a"
+		c := fake.NewClientBuilder().WithObjects(deploymentObject).Build()
+		h := NewHandler[*appsv1.Deployment](c, record.NewFakeRecorder(10), HandlerOptions{})
+		_, err := h.Handle(context.TODO(), GetNamespacedNameFromObject(deploymentObject), &appsv1.Deployment{})
+		Expect(err).NotTo(HaveOccurred())
+
+		updated := &appsv1.Deployment{}
+		Expect(c.Get(context.TODO(), GetNamespacedNameFromObject(deploymentObject), updated)).To(Succeed())
+		Expect(updated.Annotations).To(HaveKeyWithValue(RolloutStatusAnnotation, RolloutSucceeded))
+	})
+
+	It("restores scheduling after the controller class of a workload changes", func() {
+		deploymentObject.Annotations[RequiredAnnotation] = requiredAnnotationValue
+		h := NewHandler[*appsv1.Deployment](nil, record.NewFakeRecorder(10), HandlerOptions{})
+		h.blockScheduling(deploymentObject)
+		deploymentObject.Annotations[ControllerClassAnnotation] = "team-a"
+		c := fake.NewClientBuilder().WithObjects(deploymentObject).Build()
+		h = NewHandler[*appsv1.Deployment](c, record.NewFakeRecorder(10), HandlerOptions{
+			UpdateThrottler: NewUpdateThrottler(rate.Limit(math.Inf(1)), 1),
+		})
+		_, err := h.Handle(context.TODO(), GetNamespacedNameFromObject(deploymentObject), &appsv1.Deployment{})
+		Expect(err).NotTo(HaveOccurred())
+
+		updated := &appsv1.Deployment{}
+		Expect(c.Get(context.TODO(), GetNamespacedNameFromObject(deploymentObject), updated)).To(Succeed())
+		Expect(isSchedulingDisabled(updated)).To(BeFalse())
+		Expect(GetPodTemplate(updated).Spec.SchedulerName).To(Equal("default-scheduler"))
+		Expect(updated.Annotations).NotTo(HaveKey(SchedulingDisabledByAnnotation))
+		Expect(updated.Annotations).NotTo(HaveKey(RolloutStatusAnnotation))
+	})
+
+	It("cleans up workloads which no longer match the workload selector", func() {
+		deploymentObject.Annotations[RequiredAnnotation] = requiredAnnotationValue
+		disableScheduling(deploymentObject)
+		c := fake.NewClientBuilder().WithObjects(deploymentObject).Build()
+		h := NewHandler[*appsv1.Deployment](c, record.NewFakeRecorder(10), HandlerOptions{
+			UpdateThrottler:  NewUpdateThrottler(rate.Limit(math.Inf(1)), 1),
+			WorkloadSelector: labels.SelectorFromSet(labels.Set{"wave": "enabled"}),
+		})
+		_, err := h.Handle(context.TODO(), GetNamespacedNameFromObject(deploymentObject), &appsv1.Deployment{})
+		Expect(err).NotTo(HaveOccurred())
+
+		updated := &appsv1.Deployment{}
+		Expect(c.Get(context.TODO(), GetNamespacedNameFromObject(deploymentObject), updated)).To(Succeed())
+		Expect(isSchedulingDisabled(updated)).To(BeFalse())
+	})
+
+	It("cleans up all workloads", func() {
+		deploymentObject.Annotations[RequiredAnnotation] = requiredAnnotationValue
+		disableScheduling(deploymentObject)
+		c := fake.NewClientBuilder().WithObjects(deploymentObject).Build()
+		recorder := record.NewFakeRecorder(10)
+		Expect(Cleanup(context.TODO(), c, recorder, HandlerOptions{
+			UpdateThrottler: NewUpdateThrottler(rate.Limit(math.Inf(1)), 1),
+		})).To(Succeed())
+
+		updated := &appsv1.Deployment{}
+		Expect(c.Get(context.TODO(), GetNamespacedNameFromObject(deploymentObject), updated)).To(Succeed())
+		Expect(isSchedulingDisabled(updated)).To(BeFalse())
+		Expect(updated.Annotations).NotTo(HaveKey(RolloutStatusAnnotation))
+		Expect(recorder.Events).To(Receive(ContainSubstring("WaveDisabled")))
+	})
+})
@@ -0,0 +1,220 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// DependencyProtector checks deletes and updates of ConfigMaps and Secrets
+// against the required references of the workloads of the Handlers of all
+// kinds
+type DependencyProtector struct {
+	mode     ValidationMode
+	mutex    sync.Mutex
+	handlers []dependentsChecker
+}
+
+// dependentsChecker is implemented by the Handler of every kind
+type dependentsChecker interface {
+	brokenDependents(ctx context.Context, kind string, oldObj Object, newObj Object) ([]string, error)
+}
+
+// NewDependencyProtector constructs a new DependencyProtector. Breaking
+// changes are rejected or returned as warnings depending on the mode.
+func NewDependencyProtector(mode ValidationMode) *DependencyProtector {
+	return &DependencyProtector{mode: mode}
+}
+
+// addHandler adds the watched children of a Handler to the protection
+func (p *DependencyProtector) addHandler(h dependentsChecker) {
+	if p == nil {
+		return
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.handlers = append(p.handlers, h)
+}
+
+// Validate checks the change of a ConfigMap or Secret from oldObj to newObj.
+// newObj is nil if the child is deleted.
+func (p *DependencyProtector) Validate(ctx context.Context, oldObj Object, newObj Object) ([]string, error) {
+	var kind, resource string
+	switch oldObj.(type) {
+	case *corev1.ConfigMap:
+		kind, resource = configMapKind, "configmaps"
+	case *corev1.Secret:
+		kind, resource = secretKind, "secrets"
+	default:
+		return nil, nil
+	}
+	if hasDependencyProtectionOverride(oldObj) || (newObj != nil && hasDependencyProtectionOverride(newObj)) {
+		return nil, nil
+	}
+
+	p.mutex.Lock()
+	handlers := append([]dependentsChecker{}, p.handlers...)
+	p.mutex.Unlock()
+
+	broken := []string{}
+	for _, h := range handlers {
+		dependents, err := h.brokenDependents(ctx, kind, oldObj, newObj)
+		if err != nil {
+			return []string{fmt.Sprintf("unable to check workloads referencing %s %s/%s: %v", kind, oldObj.GetNamespace(), oldObj.GetName(), err)}, nil
+		}
+		broken = append(broken, dependents...)
+	}
+	if len(broken) == 0 {
+		return nil, nil
+	}
+	sort.Strings(broken)
+
+	action := "updating"
+	if newObj == nil {
+		action = "deleting"
+	}
+	message := fmt.Sprintf("%s %s %s/%s would break required references of %s; set the annotation %s: \"true\" to override",
+		action, kind, oldObj.GetNamespace(), oldObj.GetName(), strings.Join(broken, ", "), DependencyProtectionOverrideAnnotation)
+	if p.mode == ValidationModeReject {
+		return nil, errors.NewForbidden(schema.GroupResource{Resource: resource}, oldObj.GetName(), fmt.Errorf("%s", message))
+	}
+	return []string{message}, nil
+}
+
+// hasDependencyProtectionOverride returns true if the child may break
+// required references
+func hasDependencyProtectionOverride(obj Object) bool {
+	return obj.GetAnnotations()[DependencyProtectionOverrideAnnotation] == requiredAnnotationValue
+}
+
+// brokenDependents returns the workloads referencing the child whose required
+// references are satisfied by oldObj but not by newObj. newObj is nil if the
+// child is deleted.
+func (h *Handler[I]) brokenDependents(ctx context.Context, kind string, oldObj Object, newObj Object) ([]string, error) {
+	name := GetNamespacedNameFromObject(oldObj)
+	candidates, err := h.dependentCandidates(ctx, kind, name)
+	if err != nil {
+		return nil, err
+	}
+
+	broken := []string{}
+	for _, instance := range candidates {
+		if !h.isEnabled(instance) {
+			continue
+		}
+		workload := GetNamespacedNameFromObject(instance)
+
+		configMapsConfig, secretsConfig, _ := h.referencedChildren(instance)
+		refs := configMetadataList{}
+		children := configMapsConfig
+		if kind == secretKind {
+			children = secretsConfig
+		}
+		for _, child := range children {
+			if child.name == name {
+				refs = append(refs, child)
+			}
+		}
+
+		satisfied := func(child Object) bool {
+			configMaps := map[types.NamespacedName]*corev1.ConfigMap{}
+			secrets := map[types.NamespacedName]*corev1.Secret{}
+			switch c := child.(type) {
+			case *corev1.ConfigMap:
+				configMaps[name] = c
+			case *corev1.Secret:
+				secrets[name] = c
+			}
+			if kind == secretKind {
+				return h.checkRequiredChildren(configMaps, secrets, configMetadataList{}, refs) == nil
+			}
+			return h.checkRequiredChildren(configMaps, secrets, refs, configMetadataList{}) == nil
+		}
+		if satisfied(oldObj) && !satisfied(newObj) {
+			broken = append(broken, fmt.Sprintf("%s %s", strings.ToLower(h.kind), workload))
+		}
+	}
+	return broken, nil
+}
+
+// dependentCandidates returns the workloads which may reference the child.
+// The watches are only populated by the reconciles of the leader while
+// admission requests reach every replica, so the workloads in the namespace of
+// the child are listed from the cache. Workloads in other namespaces are
+// taken from the watches since listing all namespaces on every change of a
+// child is too expensive.
+func (h *Handler[I]) dependentCandidates(ctx context.Context, kind string, name types.NamespacedName) ([]I, error) {
+	list, err := newWorkloadList(h.kind)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.List(ctx, list, client.InNamespace(name.Namespace)); err != nil {
+		return nil, fmt.Errorf("error listing %ss: %v", h.kind, err)
+	}
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return nil, err
+	}
+	candidates := []I{}
+	seen := make(map[types.NamespacedName]bool)
+	for _, item := range items {
+		if instance, ok := item.(I); ok {
+			candidates = append(candidates, instance)
+			seen[GetNamespacedNameFromObject(instance)] = true
+		}
+	}
+
+	watched := h.watchedConfigmaps
+	if kind == secretKind {
+		watched = h.watchedSecrets
+	}
+	watched.watchersMutex.RLock()
+	workloads := []types.NamespacedName{}
+	for workload := range watched.watchers[name] {
+		if !seen[workload] {
+			workloads = append(workloads, workload)
+		}
+	}
+	watched.watchersMutex.RUnlock()
+
+	for _, workload := range workloads {
+		obj, err := newWorkload(h.kind)
+		if err != nil {
+			return nil, err
+		}
+		instance := obj.(I)
+		if err := h.Get(ctx, workload, instance); err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		candidates = append(candidates, instance)
+	}
+	return candidates, nil
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Wave dependency protection Suite", func() {
+	var p *DependencyProtector
+	var c client.Client
+	var cm *corev1.ConfigMap
+	var defaults []ReferenceExtractor
+
+	BeforeEach(func() {
+		// References children in other namespaces like custom extractors can
+		defaults = ReferenceExtractors
+		ReferenceExtractors = append(ReferenceExtractors[:len(ReferenceExtractors):len(ReferenceExtractors)], ReferenceExtractorFunc(func(obj metav1.Object, _ *corev1.PodTemplateSpec) []ChildReference {
+			if shared, ok := obj.GetAnnotations()["example.com/shared-config"]; ok {
+				return []ChildReference{{Kind: ConfigMapKind, Name: types.NamespacedName{Namespace: "default", Name: shared}, Required: true}}
+			}
+			return nil
+		}))
+
+		deploymentObject := utils.ExampleDeployment.DeepCopy()
+		deploymentObject.Annotations[RequiredAnnotation] = requiredAnnotationValue
+		other := utils.ExampleDeployment.DeepCopy()
+		other.SetNamespace("other")
+		other.Annotations[RequiredAnnotation] = requiredAnnotationValue
+		other.Annotations["example.com/shared-config"] = "shared"
+		c = fake.NewClientBuilder().WithObjects(deploymentObject, other).Build()
+
+		p = NewDependencyProtector(ValidationModeReject)
+		h := NewHandler[*appsv1.Deployment](c, record.NewFakeRecorder(10), HandlerOptions{DependencyProtector: p})
+		configMapsConfig, secretsConfig := getChildNamesByType(deploymentObject)
+		h.watchChildrenForInstance(deploymentObject, configMapsConfig, secretsConfig)
+		configMapsConfig, secretsConfig, _ = h.referencedChildren(other)
+		h.watchChildrenForInstance(other, configMapsConfig, secretsConfig)
+
+		cm = utils.ExampleConfigMap1.DeepCopy()
+	})
+
+	AfterEach(func() {
+		ReferenceExtractors = defaults
+	})
+
+	It("rejects deleting a required child", func() {
+		_, err := p.Validate(context.TODO(), cm, nil)
+		Expect(errors.IsForbidden(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("deleting configmap default/example1 would break required references of deployment default/example"))
+	})
+
+	It("rejects deleting a required child on replicas which did not reconcile its workloads", func() {
+		standby := NewDependencyProtector(ValidationModeReject)
+		NewHandler[*appsv1.Deployment](c, record.NewFakeRecorder(10), HandlerOptions{DependencyProtector: standby})
+		_, err := standby.Validate(context.TODO(), cm, nil)
+		Expect(errors.IsForbidden(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("deployment default/example"))
+	})
+
+	It("rejects deleting a required child of a workload in another namespace", func() {
+		cm.SetName("shared")
+		_, err := p.Validate(context.TODO(), cm, nil)
+		Expect(errors.IsForbidden(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("deployment other/example"))
+	})
+
+	It("rejects removing a required key", func() {
+		updated := cm.DeepCopy()
+		delete(updated.Data, "key1")
+		_, err := p.Validate(context.TODO(), cm, updated)
+		Expect(errors.IsForbidden(err)).To(BeTrue())
+	})
+
+	It("allows removing a key which is not required", func() {
+		updated := cm.DeepCopy()
+		delete(updated.Data, "key3")
+		warnings, err := p.Validate(context.TODO(), cm, updated)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(warnings).To(BeEmpty())
+	})
+
+	It("allows deleting a child which is not watched", func() {
+		cm.SetName("unreferenced")
+		_, err := p.Validate(context.TODO(), cm, nil)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("allows breaking changes with the override annotation", func() {
+		cm.SetAnnotations(map[string]string{DependencyProtectionOverrideAnnotation: "true"})
+		_, err := p.Validate(context.TODO(), cm, nil)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("returns warnings in warn mode", func() {
+		p.mode = ValidationModeWarn
+		warnings, err := p.Validate(context.TODO(), cm, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(warnings).To(HaveLen(1))
+		Expect(warnings[0]).To(ContainSubstring("deployment default/example"))
+	})
+})
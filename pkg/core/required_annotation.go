@@ -16,6 +16,22 @@ limitations under the License.
 
 package core
 
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
 // hasRequiredAnnotation returns true if the given PodController has the wave
 // annotation present
 func hasRequiredAnnotation[I InstanceType](obj I) bool {
@@ -27,3 +43,147 @@ func hasRequiredAnnotation[I InstanceType](obj I) bool {
 	}
 	return false
 }
+
+// ownsInstance returns true if the instance belongs to this Wave
+// installation, i.e. it has the same controller class, matches the workload
+// selector and is in a managed namespace. Other workloads must not be touched.
+func (h *Handler[I]) ownsInstance(instance I) bool {
+	if controllerClassOf(instance) != h.controllerClass {
+		return false
+	}
+	if h.workloadSelector != nil && !h.workloadSelector.Matches(labels.Set(instance.GetLabels())) {
+		return false
+	}
+	return h.managesNamespace(instance.GetNamespace())
+}
+
+// releasesInstance returns true if this installation has to clean up after
+// an instance it no longer owns. That is the case if the instance still has
+// the controller class of this installation, i.e. it stopped matching the
+// workload selector or the namespace filter, or if this installation
+// disabled its scheduling before its controller class changed.
+func (h *Handler[I]) releasesInstance(instance I) bool {
+	return controllerClassOf(instance) == h.controllerClass ||
+		instance.GetAnnotations()[SchedulingDisabledByAnnotation] == EventSource(h.controllerClass)
+}
+
+// controllerClassOf returns the controller class of the workload from its
+// annotation or, if it has none, from its label
+func controllerClassOf(obj metav1.Object) string {
+	if class, ok := obj.GetAnnotations()[ControllerClassAnnotation]; ok {
+		return class
+	}
+	return obj.GetLabels()[ControllerClassLabel]
+}
+
+// isEnabled returns true if Wave manages the instance. Only workloads owned
+// by this installation are considered. Their annotation takes precedence
+// over the default mode and the opt-in of their namespace, so "false" opts a
+// workload out.
+func (h *Handler[I]) isEnabled(instance I) bool {
+	if !h.ownsInstance(instance) {
+		return false
+	}
+	switch instance.GetAnnotations()[RequiredAnnotation] {
+	case requiredAnnotationValue:
+		return true
+	case "false":
+		return false
+	}
+	if h.defaultMode == DefaultModeOptOut {
+		return true
+	}
+	return h.namespaceOptIn && h.namespaceOptedIn(instance.GetNamespace())
+}
+
+// EventSource returns the name Wave records events with for the controller
+// class so that the events of multiple installations can be told apart
+func EventSource(controllerClass string) string {
+	if controllerClass == "" {
+		return "wave"
+	}
+	return "wave-" + controllerClass
+}
+
+// DefaultMode controls whether workloads without the required annotation
+// are managed by Wave
+type DefaultMode string
+
+const (
+	// DefaultModeOptIn only manages workloads which opt in
+	DefaultModeOptIn DefaultMode = "opt-in"
+
+	// DefaultModeOptOut manages all workloads unless they opt out
+	DefaultModeOptOut DefaultMode = "opt-out"
+)
+
+// ParseDefaultMode parses the value of the --default-mode flag
+func ParseDefaultMode(value string) (DefaultMode, error) {
+	switch mode := DefaultMode(value); mode {
+	case DefaultModeOptIn, DefaultModeOptOut:
+		return mode, nil
+	}
+	return "", fmt.Errorf("invalid default mode %q: must be %s or %s", value, DefaultModeOptIn, DefaultModeOptOut)
+}
+
+// namespaceOptedIn returns true if the namespace has the required annotation
+// as a label or an annotation
+func (h *Handler[I]) namespaceOptedIn(name string) bool {
+	namespace := &corev1.Namespace{}
+	if err := h.namespaceReader.Get(context.TODO(), types.NamespacedName{Name: name}, namespace); err != nil {
+		logf.Log.WithName("wave").Error(err, "Unable to get namespace", "namespace", name)
+		return false
+	}
+	return isNamespaceOptedIn(namespace)
+}
+
+// isNamespaceOptedIn returns true if the namespace has the required
+// annotation as a label or an annotation
+func isNamespaceOptedIn(namespace metav1.Object) bool {
+	return namespace.GetLabels()[RequiredAnnotation] == requiredAnnotationValue ||
+		namespace.GetAnnotations()[RequiredAnnotation] == requiredAnnotationValue
+}
+
+// watchesNamespaces returns true if changes of Namespaces can enable or
+// disable workloads
+func (h *Handler[I]) watchesNamespaces() bool {
+	return h.namespaceOptIn || h.namespaceFilter.hasSelector()
+}
+
+// namespaceChanged filters Namespace events to those which may change the
+// opt-in of its workloads or whether the namespace is selected
+func (h *Handler[I]) namespaceChanged() predicate.Funcs {
+	return predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return isNamespaceOptedIn(e.ObjectOld) != isNamespaceOptedIn(e.ObjectNew) ||
+				h.namespaceFilter.selects(e.ObjectOld) != h.namespaceFilter.selects(e.ObjectNew)
+		},
+		DeleteFunc: func(e event.DeleteEvent) bool {
+			return false
+		},
+	}
+}
+
+// requestsForNamespace returns a reconcile.Request for every workload of the
+// Handler's kind in the namespace
+func (h *Handler[I]) requestsForNamespace(ctx context.Context, namespace client.Object) []reconcile.Request {
+	list, err := newWorkloadList(h.kind)
+	if err != nil {
+		return nil
+	}
+	if err := h.List(ctx, list, client.InNamespace(namespace.GetName())); err != nil {
+		logf.Log.WithName("wave").Error(err, "Unable to list workloads", "namespace", namespace.GetName(), "kind", h.kind)
+		return nil
+	}
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return nil
+	}
+	requests := []reconcile.Request{}
+	for _, item := range items {
+		if obj, ok := item.(client.Object); ok {
+			requests = append(requests, reconcile.Request{NamespacedName: GetNamespacedNameFromObject(obj)})
+		}
+	}
+	return requests
+}
@@ -17,10 +17,19 @@ limitations under the License.
 package core
 
 import (
+	"context"
+
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/wave-k8s/wave/test/utils"
 	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
 var _ = Describe("Wave required annotation Suite", func() {
@@ -58,4 +67,94 @@ var _ = Describe("Wave required annotation Suite", func() {
 		})
 
 	})
+
+	Context("isEnabled", func() {
+		var h *Handler[*appsv1.Deployment]
+		var namespace *corev1.Namespace
+
+		BeforeEach(func() {
+			namespace = &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+				Name:   deploymentObject.GetNamespace(),
+				Labels: map[string]string{RequiredAnnotation: requiredAnnotationValue},
+			}}
+			c := fake.NewClientBuilder().WithObjects(namespace, deploymentObject).Build()
+			h = NewHandler[*appsv1.Deployment](c, record.NewFakeRecorder(10), HandlerOptions{NamespaceOptIn: true})
+		})
+
+		It("enables workloads in opted-in namespaces", func() {
+			Expect(h.isEnabled(deploymentObject)).To(BeTrue())
+		})
+
+		It("lets workloads opt out", func() {
+			deploymentObject.Annotations[RequiredAnnotation] = "false"
+			Expect(h.isEnabled(deploymentObject)).To(BeFalse())
+		})
+
+		It("enables all workloads in opt-out mode", func() {
+			h.namespaceOptIn = false
+			h.defaultMode = DefaultModeOptOut
+			Expect(h.isEnabled(deploymentObject)).To(BeTrue())
+			deploymentObject.Annotations[RequiredAnnotation] = "false"
+			Expect(h.isEnabled(deploymentObject)).To(BeFalse())
+		})
+
+		It("ignores workloads not matching the workload selector", func() {
+			deploymentObject.Annotations[RequiredAnnotation] = requiredAnnotationValue
+			h.workloadSelector = labels.SelectorFromSet(labels.Set{"team": "payments"})
+			Expect(h.isEnabled(deploymentObject)).To(BeFalse())
+			deploymentObject.Labels = map[string]string{"team": "payments"}
+			Expect(h.isEnabled(deploymentObject)).To(BeTrue())
+		})
+
+		It("only enables workloads of its controller class", func() {
+			deploymentObject.Annotations[RequiredAnnotation] = requiredAnnotationValue
+			deploymentObject.Annotations[ControllerClassAnnotation] = "team-a"
+			Expect(h.isEnabled(deploymentObject)).To(BeFalse())
+			h.controllerClass = "team-a"
+			Expect(h.isEnabled(deploymentObject)).To(BeTrue())
+		})
+
+		It("takes the controller class from the label if there is no annotation", func() {
+			deploymentObject.Annotations[RequiredAnnotation] = requiredAnnotationValue
+			deploymentObject.Labels[ControllerClassLabel] = "team-a"
+			Expect(h.isEnabled(deploymentObject)).To(BeFalse())
+			h.controllerClass = "team-a"
+			Expect(h.isEnabled(deploymentObject)).To(BeTrue())
+
+			deploymentObject.Annotations[ControllerClassAnnotation] = "team-b"
+			Expect(h.isEnabled(deploymentObject)).To(BeFalse())
+		})
+
+		It("only enables workloads in selected namespaces", func() {
+			deploymentObject.Annotations[RequiredAnnotation] = requiredAnnotationValue
+			filter, err := NewNamespaceFilter(nil, labels.SelectorFromSet(labels.Set{"wave": "enabled"}))
+			Expect(err).NotTo(HaveOccurred())
+			h.namespaceFilter = filter
+			Expect(h.isEnabled(deploymentObject)).To(BeFalse())
+
+			updated := namespace.DeepCopy()
+			updated.Labels["wave"] = "enabled"
+			Expect(h.Update(context.TODO(), updated)).To(Succeed())
+			Expect(h.isEnabled(deploymentObject)).To(BeTrue())
+			Expect(h.namespaceChanged().Update(event.UpdateEvent{ObjectOld: namespace, ObjectNew: updated})).To(BeTrue())
+		})
+
+		It("ignores the namespace without namespace opt-in", func() {
+			h.namespaceOptIn = false
+			Expect(h.isEnabled(deploymentObject)).To(BeFalse())
+		})
+
+		It("enqueues all workloads of the namespace", func() {
+			requests := h.requestsForNamespace(context.TODO(), namespace)
+			Expect(requests).To(ConsistOf(reconcile.Request{NamespacedName: GetNamespacedNameFromObject(deploymentObject)}))
+		})
+
+		It("only passes changes of the opt-in", func() {
+			updated := namespace.DeepCopy()
+			updated.Labels["other"] = "label"
+			Expect(h.namespaceChanged().Update(event.UpdateEvent{ObjectOld: namespace, ObjectNew: updated})).To(BeFalse())
+			delete(updated.Labels, RequiredAnnotation)
+			Expect(h.namespaceChanged().Update(event.UpdateEvent{ObjectOld: namespace, ObjectNew: updated})).To(BeTrue())
+		})
+	})
 })
@@ -0,0 +1,273 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// DefaultRolloutAfterTimeout is the default time a workload waits for its
+	// upstream workloads before Wave proceeds with its rollout
+	DefaultRolloutAfterTimeout = 10 * time.Minute
+
+	// rolloutAfterRequeueInterval is the interval in which a delayed workload
+	// is reconciled again to check its upstream workloads
+	rolloutAfterRequeueInterval = 5 * time.Second
+)
+
+// upstreamRef identifies a workload referenced in the rollout-after annotation
+type upstreamRef struct {
+	kind string
+	name types.NamespacedName
+}
+
+// String returns the upstreamRef in the form kind/namespace/name
+func (u upstreamRef) String() string {
+	return fmt.Sprintf("%s/%s/%s", u.kind, u.name.Namespace, u.name.Name)
+}
+
+// rolloutAfterTracker remembers since when workloads are waiting for their
+// upstream workloads
+type rolloutAfterTracker struct {
+	mutex        sync.Mutex
+	waitingSince map[types.NamespacedName]time.Time
+}
+
+// start records that the workload started waiting unless it is already
+// waiting. It returns the start time and true if the workload just started
+// waiting.
+func (t *rolloutAfterTracker) start(name types.NamespacedName) (time.Time, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if since, ok := t.waitingSince[name]; ok {
+		return since, false
+	}
+	now := time.Now()
+	t.waitingSince[name] = now
+	return now, true
+}
+
+// done records that the workload no longer waits
+func (t *rolloutAfterTracker) done(name types.NamespacedName) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	delete(t.waitingSince, name)
+}
+
+// parseRolloutAfter parses the rollout-after annotation of the object.
+// Entries are in the form kind/name or kind/namespace/name. It returns the
+// valid entries and an error describing the invalid ones.
+func parseRolloutAfter(obj metav1.Object) ([]upstreamRef, error) {
+	value, ok := obj.GetAnnotations()[RolloutAfterAnnotation]
+	if !ok || strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+
+	refs := []upstreamRef{}
+	errs := []error{}
+	for _, entry := range strings.Split(value, ",") {
+		parts := strings.Split(strings.TrimSpace(entry), "/")
+		var ref upstreamRef
+		switch len(parts) {
+		case 2:
+			ref = upstreamRef{kind: parts[0], name: GetNamespacedName(parts[1], obj.GetNamespace())}
+		case 3:
+			ref = upstreamRef{kind: parts[0], name: GetNamespacedName(parts[2], parts[1])}
+		default:
+			errs = append(errs, fmt.Errorf("invalid workload reference %q in annotation %s", entry, RolloutAfterAnnotation))
+			continue
+		}
+		workload, err := newWorkload(ref.kind)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid workload reference %q in annotation %s: %v", entry, RolloutAfterAnnotation, err))
+			continue
+		}
+		// Aliases like deploy are stored as the kind so that references
+		// to the same workload are equal
+		ref.kind = strings.ToLower(kindOf(workload))
+		refs = append(refs, ref)
+	}
+	return refs, utilerrors.NewAggregate(errs)
+}
+
+// sharesChild returns true if both lists reference at least one common child
+func sharesChild(a configMetadataList, b configMetadataList) bool {
+	names := make(map[types.NamespacedName]bool)
+	for _, child := range a {
+		names[child.name] = true
+	}
+	for _, child := range b {
+		if names[child.name] {
+			return true
+		}
+	}
+	return false
+}
+
+// upstreamRefs returns the upstream workloads of the instance which Wave can
+// wait for. Malformed entries, upstreams in namespaces which Wave does not
+// watch and upstreams which wait for the instance themselves are ignored, as
+// if the instance had no such upstream, and reported with a Warning event
+// whenever they change.
+func (h *Handler[I]) upstreamRefs(ctx context.Context, instance I) ([]upstreamRef, error) {
+	refs, err := parseRolloutAfter(instance)
+	ignored := []string{}
+	if agg, ok := err.(utilerrors.Aggregate); ok {
+		for _, e := range agg.Errors() {
+			ignored = append(ignored, e.Error())
+		}
+	}
+
+	self := upstreamRef{kind: strings.ToLower(h.kind), name: GetNamespacedNameFromObject(instance)}
+	valid := []upstreamRef{}
+	for _, ref := range refs {
+		if !h.watchesNamespace(ref.name.Namespace) {
+			ignored = append(ignored, fmt.Sprintf("%s is in a namespace which Wave does not watch", ref))
+			continue
+		}
+		cycle, err := h.waitsFor(ctx, ref, self, map[upstreamRef]bool{})
+		if err != nil {
+			return nil, err
+		}
+		if cycle {
+			ignored = append(ignored, fmt.Sprintf("%s waits for %s itself", ref, self))
+			continue
+		}
+		valid = append(valid, ref)
+	}
+
+	if h.ignoredUpstreams.changed(self.name, ignored) {
+		logf.Log.WithName("wave").WithValues("namespace", instance.GetNamespace(), "name", instance.GetName()).V(1).Info("Ignoring upstream workloads", "upstreams", ignored)
+		h.recorder.Eventf(instance, corev1.EventTypeWarning, "RolloutAfterIgnored", "Ignored rollout-after entries: %s", strings.Join(ignored, ", "))
+	}
+	return valid, nil
+}
+
+// waitsFor returns true if the workload waits for the target directly or
+// through its own upstream workloads, i.e. if waiting for the workload would
+// be a cycle. Workloads which do not exist wait for nothing.
+func (h *Handler[I]) waitsFor(ctx context.Context, ref upstreamRef, target upstreamRef, visited map[upstreamRef]bool) (bool, error) {
+	if ref == target {
+		return true, nil
+	}
+	if visited[ref] || !h.watchesNamespace(ref.name.Namespace) {
+		return false, nil
+	}
+	visited[ref] = true
+
+	workload, _ := newWorkload(ref.kind)
+	if err := h.Get(ctx, ref.name, workload); err != nil {
+		if errors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	refs, _ := parseRolloutAfter(workload)
+	for _, next := range refs {
+		cycle, err := h.waitsFor(ctx, next, target, visited)
+		if err != nil || cycle {
+			return cycle, err
+		}
+	}
+	return false, nil
+}
+
+// pendingUpstream returns a description of the first upstream workload of the
+// instance which shares a child with the instance and has not yet picked up
+// the current configuration or not yet completed its rollout.
+// It returns an empty string if no upstream is pending.
+func (h *Handler[I]) pendingUpstream(ctx context.Context, instance I, configMapsConfig configMetadataList, secretsConfig configMetadataList) (string, error) {
+	refs, err := h.upstreamRefs(ctx, instance)
+	if err != nil {
+		return "", err
+	}
+
+	for _, ref := range refs {
+		upstream, _ := newWorkload(ref.kind)
+		err := h.Get(ctx, ref.name, upstream)
+		if err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return "", err
+		}
+
+		upstreamConfigMapsConfig, upstreamSecretsConfig := h.upstreams.referencedChildren(upstream)
+		if !sharesChild(configMapsConfig, upstreamConfigMapsConfig) && !sharesChild(secretsConfig, upstreamSecretsConfig) {
+			continue
+		}
+
+		// Only workloads managed by Wave carry a hash. It is calculated like
+		// the Handler of the upstream workload does.
+		currentHash, desiredHash, err := h.upstreams.ConfigHashes(ctx, upstream)
+		if currentHash != "" {
+			if err != nil {
+				return fmt.Sprintf("waiting for %s which cannot pick up the configuration change: %v", ref, err), nil
+			}
+			if desiredHash != currentHash {
+				return fmt.Sprintf("waiting for %s to pick up the configuration change", ref), nil
+			}
+		}
+
+		if !isRolloutComplete(upstream) {
+			return fmt.Sprintf("waiting for the rollout of %s to complete", ref), nil
+		}
+	}
+	return "", nil
+}
+
+// delayForRolloutAfter returns true if the update of the instance has to be
+// delayed until its upstream workloads completed their rollouts. After the
+// timeout Wave emits a Warning event and proceeds with the update.
+func (h *Handler[I]) delayForRolloutAfter(ctx context.Context, instance I, configMapsConfig configMetadataList, secretsConfig configMetadataList) (bool, error) {
+	log := logf.Log.WithName("wave").WithValues("namespace", instance.GetNamespace(), "name", instance.GetName())
+	instanceName := GetNamespacedNameFromObject(instance)
+
+	reason, err := h.pendingUpstream(ctx, instance, configMapsConfig, secretsConfig)
+	if err != nil {
+		return false, err
+	}
+	if reason == "" {
+		h.rolloutAfter.done(instanceName)
+		return false, nil
+	}
+
+	since, started := h.rolloutAfter.start(instanceName)
+	if started {
+		log.V(0).Info("Delaying rollout", "reason", reason)
+		h.recorder.Eventf(instance, corev1.EventTypeNormal, "RolloutDelayed", "Delaying rollout: %s", reason)
+	}
+	if time.Since(since) > h.rolloutAfterTimeout {
+		log.V(0).Info("Upstream rollout stalled. Proceeding with rollout!", "reason", reason)
+		h.recorder.Eventf(instance, corev1.EventTypeWarning, "UpstreamRolloutStalled", "Proceeding with rollout after waiting %s: %s", h.rolloutAfterTimeout, reason)
+		h.rolloutAfter.done(instanceName)
+		return false, nil
+	}
+	return true, nil
+}
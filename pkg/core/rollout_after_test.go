@@ -0,0 +1,302 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"math"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	"golang.org/x/time/rate"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+var _ = Describe("Wave rollout-after Suite", func() {
+	var deploymentObject *appsv1.Deployment
+
+	BeforeEach(func() {
+		deploymentObject = utils.ExampleDeployment.DeepCopy()
+	})
+
+	Context("parseRolloutAfter", func() {
+		It("returns nothing when the annotation is not set", func() {
+			Expect(parseRolloutAfter(deploymentObject)).To(BeEmpty())
+		})
+
+		It("parses references in the same and other namespaces", func() {
+			deploymentObject.Annotations[RolloutAfterAnnotation] = "deployment/backend, StatefulSet/other/db"
+			refs, err := parseRolloutAfter(deploymentObject)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(refs).To(Equal([]upstreamRef{
+				{kind: "deployment", name: GetNamespacedName("backend", "default")},
+				{kind: "statefulset", name: GetNamespacedName("db", "other")},
+			}))
+		})
+
+		It("returns an error for unknown kinds", func() {
+			deploymentObject.Annotations[RolloutAfterAnnotation] = "job/backend"
+			_, err := parseRolloutAfter(deploymentObject)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("returns an error for malformed references", func() {
+			deploymentObject.Annotations[RolloutAfterAnnotation] = "backend"
+			_, err := parseRolloutAfter(deploymentObject)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("returns the valid references next to the error", func() {
+			deploymentObject.Annotations[RolloutAfterAnnotation] = "deploy/backend,backend,job/x"
+			refs, err := parseRolloutAfter(deploymentObject)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring(`"backend"`))
+			Expect(err.Error()).To(ContainSubstring(`"job/x"`))
+			Expect(refs).To(Equal([]upstreamRef{{kind: "deployment", name: GetNamespacedName("backend", "default")}}))
+		})
+	})
+
+	Context("isRolloutComplete", func() {
+		BeforeEach(func() {
+			deploymentObject.Generation = 2
+			deploymentObject.Status.ObservedGeneration = 2
+			deploymentObject.Status.Replicas = 1
+			deploymentObject.Status.UpdatedReplicas = 1
+			deploymentObject.Status.ReadyReplicas = 1
+		})
+
+		It("returns true when all replicas are updated and ready", func() {
+			Expect(isRolloutComplete(deploymentObject)).To(BeTrue())
+		})
+
+		It("returns false when the generation has not been observed", func() {
+			deploymentObject.Generation = 3
+			Expect(isRolloutComplete(deploymentObject)).To(BeFalse())
+		})
+
+		It("returns false when old replicas are still running", func() {
+			deploymentObject.Status.Replicas = 2
+			Expect(isRolloutComplete(deploymentObject)).To(BeFalse())
+		})
+
+		It("returns false when replicas are not ready", func() {
+			deploymentObject.Status.ReadyReplicas = 0
+			Expect(isRolloutComplete(deploymentObject)).To(BeFalse())
+		})
+	})
+
+	Context("sharesChild", func() {
+		It("returns true only for common children", func() {
+			a := configMetadataList{{name: GetNamespacedName("a", "default")}}
+			b := configMetadataList{{name: GetNamespacedName("b", "default")}, {name: GetNamespacedName("a", "default")}}
+			c := configMetadataList{{name: GetNamespacedName("a", "other")}}
+			Expect(sharesChild(a, b)).To(BeTrue())
+			Expect(sharesChild(a, c)).To(BeFalse())
+		})
+	})
+
+	Context("rolloutAfterTracker", func() {
+		It("keeps the start time until done", func() {
+			tracker := &rolloutAfterTracker{waitingSince: map[types.NamespacedName]time.Time{}}
+			name := GetNamespacedNameFromObject(deploymentObject)
+
+			since, started := tracker.start(name)
+			Expect(started).To(BeTrue())
+			again, started := tracker.start(name)
+			Expect(started).To(BeFalse())
+			Expect(again).To(Equal(since))
+
+			tracker.done(name)
+			_, started = tracker.start(name)
+			Expect(started).To(BeTrue())
+		})
+	})
+
+	Context("with an upstream workload", func() {
+		var c client.Client
+		var h *Handler[*appsv1.Deployment]
+		var recorder *record.FakeRecorder
+		var shared *corev1.ConfigMap
+		var backend *appsv1.Deployment
+
+		BeforeEach(func() {
+			shared = &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "shared", Namespace: "default"},
+				Data:       map[string]string{"key": "value"},
+			}
+			podSpec := corev1.PodSpec{Containers: []corev1.Container{{
+				Name:  "app",
+				Image: "app",
+				EnvFrom: []corev1.EnvFromSource{{
+					ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "shared"}},
+				}},
+			}}}
+			backend = utils.ExampleDeployment.DeepCopy()
+			backend.Name = "backend"
+			backend.Annotations = map[string]string{RequiredAnnotation: requiredAnnotationValue}
+			backend.Spec.Template.Spec = podSpec
+			// The backend has not picked up the configuration yet
+			backend.Spec.Template.Annotations = map[string]string{ConfigHashAnnotation: "outdated"}
+			deploymentObject.Annotations = map[string]string{
+				RequiredAnnotation:     requiredAnnotationValue,
+				RolloutAfterAnnotation: "deployment/backend",
+			}
+			deploymentObject.Spec.Template.Spec = podSpec
+
+			c = fake.NewClientBuilder().WithObjects(deploymentObject, backend, shared).WithInterceptorFuncs(interceptor.Funcs{
+				Get: func(ctx context.Context, c client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+					if _, ok := obj.(*corev1.Secret); ok && key.Name == "restricted" {
+						return errors.NewForbidden(schema.GroupResource{Resource: "secrets"}, key.Name, nil)
+					}
+					return c.Get(ctx, key, obj, opts...)
+				},
+			}).Build()
+			recorder = record.NewFakeRecorder(10)
+			h = NewHandler[*appsv1.Deployment](c, recorder, HandlerOptions{
+				UpdateThrottler:   NewUpdateThrottler(rate.Limit(math.Inf(1)), 1),
+				WatchedNamespaces: []string{"default"},
+			})
+		})
+
+		setData := func(value string) {
+			shared.Data["key"] = value
+			Expect(c.Update(context.TODO(), shared)).To(Succeed())
+		}
+
+		// ignoredEvents drains the recorder and returns the events about
+		// ignored rollout-after entries
+		ignoredEvents := func() []string {
+			events := []string{}
+			for {
+				select {
+				case event := <-recorder.Events:
+					if strings.Contains(event, "RolloutAfterIgnored") {
+						events = append(events, event)
+					}
+				default:
+					return events
+				}
+			}
+		}
+
+		setRolloutAfter := func(obj *appsv1.Deployment, value string) {
+			Expect(c.Get(context.TODO(), GetNamespacedNameFromObject(obj), obj)).To(Succeed())
+			obj.Annotations[RolloutAfterAnnotation] = value
+			Expect(c.Update(context.TODO(), obj)).To(Succeed())
+		}
+
+		It("ignores malformed entries and reports them once", func() {
+			setRolloutAfter(deploymentObject, "deployment/backend,backend")
+			name := GetNamespacedNameFromObject(deploymentObject)
+			_, err := h.Handle(context.TODO(), name, &appsv1.Deployment{})
+			Expect(err).NotTo(HaveOccurred())
+
+			setData("changed")
+			for range 2 {
+				result, err := h.Handle(context.TODO(), name, &appsv1.Deployment{})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.RequeueAfter).To(Equal(rolloutAfterRequeueInterval))
+			}
+			events := ignoredEvents()
+			Expect(events).To(HaveLen(1))
+			Expect(events[0]).To(ContainSubstring(`"backend"`))
+		})
+
+		It("ignores upstream workloads in namespaces which Wave does not watch", func() {
+			setRolloutAfter(deploymentObject, "deployment/other/backend")
+			name := GetNamespacedNameFromObject(deploymentObject)
+			_, err := h.Handle(context.TODO(), name, &appsv1.Deployment{})
+			Expect(err).NotTo(HaveOccurred())
+
+			setData("changed")
+			result, err := h.Handle(context.TODO(), name, &appsv1.Deployment{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).NotTo(Equal(rolloutAfterRequeueInterval))
+			Expect(ignoredEvents()).To(ConsistOf(ContainSubstring("deployment/other/backend is in a namespace which Wave does not watch")))
+		})
+
+		It("ignores upstream workloads which wait for the workload themselves", func() {
+			setRolloutAfter(backend, "deployment/"+deploymentObject.Name)
+			name := GetNamespacedNameFromObject(deploymentObject)
+			_, err := h.Handle(context.TODO(), name, &appsv1.Deployment{})
+			Expect(err).NotTo(HaveOccurred())
+
+			setData("changed")
+			result, err := h.Handle(context.TODO(), name, &appsv1.Deployment{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).NotTo(Equal(rolloutAfterRequeueInterval))
+			Expect(ignoredEvents()).To(ConsistOf(ContainSubstring("deployment/default/backend waits for deployment/default/" + deploymentObject.Name + " itself")))
+		})
+
+		It("stops waiting when the change is reverted", func() {
+			name := GetNamespacedNameFromObject(deploymentObject)
+			_, err := h.Handle(context.TODO(), name, &appsv1.Deployment{})
+			Expect(err).NotTo(HaveOccurred())
+
+			setData("changed")
+			result, err := h.Handle(context.TODO(), name, &appsv1.Deployment{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(rolloutAfterRequeueInterval))
+			Expect(h.rolloutAfter.waitingSince).To(HaveKey(name))
+
+			setData("value")
+			_, err = h.Handle(context.TODO(), name, &appsv1.Deployment{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(h.rolloutAfter.waitingSince).NotTo(HaveKey(name))
+		})
+
+		It("hashes upstream workloads like their own Handler", func() {
+			name := GetNamespacedNameFromObject(deploymentObject)
+			_, err := h.Handle(context.TODO(), name, &appsv1.Deployment{})
+			Expect(err).NotTo(HaveOccurred())
+
+			// The backend hashes the children it can read and completed its
+			// rollout of the change
+			setData("changed")
+			Expect(c.Get(context.TODO(), GetNamespacedNameFromObject(backend), backend)).To(Succeed())
+			backend.Annotations[UnreadableChildrenPolicyAnnotation] = string(UnreadableChildrenHashReadable)
+			backend.Spec.Template.Spec.Containers[0].EnvFrom = append(backend.Spec.Template.Spec.Containers[0].EnvFrom, corev1.EnvFromSource{
+				SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "restricted"}, Optional: ptr.To(true)},
+			})
+			_, desired, err := h.upstreams.ConfigHashes(context.TODO(), backend)
+			Expect(err).NotTo(HaveOccurred())
+			backend.Spec.Template.Annotations[ConfigHashAnnotation] = desired
+			backend.Spec.Replicas = ptr.To(int32(1))
+			Expect(c.Update(context.TODO(), backend)).To(Succeed())
+			backend.Status = appsv1.DeploymentStatus{ObservedGeneration: backend.Generation, Replicas: 1, UpdatedReplicas: 1, ReadyReplicas: 1}
+			Expect(c.Status().Update(context.TODO(), backend)).To(Succeed())
+
+			result, err := h.Handle(context.TODO(), name, &appsv1.Deployment{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).NotTo(Equal(rolloutAfterRequeueInterval))
+			Expect(h.rolloutAfter.waitingSince).NotTo(HaveKey(name))
+		})
+	})
+})
@@ -0,0 +1,264 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// DefaultRolloutStallTimeout is the default time after which a rollout
+	// whose ready replicas do not improve is considered stalled
+	DefaultRolloutStallTimeout = 10 * time.Minute
+
+	// RolloutProgressing is the value of the RolloutStatusAnnotation while Wave follows a rollout
+	RolloutProgressing = "Progressing"
+	// RolloutSucceeded is the value of the RolloutStatusAnnotation after a successful rollout
+	RolloutSucceeded = "Succeeded"
+	// RolloutStalled is the value of the RolloutStatusAnnotation after a stalled rollout
+	RolloutStalled = "Stalled"
+)
+
+// rolloutProgress holds the in-memory state of a followed rollout
+type rolloutProgress struct {
+	started      time.Time
+	lastReady    int32
+	lastImproved time.Time
+}
+
+// rolloutHealthTracker follows the rollouts caused by Wave
+type rolloutHealthTracker struct {
+	mutex sync.Mutex
+	// fingerprints holds the hash of every child of a workload at its last update
+	fingerprints map[types.NamespacedName]map[string]string
+	progress     map[types.NamespacedName]*rolloutProgress
+	stallTimeout time.Duration
+}
+
+func newRolloutHealthTracker(stallTimeout time.Duration) *rolloutHealthTracker {
+	if stallTimeout <= 0 {
+		stallTimeout = DefaultRolloutStallTimeout
+	}
+	return &rolloutHealthTracker{
+		fingerprints: make(map[types.NamespacedName]map[string]string),
+		progress:     make(map[types.NamespacedName]*rolloutProgress),
+		stallTimeout: stallTimeout,
+	}
+}
+
+// childFingerprints returns the hash of the referenced data of every child
+// keyed by the childRef
+func childFingerprints(configMaps map[types.NamespacedName]*corev1.ConfigMap, secrets map[types.NamespacedName]*corev1.Secret, configMapsConfig configMetadataList, secretsConfig configMetadataList) map[string]string {
+	fingerprints := make(map[string]string)
+	for _, child := range configMapsConfig {
+		ref := childRef{kind: configMapKind, name: child.name}.String()
+		if _, ok := fingerprints[ref]; ok {
+			continue
+		}
+		subset := configMetadataList{}
+		for _, c := range configMapsConfig {
+			if c.name == child.name {
+				subset = append(subset, c)
+			}
+		}
+		fingerprints[ref], _ = calculateConfigHash(configMaps, nil, subset, nil)
+	}
+	for _, child := range secretsConfig {
+		ref := childRef{kind: secretKind, name: child.name}.String()
+		if _, ok := fingerprints[ref]; ok {
+			continue
+		}
+		subset := configMetadataList{}
+		for _, c := range secretsConfig {
+			if c.name == child.name {
+				subset = append(subset, c)
+			}
+		}
+		fingerprints[ref], _ = calculateConfigHash(nil, secrets, nil, subset)
+	}
+	return fingerprints
+}
+
+// changedChildren returns the children whose fingerprint differs from the
+// one recorded at the last update of the workload. It returns nil if there is
+// no record, e.g. after a restart of Wave.
+func (t *rolloutHealthTracker) changedChildren(name types.NamespacedName, fingerprints map[string]string) []string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	previous, ok := t.fingerprints[name]
+	if !ok {
+		return nil
+	}
+	changed := []string{}
+	for ref, fingerprint := range fingerprints {
+		if previous[ref] != fingerprint {
+			changed = append(changed, ref)
+		}
+	}
+	for ref := range previous {
+		if _, ok := fingerprints[ref]; !ok {
+			changed = append(changed, ref)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// recordedFingerprints returns the fingerprints recorded at the last update
+// of the workload and false if there is no record
+func (t *rolloutHealthTracker) recordedFingerprints(name types.NamespacedName) (map[string]string, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	previous, ok := t.fingerprints[name]
+	return previous, ok
+}
+
+// setFingerprints records the fingerprints of the children of the workload
+func (t *rolloutHealthTracker) setFingerprints(name types.NamespacedName, fingerprints map[string]string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.fingerprints[name] = fingerprints
+}
+
+// start begins to follow the rollout of the workload and returns the time
+// after which it has to be checked for a stall
+func (t *rolloutHealthTracker) start(name types.NamespacedName) time.Duration {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	now := time.Now()
+	t.progress[name] = &rolloutProgress{started: now, lastImproved: now}
+	return t.stallTimeout
+}
+
+// forget removes all state of the workload
+func (t *rolloutHealthTracker) forget(name types.NamespacedName) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	delete(t.fingerprints, name)
+	delete(t.progress, name)
+}
+
+// evaluate returns the outcome of the rollout of the workload (RolloutSucceeded,
+// RolloutStalled or an empty string while it is progressing) and a
+// description. For finished rollouts it returns the duration of the rollout if
+// known and for progressing rollouts the time after which it has to be
+// checked for a stall.
+func (t *rolloutHealthTracker) evaluate(name types.NamespacedName, obj Object) (string, string, time.Duration) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	progress, ok := t.progress[name]
+	if !ok {
+		// Wave restarted while the rollout was progressing
+		now := time.Now()
+		progress = &rolloutProgress{lastReady: readyReplicas(obj), lastImproved: now}
+		t.progress[name] = progress
+	}
+	var duration time.Duration
+	if !progress.started.IsZero() {
+		duration = time.Since(progress.started)
+	}
+
+	if isRolloutComplete(obj) {
+		delete(t.progress, name)
+		return RolloutSucceeded, "all replicas are updated and ready", duration
+	}
+	if reason := rolloutFailure(obj); reason != "" {
+		delete(t.progress, name)
+		return RolloutStalled, reason, duration
+	}
+	if ready := readyReplicas(obj); ready > progress.lastReady {
+		progress.lastReady = ready
+		progress.lastImproved = time.Now()
+	}
+	if time.Since(progress.lastImproved) >= t.stallTimeout {
+		delete(t.progress, name)
+		return RolloutStalled, fmt.Sprintf("ready replicas did not improve for %s", t.stallTimeout), duration
+	}
+	return "", "", t.stallTimeout - time.Since(progress.lastImproved) + time.Second
+}
+
+// startRolloutTracking marks the rollout of the instance as progressing and
+// records the children which triggered it
+func startRolloutTracking(obj metav1.Object, changedChildren []string) {
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[RolloutStatusAnnotation] = RolloutProgressing
+	if len(changedChildren) > 0 {
+		annotations[RolloutTriggerAnnotation] = strings.Join(changedChildren, ",")
+	} else {
+		delete(annotations, RolloutTriggerAnnotation)
+	}
+	obj.SetAnnotations(annotations)
+}
+
+// trackRollout follows a progressing rollout of the instance and records its
+// outcome once it succeeded or stalled
+func (h *Handler[I]) trackRollout(ctx context.Context, instance I) (reconcile.Result, error) {
+	annotations := instance.GetAnnotations()
+	if annotations[RolloutStatusAnnotation] != RolloutProgressing {
+		return reconcile.Result{}, nil
+	}
+
+	instanceName := GetNamespacedNameFromObject(instance)
+	result, reason, duration := h.rolloutHealth.evaluate(instanceName, instance)
+	if result == "" {
+		return reconcile.Result{RequeueAfter: duration}, nil
+	}
+
+	annotations[RolloutStatusAnnotation] = result
+	instance.SetAnnotations(annotations)
+	if !h.dryRun {
+		err := h.Update(ctx, instance)
+		if err != nil {
+			return reconcile.Result{}, fmt.Errorf("error updating instance %s/%s: %v", instance.GetNamespace(), instance.GetName(), err)
+		}
+	}
+
+	log := logf.Log.WithName("wave").WithValues("namespace", instance.GetNamespace(), "name", instance.GetName())
+	trigger := "configuration change"
+	if children := annotations[RolloutTriggerAnnotation]; children != "" {
+		trigger = fmt.Sprintf("change of %s", children)
+	}
+	if result == RolloutSucceeded {
+		log.V(0).Info("Rollout succeeded", "trigger", trigger)
+		h.recorder.Eventf(instance, corev1.EventTypeNormal, "RolloutSucceeded", "Rollout after %s succeeded", trigger)
+	} else {
+		log.V(0).Info("Rollout stalled", "trigger", trigger, "reason", reason)
+		h.recorder.Eventf(instance, corev1.EventTypeWarning, "RolloutStalled", "Rollout after %s stalled: %s", trigger, reason)
+	}
+
+	kind := kindOf(instance)
+	rolloutsTotal.WithLabelValues(kind, instance.GetNamespace(), strings.ToLower(result)).Inc()
+	if duration > 0 {
+		rolloutDurationSeconds.WithLabelValues(kind, strings.ToLower(result)).Observe(duration.Seconds())
+	}
+	return reconcile.Result{}, nil
+}
@@ -0,0 +1,135 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+var _ = Describe("Wave rollout health Suite", func() {
+	var tracker *rolloutHealthTracker
+	var deploymentObject *appsv1.Deployment
+	var name types.NamespacedName
+
+	BeforeEach(func() {
+		tracker = newRolloutHealthTracker(time.Minute)
+		deploymentObject = utils.ExampleDeployment.DeepCopy()
+		deploymentObject.Generation = 2
+		deploymentObject.Status.ObservedGeneration = 2
+		deploymentObject.Status.Replicas = 2
+		deploymentObject.Status.UpdatedReplicas = 1
+		name = GetNamespacedNameFromObject(deploymentObject)
+	})
+
+	Context("changedChildren", func() {
+		It("returns nil without a previous record", func() {
+			Expect(tracker.changedChildren(name, map[string]string{"configmap/default/a": "1"})).To(BeNil())
+		})
+
+		It("returns changed, added and removed children", func() {
+			tracker.setFingerprints(name, map[string]string{
+				"configmap/default/a": "1",
+				"configmap/default/b": "1",
+				"secret/default/c":    "1",
+			})
+			Expect(tracker.changedChildren(name, map[string]string{
+				"configmap/default/a": "1",
+				"configmap/default/b": "2",
+				"secret/default/d":    "1",
+			})).To(Equal([]string{"configmap/default/b", "secret/default/c", "secret/default/d"}))
+		})
+	})
+
+	Context("childFingerprints", func() {
+		It("only changes for the modified child", func() {
+			cm1 := utils.ExampleConfigMap1.DeepCopy()
+			cm2 := utils.ExampleConfigMap2.DeepCopy()
+			configMaps := map[types.NamespacedName]*corev1.ConfigMap{
+				GetNamespacedNameFromObject(cm1): cm1,
+				GetNamespacedNameFromObject(cm2): cm2,
+			}
+			configMapsConfig := configMetadataList{
+				{name: GetNamespacedNameFromObject(cm1), allKeys: true},
+				{name: GetNamespacedNameFromObject(cm2), allKeys: true},
+			}
+			before := childFingerprints(configMaps, nil, configMapsConfig, configMetadataList{})
+			cm2.Data["key1"] = "modified"
+			after := childFingerprints(configMaps, nil, configMapsConfig, configMetadataList{})
+
+			tracker.setFingerprints(name, before)
+			Expect(tracker.changedChildren(name, after)).To(Equal([]string{"configmap/default/example2"}))
+		})
+	})
+
+	Context("evaluate", func() {
+		BeforeEach(func() {
+			tracker.start(name)
+		})
+
+		It("reports progressing rollouts", func() {
+			result, _, requeueAfter := tracker.evaluate(name, deploymentObject)
+			Expect(result).To(BeEmpty())
+			Expect(requeueAfter).To(BeNumerically(">", 0))
+		})
+
+		It("reports succeeded rollouts", func() {
+			deploymentObject.Status.Replicas = 1
+			deploymentObject.Status.ReadyReplicas = 1
+			result, _, _ := tracker.evaluate(name, deploymentObject)
+			Expect(result).To(Equal(RolloutSucceeded))
+		})
+
+		It("reports stalled rollouts when the progress deadline is exceeded", func() {
+			deploymentObject.Status.Conditions = []appsv1.DeploymentCondition{{
+				Type:    appsv1.DeploymentProgressing,
+				Status:  corev1.ConditionFalse,
+				Reason:  "ProgressDeadlineExceeded",
+				Message: "deadline exceeded",
+			}}
+			result, reason, _ := tracker.evaluate(name, deploymentObject)
+			Expect(result).To(Equal(RolloutStalled))
+			Expect(reason).To(Equal("deadline exceeded"))
+		})
+
+		It("reports stalled rollouts when ready replicas do not improve", func() {
+			tracker.progress[name].lastImproved = time.Now().Add(-2 * time.Minute)
+			result, _, _ := tracker.evaluate(name, deploymentObject)
+			Expect(result).To(Equal(RolloutStalled))
+		})
+	})
+
+	Context("startRolloutTracking", func() {
+		It("sets the status and the trigger", func() {
+			startRolloutTracking(deploymentObject, []string{"configmap/default/a", "secret/default/b"})
+			Expect(deploymentObject.GetAnnotations()).To(HaveKeyWithValue(RolloutStatusAnnotation, RolloutProgressing))
+			Expect(deploymentObject.GetAnnotations()).To(HaveKeyWithValue(RolloutTriggerAnnotation, "configmap/default/a,secret/default/b"))
+		})
+
+		It("removes a stale trigger if the children are unknown", func() {
+			startRolloutTracking(deploymentObject, []string{"configmap/default/a"})
+			startRolloutTracking(deploymentObject, nil)
+			Expect(deploymentObject.GetAnnotations()).NotTo(HaveKey(RolloutTriggerAnnotation))
+		})
+	})
+})
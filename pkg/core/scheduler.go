@@ -1,5 +1,21 @@
 package core
 
+import (
+	"context"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
 // disableScheduling sets an invalid scheduler and adds an annotation with the original scheduler
 func disableScheduling[I InstanceType](obj I) {
 	if isSchedulingDisabled(obj) {
@@ -34,6 +50,25 @@ func isSchedulingDisabled[I InstanceType](obj I) bool {
 	return ok
 }
 
+// disableSchedulingWithGate adds the scheduling gate of Wave and an annotation
+// with the scheduler to mark scheduling as disabled
+func disableSchedulingWithGate[I InstanceType](obj I) {
+	if isSchedulingDisabled(obj) {
+		return
+	}
+
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	podTemplate := GetPodTemplate(obj)
+	annotations[SchedulingDisabledAnnotation] = podTemplate.Spec.SchedulerName
+	obj.SetAnnotations(annotations)
+
+	podTemplate.Spec.SchedulingGates = append(podTemplate.Spec.SchedulingGates, corev1.PodSchedulingGate{Name: SchedulingGateName})
+	SetPodTemplate(obj, podTemplate)
+}
+
 // enableScheduling restore scheduling if it has been disabled by wave
 func restoreScheduling[I InstanceType](obj I) {
 	// Get the existing annotations
@@ -47,10 +82,139 @@ func restoreScheduling[I InstanceType](obj I) {
 		return
 	}
 	delete(annotations, SchedulingDisabledAnnotation)
+	delete(annotations, SchedulingDisabledSinceAnnotation)
+	delete(annotations, SchedulingDisabledByAnnotation)
 	obj.SetAnnotations(annotations)
 
-	// Restore scheduler
+	// Remove the scheduling gate or restore the scheduler
 	podTemplate := GetPodTemplate(obj)
-	podTemplate.Spec.SchedulerName = schedulerName
+	if !removeSchedulingGate(&podTemplate.Spec) {
+		podTemplate.Spec.SchedulerName = schedulerName
+	}
 	SetPodTemplate(obj, podTemplate)
 }
+
+// hasSchedulingGate returns true if the PodSpec contains the scheduling gate
+// of Wave
+func hasSchedulingGate(spec *corev1.PodSpec) bool {
+	for _, gate := range spec.SchedulingGates {
+		if gate.Name == SchedulingGateName {
+			return true
+		}
+	}
+	return false
+}
+
+// removeSchedulingGate removes the scheduling gate of Wave from the PodSpec
+// and returns true if it was present
+func removeSchedulingGate(spec *corev1.PodSpec) bool {
+	gates := []corev1.PodSchedulingGate{}
+	for _, gate := range spec.SchedulingGates {
+		if gate.Name != SchedulingGateName {
+			gates = append(gates, gate)
+		}
+	}
+	if len(gates) == len(spec.SchedulingGates) {
+		return false
+	}
+	if len(gates) == 0 {
+		gates = nil
+	}
+	spec.SchedulingGates = gates
+	return true
+}
+
+// blockScheduling disables scheduling of the pods of the instance with the
+// scheduling gate if the cluster supports it or with an invalid scheduler
+func (h *Handler[I]) blockScheduling(instance I) {
+	if !isSchedulingDisabled(instance) {
+		setSchedulingDisabledSince(instance, time.Now())
+		annotations := instance.GetAnnotations()
+		annotations[SchedulingDisabledByAnnotation] = EventSource(h.controllerClass)
+		instance.SetAnnotations(annotations)
+	}
+	if h.schedulingGates {
+		disableSchedulingWithGate(instance)
+	} else {
+		disableScheduling(instance)
+	}
+}
+
+// clearSchedulingGates removes the scheduling gate of Wave from the pending
+// pods of the instance. Gates can only be removed from pods but not added so
+// pods created while scheduling was disabled keep them otherwise, and an
+// OrderedReady StatefulSet never replaces a pod which does not become ready.
+// Only pods whose owner chain leads to the instance are updated since the
+// selector of the instance may match pods of other workloads.
+func (h *Handler[I]) clearSchedulingGates(ctx context.Context, instance I) error {
+	selector, err := metav1.LabelSelectorAsSelector(getSelector(instance))
+	if err != nil {
+		return fmt.Errorf("error parsing selector: %v", err)
+	}
+	inNamespace := client.InNamespace(instance.GetNamespace())
+	matchingSelector := client.MatchingLabelsSelector{Selector: selector}
+
+	// Pods of a Deployment are owned by its ReplicaSets
+	owners := map[types.UID]bool{instance.GetUID(): true}
+	if _, ok := any(instance).(*appsv1.Deployment); ok {
+		replicaSets := &appsv1.ReplicaSetList{}
+		if err := h.apiReader.List(ctx, replicaSets, inNamespace, matchingSelector); err != nil {
+			return fmt.Errorf("error listing ReplicaSets: %v", err)
+		}
+		for i := range replicaSets.Items {
+			if owner := metav1.GetControllerOf(&replicaSets.Items[i]); owner != nil && owner.UID == instance.GetUID() {
+				owners[replicaSets.Items[i].GetUID()] = true
+			}
+		}
+	}
+
+	pods := &corev1.PodList{}
+	if err := h.apiReader.List(ctx, pods, inNamespace, matchingSelector); err != nil {
+		return fmt.Errorf("error listing pods: %v", err)
+	}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		owner := metav1.GetControllerOf(pod)
+		if owner == nil || !owners[owner.UID] {
+			continue
+		}
+		if pod.Status.Phase != corev1.PodPending || !removeSchedulingGate(&pod.Spec) {
+			continue
+		}
+		if err := h.Update(ctx, pod); err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("error updating pod %s/%s: %v", pod.GetNamespace(), pod.GetName(), err)
+		}
+	}
+	return nil
+}
+
+// getSelector returns the label selector of the pods of the instance
+func getSelector[I InstanceType](instance I) *metav1.LabelSelector {
+	switch obj := any(instance).(type) {
+	case *appsv1.Deployment:
+		return obj.Spec.Selector
+	case *appsv1.StatefulSet:
+		return obj.Spec.Selector
+	case *appsv1.DaemonSet:
+		return obj.Spec.Selector
+	}
+	return nil
+}
+
+// SchedulingGatesSupported returns true if the API server supports scheduling
+// gates, i.e. if it runs at least Kubernetes 1.27
+func SchedulingGatesSupported(config *rest.Config) (bool, error) {
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return false, err
+	}
+	info, err := discoveryClient.ServerVersion()
+	if err != nil {
+		return false, err
+	}
+	serverVersion, err := version.ParseGeneric(info.GitVersion)
+	if err != nil {
+		return false, err
+	}
+	return serverVersion.AtLeast(version.MajorMinor(1, 27)), nil
+}
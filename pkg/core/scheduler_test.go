@@ -17,10 +17,16 @@ limitations under the License.
 package core
 
 import (
+	"context"
+
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/wave-k8s/wave/test/utils"
 	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 )
 
 var _ = Describe("Wave scheduler Suite", func() {
@@ -71,4 +77,85 @@ var _ = Describe("Wave scheduler Suite", func() {
 		})
 
 	})
+
+	Context("When scheduling is disabled with a scheduling gate", func() {
+		BeforeEach(func() {
+			disableSchedulingWithGate(deploymentObject)
+		})
+
+		It("Adds the scheduling gate and keeps the scheduler", func() {
+			podTemplate := GetPodTemplate(deploymentObject)
+			Expect(podTemplate.Spec.SchedulingGates).To(ConsistOf(corev1.PodSchedulingGate{Name: SchedulingGateName}))
+			Expect(podTemplate.Spec.SchedulerName).To(Equal("default-scheduler"))
+			Expect(isSchedulingDisabled(deploymentObject)).To(BeTrue())
+		})
+
+		It("Removes the scheduling gate when restored", func() {
+			restoreScheduling(deploymentObject)
+			podTemplate := GetPodTemplate(deploymentObject)
+			Expect(podTemplate.Spec.SchedulingGates).To(BeEmpty())
+			Expect(podTemplate.Spec.SchedulerName).To(Equal("default-scheduler"))
+			Expect(isSchedulingDisabled(deploymentObject)).To(BeFalse())
+		})
+
+		It("Removes the scheduling gate from pending pods of the workload", func() {
+			labels := deploymentObject.Spec.Selector.MatchLabels
+			deploymentObject.SetUID("deployment")
+			gatedSpec := corev1.PodSpec{SchedulingGates: []corev1.PodSchedulingGate{
+				{Name: "other"}, {Name: SchedulingGateName},
+			}}
+			pending := corev1.PodStatus{Phase: corev1.PodPending}
+			replicaSet := &appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{
+				Name: "example-abc", Namespace: "default", Labels: labels, UID: "replicaset",
+				OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(deploymentObject, appsv1.SchemeGroupVersion.WithKind("Deployment"))},
+			}}
+			foreignReplicaSet := &appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{
+				Name: "foreign-abc", Namespace: "default", Labels: labels, UID: "foreign",
+			}}
+			gated := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "gated", Namespace: "default", Labels: labels,
+					OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(replicaSet, appsv1.SchemeGroupVersion.WithKind("ReplicaSet"))}},
+				Spec:   *gatedSpec.DeepCopy(),
+				Status: pending,
+			}
+			foreign := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "foreign", Namespace: "default", Labels: labels,
+					OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(foreignReplicaSet, appsv1.SchemeGroupVersion.WithKind("ReplicaSet"))}},
+				Spec:   *gatedSpec.DeepCopy(),
+				Status: pending,
+			}
+			other := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "default"},
+				Spec:       corev1.PodSpec{SchedulingGates: []corev1.PodSchedulingGate{{Name: SchedulingGateName}}},
+				Status:     pending,
+			}
+			c := fake.NewClientBuilder().WithObjects(replicaSet, foreignReplicaSet, gated, foreign, other).Build()
+			h := NewHandler[*appsv1.Deployment](c, record.NewFakeRecorder(10), HandlerOptions{UseSchedulingGates: true})
+			Expect(h.clearSchedulingGates(context.TODO(), deploymentObject)).To(Succeed())
+
+			Expect(c.Get(context.TODO(), GetNamespacedNameFromObject(gated), gated)).To(Succeed())
+			Expect(gated.Spec.SchedulingGates).To(ConsistOf(corev1.PodSchedulingGate{Name: "other"}))
+			Expect(c.Get(context.TODO(), GetNamespacedNameFromObject(foreign), foreign)).To(Succeed())
+			Expect(foreign.Spec.SchedulingGates).To(HaveLen(2))
+			Expect(c.Get(context.TODO(), GetNamespacedNameFromObject(other), other)).To(Succeed())
+			Expect(other.Spec.SchedulingGates).To(HaveLen(1))
+		})
+
+		It("Removes the scheduling gate from pending pods owned by a StatefulSet", func() {
+			statefulSet := utils.ExampleStatefulSet.DeepCopy()
+			statefulSet.SetUID("statefulset")
+			gated := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: statefulSet.GetName() + "-0", Namespace: statefulSet.GetNamespace(), Labels: statefulSet.Spec.Selector.MatchLabels,
+					OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(statefulSet, appsv1.SchemeGroupVersion.WithKind("StatefulSet"))}},
+				Spec:   corev1.PodSpec{SchedulingGates: []corev1.PodSchedulingGate{{Name: SchedulingGateName}}},
+				Status: corev1.PodStatus{Phase: corev1.PodPending},
+			}
+			c := fake.NewClientBuilder().WithObjects(gated).Build()
+			h := NewHandler[*appsv1.StatefulSet](c, record.NewFakeRecorder(10), HandlerOptions{UseSchedulingGates: true})
+			Expect(h.clearSchedulingGates(context.TODO(), statefulSet)).To(Succeed())
+
+			Expect(c.Get(context.TODO(), GetNamespacedNameFromObject(gated), gated)).To(Succeed())
+			Expect(gated.Spec.SchedulingGates).To(BeEmpty())
+		})
+	})
 })
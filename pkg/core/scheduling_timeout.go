@@ -0,0 +1,134 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// SchedulingTimeoutAction controls what Wave does when scheduling of a
+// workload has been disabled for longer than the scheduling timeout
+type SchedulingTimeoutAction string
+
+const (
+	// SchedulingTimeoutWarn records Warning events and keeps scheduling disabled
+	SchedulingTimeoutWarn SchedulingTimeoutAction = "warn"
+
+	// SchedulingTimeoutRestore restores the original scheduler so that the
+	// pods fail instead of staying Pending
+	SchedulingTimeoutRestore SchedulingTimeoutAction = "restore"
+)
+
+// ParseSchedulingTimeoutAction parses the value of the
+// --scheduling-timeout-action flag
+func ParseSchedulingTimeoutAction(value string) (SchedulingTimeoutAction, error) {
+	switch action := SchedulingTimeoutAction(value); action {
+	case SchedulingTimeoutWarn, SchedulingTimeoutRestore:
+		return action, nil
+	}
+	return "", fmt.Errorf("invalid scheduling timeout action %q: must be %s or %s", value, SchedulingTimeoutWarn, SchedulingTimeoutRestore)
+}
+
+// setSchedulingDisabledSince records the time scheduling was disabled
+func setSchedulingDisabledSince[I InstanceType](obj I, since time.Time) {
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[SchedulingDisabledSinceAnnotation] = since.UTC().Format(time.RFC3339)
+	obj.SetAnnotations(annotations)
+}
+
+// getSchedulingDisabledSince returns the time scheduling was disabled and
+// false if it was not recorded
+func getSchedulingDisabledSince[I InstanceType](obj I) (time.Time, bool) {
+	since, err := time.Parse(time.RFC3339, obj.GetAnnotations()[SchedulingDisabledSinceAnnotation])
+	if err != nil {
+		return time.Time{}, false
+	}
+	return since, true
+}
+
+// checkSchedulingTimeout escalates if scheduling of the instance has been
+// disabled for longer than the scheduling timeout because of missing
+// children. It requeues the instance until the timeout has passed and then
+// periodically while scheduling stays disabled.
+func (h *Handler[I]) checkSchedulingTimeout(ctx context.Context, instance I, missing []string) (reconcile.Result, error) {
+	instanceName := GetNamespacedNameFromObject(instance)
+	if h.schedulingTimeout <= 0 || !isSchedulingDisabled(instance) {
+		h.schedulingTimedOut.set(instanceName, false)
+		return reconcile.Result{}, nil
+	}
+
+	log := logf.Log.WithName("wave").WithValues("namespace", instance.GetNamespace(), "name", instance.GetName())
+	since, ok := getSchedulingDisabledSince(instance)
+	if !ok {
+		// Scheduling was disabled before the time was recorded
+		since = time.Now()
+		setSchedulingDisabledSince(instance, since)
+		if !h.dryRun {
+			if err := h.Update(ctx, instance); err != nil {
+				return reconcile.Result{}, fmt.Errorf("error updating instance %s/%s: %v", instance.GetNamespace(), instance.GetName(), err)
+			}
+		}
+	}
+
+	disabled := time.Since(since)
+	if disabled < h.schedulingTimeout {
+		h.schedulingTimedOut.set(instanceName, false)
+		return reconcile.Result{RequeueAfter: h.schedulingTimeout - disabled}, nil
+	}
+
+	children := strings.Join(missing, ", ")
+	if h.schedulingTimeoutAction != SchedulingTimeoutRestore {
+		h.schedulingTimedOut.set(instanceName, true)
+		log.V(0).Info("Scheduling disabled longer than the timeout", "since", since, "children", missing)
+		h.recorder.Eventf(instance, corev1.EventTypeWarning, "SchedulingTimeout", "Scheduling has been disabled since %s due to missing children: %s", since.UTC().Format(time.RFC3339), children)
+		return reconcile.Result{RequeueAfter: h.schedulingTimeout}, nil
+	}
+
+	if h.dryRun {
+		log.V(0).Info("Would restore scheduling after timeout", "since", since, "children", missing, "dryRun", true)
+		h.recorder.Eventf(instance, corev1.EventTypeWarning, "DryRunSchedulingRestored", "Would restore scheduling despite missing children: %s", children)
+		return reconcile.Result{RequeueAfter: h.schedulingTimeout}, nil
+	}
+
+	log.V(0).Info("Restoring scheduling after timeout", "since", since, "children", missing)
+	gated := hasSchedulingGate(&GetPodTemplate(instance).Spec)
+	restoreScheduling(instance)
+	if err := h.updateThrottler.Wait(ctx, instanceName); err != nil {
+		return reconcile.Result{}, fmt.Errorf("error waiting for rate limit: %v", err)
+	}
+	if err := h.Update(ctx, instance); err != nil {
+		return reconcile.Result{}, fmt.Errorf("error updating instance %s/%s: %v", instance.GetNamespace(), instance.GetName(), err)
+	}
+	h.schedulingTimedOut.set(instanceName, false)
+	h.recorder.Eventf(instance, corev1.EventTypeWarning, "SchedulingRestored", "Restored scheduling after %s despite missing children: %s", h.schedulingTimeout, children)
+	if gated {
+		if err := h.clearSchedulingGates(ctx, instance); err != nil {
+			log.Error(err, "Unable to remove scheduling gates from pending pods")
+		}
+	}
+	return reconcile.Result{}, nil
+}
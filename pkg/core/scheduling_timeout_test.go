@@ -0,0 +1,95 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"math"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	"golang.org/x/time/rate"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Wave scheduling timeout Suite", func() {
+	var c client.Client
+	var recorder *record.FakeRecorder
+	var deploymentObject *appsv1.Deployment
+	var opts HandlerOptions
+
+	BeforeEach(func() {
+		deploymentObject = utils.ExampleDeployment.DeepCopy()
+		deploymentObject.Annotations[RequiredAnnotation] = requiredAnnotationValue
+		disableScheduling(deploymentObject)
+		setSchedulingDisabledSince(deploymentObject, time.Now().Add(-2*time.Hour))
+		c = fake.NewClientBuilder().WithObjects(deploymentObject).Build()
+		recorder = record.NewFakeRecorder(10)
+		opts = HandlerOptions{
+			UpdateThrottler:   NewUpdateThrottler(rate.Limit(math.Inf(1)), 1),
+			SchedulingTimeout: time.Hour,
+		}
+	})
+
+	handle := func() time.Duration {
+		h := NewHandler[*appsv1.Deployment](c, recorder, opts)
+		result, err := h.Handle(context.TODO(), GetNamespacedNameFromObject(deploymentObject), &appsv1.Deployment{})
+		Expect(err).NotTo(HaveOccurred())
+		return result.RequeueAfter
+	}
+
+	It("requeues until the timeout has passed", func() {
+		opts.SchedulingTimeout = 3 * time.Hour
+		Expect(handle()).To(BeNumerically("~", time.Hour, time.Minute))
+		Expect(recorder.Events).NotTo(Receive())
+	})
+
+	It("warns after the timeout", func() {
+		Expect(handle()).To(Equal(time.Hour))
+		Expect(recorder.Events).To(Receive(ContainSubstring("SchedulingTimeout")))
+
+		updated := &appsv1.Deployment{}
+		Expect(c.Get(context.TODO(), GetNamespacedNameFromObject(deploymentObject), updated)).To(Succeed())
+		Expect(isSchedulingDisabled(updated)).To(BeTrue())
+	})
+
+	It("restores scheduling after the timeout with restore", func() {
+		opts.SchedulingTimeoutAction = SchedulingTimeoutRestore
+		Expect(handle()).To(BeZero())
+		Expect(recorder.Events).To(Receive(ContainSubstring("SchedulingRestored")))
+
+		updated := &appsv1.Deployment{}
+		Expect(c.Get(context.TODO(), GetNamespacedNameFromObject(deploymentObject), updated)).To(Succeed())
+		Expect(isSchedulingDisabled(updated)).To(BeFalse())
+		Expect(updated.Annotations).NotTo(HaveKey(SchedulingDisabledSinceAnnotation))
+	})
+
+	It("records the time if it is missing", func() {
+		delete(deploymentObject.Annotations, SchedulingDisabledSinceAnnotation)
+		Expect(c.Update(context.TODO(), deploymentObject)).To(Succeed())
+		Expect(handle()).To(BeNumerically("~", time.Hour, time.Minute))
+
+		updated := &appsv1.Deployment{}
+		Expect(c.Get(context.TODO(), GetNamespacedNameFromObject(deploymentObject), updated)).To(Succeed())
+		Expect(updated.Annotations).To(HaveKey(SchedulingDisabledSinceAnnotation))
+	})
+})
@@ -0,0 +1,572 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// snapshotHashLength is the number of characters of the content hash used
+	// in the name of a snapshot
+	snapshotHashLength = 10
+
+	// snapshotGracePeriod is the minimum age of an unreferenced snapshot
+	// before it is garbage-collected
+	snapshotGracePeriod = 5 * time.Minute
+)
+
+// snapshotsEnabled returns true if Wave snapshots the children of the instance
+func (h *Handler[I]) snapshotsEnabled(instance I) bool {
+	return h.enableSnapshots && instance.GetAnnotations()[SnapshotConfigAnnotation] == requiredAnnotationValue
+}
+
+// childDataHash returns the hash of all data of a ConfigMap or Secret
+func childDataHash(obj Object) string {
+	name := GetNamespacedNameFromObject(obj)
+	var hash string
+	switch o := obj.(type) {
+	case *corev1.ConfigMap:
+		hash, _ = calculateConfigHash(map[types.NamespacedName]*corev1.ConfigMap{name: o}, nil, configMetadataList{{name: name, allKeys: true}}, nil)
+	case *corev1.Secret:
+		hash, _ = calculateConfigHash(nil, map[types.NamespacedName]*corev1.Secret{name: o}, nil, configMetadataList{{name: name, allKeys: true}})
+	}
+	return hash
+}
+
+// snapshotName returns the content-addressed name of the snapshot of a child
+func snapshotName(obj Object) string {
+	hash := childDataHash(obj)[:snapshotHashLength]
+	name := obj.GetName()
+	// Names of ConfigMaps and Secrets are limited to 253 characters
+	if len(name) > 253-snapshotHashLength-1 {
+		name = name[:253-snapshotHashLength-1]
+	}
+	return fmt.Sprintf("%s-%s", name, hash)
+}
+
+// snapshotSources parses the snapshot annotation of the PodTemplate and
+// returns a map of snapshot childRefs to the names of their sources
+func snapshotSources(podTemplate *corev1.PodTemplateSpec) map[childRef]string {
+	sources := make(map[childRef]string)
+	for _, entry := range strings.Split(podTemplate.GetAnnotations()[ConfigSnapshotsAnnotation], ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		kindAndName := strings.SplitN(parts[0], "/", 2)
+		if len(kindAndName) != 2 {
+			continue
+		}
+		sources[childRef{kind: kindAndName[0], name: GetNamespacedName(kindAndName[1], "")}] = parts[1]
+	}
+	return sources
+}
+
+// renameReferences renames all ConfigMap and Secret references in the PodSpec
+func renameReferences(spec *corev1.PodSpec, configMapName func(string) string, secretName func(string) string) {
+	for i := range spec.Volumes {
+		source := &spec.Volumes[i].VolumeSource
+		if source.ConfigMap != nil {
+			source.ConfigMap.Name = configMapName(source.ConfigMap.Name)
+		}
+		if source.Secret != nil {
+			source.Secret.SecretName = secretName(source.Secret.SecretName)
+		}
+		if source.Projected != nil {
+			for j := range source.Projected.Sources {
+				projection := &source.Projected.Sources[j]
+				if projection.ConfigMap != nil {
+					projection.ConfigMap.Name = configMapName(projection.ConfigMap.Name)
+				}
+				if projection.Secret != nil {
+					projection.Secret.Name = secretName(projection.Secret.Name)
+				}
+			}
+		}
+	}
+
+	renameContainers := func(containers []corev1.Container) {
+		for i := range containers {
+			for j := range containers[i].EnvFrom {
+				envFrom := &containers[i].EnvFrom[j]
+				if envFrom.ConfigMapRef != nil {
+					envFrom.ConfigMapRef.Name = configMapName(envFrom.ConfigMapRef.Name)
+				}
+				if envFrom.SecretRef != nil {
+					envFrom.SecretRef.Name = secretName(envFrom.SecretRef.Name)
+				}
+			}
+			for j := range containers[i].Env {
+				if valueFrom := containers[i].Env[j].ValueFrom; valueFrom != nil {
+					if valueFrom.ConfigMapKeyRef != nil {
+						valueFrom.ConfigMapKeyRef.Name = configMapName(valueFrom.ConfigMapKeyRef.Name)
+					}
+					if valueFrom.SecretKeyRef != nil {
+						valueFrom.SecretKeyRef.Name = secretName(valueFrom.SecretKeyRef.Name)
+					}
+				}
+			}
+		}
+	}
+	renameContainers(spec.InitContainers)
+	renameContainers(spec.Containers)
+}
+
+// hasSnapshotReferences returns true if the PodTemplate of the instance
+// references snapshots created by Wave
+func hasSnapshotReferences[I InstanceType](instance I) bool {
+	_, ok := GetPodTemplate(instance).GetAnnotations()[ConfigSnapshotsAnnotation]
+	return ok
+}
+
+// sourceInstance returns the instance with all snapshot references in its
+// PodTemplate replaced by the references to their sources. If the children of
+// the instance are not snapshotted the instance itself is returned.
+func (h *Handler[I]) sourceInstance(instance I) I {
+	if !hasSnapshotReferences(instance) {
+		return instance
+	}
+	source := instance.DeepCopyObject().(I)
+	restoreSnapshotSources(source)
+	return source
+}
+
+// restoreSnapshotSources replaces all snapshot references in the PodTemplate
+// of the instance by the references to their sources and removes the snapshot
+// annotations. It returns whether the instance changed.
+func restoreSnapshotSources[I InstanceType](instance I) bool {
+	changed := false
+	annotations := instance.GetAnnotations()
+	if _, ok := annotations[SnapshotHashAnnotation]; ok {
+		delete(annotations, SnapshotHashAnnotation)
+		instance.SetAnnotations(annotations)
+		changed = true
+	}
+	if !hasSnapshotReferences(instance) {
+		return changed
+	}
+
+	podTemplate := GetPodTemplate(instance).DeepCopy()
+	sources := snapshotSources(podTemplate)
+	rename := func(kind string) func(string) string {
+		return func(name string) string {
+			if sourceName, ok := sources[childRef{kind: kind, name: GetNamespacedName(name, "")}]; ok {
+				return sourceName
+			}
+			return name
+		}
+	}
+	renameReferences(&podTemplate.Spec, rename(configMapKind), rename(secretKind))
+	delete(podTemplate.Annotations, ConfigSnapshotsAnnotation)
+	SetPodTemplate(instance, podTemplate)
+	return true
+}
+
+// referencesLiveChildren returns true if the PodTemplate of the instance
+// references an existing child directly instead of its snapshot
+func referencesLiveChildren[I InstanceType](instance I, configMaps map[types.NamespacedName]*corev1.ConfigMap, secrets map[types.NamespacedName]*corev1.Secret) bool {
+	live := false
+	spec := GetPodTemplate(instance).DeepCopy().Spec
+	renameReferences(&spec, func(name string) string {
+		if cm, ok := configMaps[GetNamespacedName(name, instance.GetNamespace())]; ok && !isSnapshot(cm) {
+			live = true
+		}
+		return name
+	}, func(name string) string {
+		if s, ok := secrets[GetNamespacedName(name, instance.GetNamespace())]; ok && !isSnapshot(s) && isSnapshottable(s) {
+			live = true
+		}
+		return name
+	})
+	return live
+}
+
+// isSnapshottable returns false for Secrets which can not be copied
+func isSnapshottable(s *corev1.Secret) bool {
+	return s.Type != corev1.SecretTypeServiceAccountToken
+}
+
+// isSnapshot returns true if the object is a snapshot created by Wave
+func isSnapshot(obj metav1.Object) bool {
+	return obj.GetLabels()[SnapshotLabel] == requiredAnnotationValue
+}
+
+// applySnapshots creates immutable snapshots of all children referenced in
+// the PodTemplate of the source instance and rewrites the references in the
+// instance to point to the snapshots. The snapshots are only created if create
+// is true (i.e. not on a dry run).
+func (h *Handler[I]) applySnapshots(ctx context.Context, instance I, source I, configMaps map[types.NamespacedName]*corev1.ConfigMap, secrets map[types.NamespacedName]*corev1.Secret, hash string, create bool) error {
+	mapping := []string{}
+	snapshots := make(map[childRef]Object)
+
+	podTemplate := GetPodTemplate(source).DeepCopy()
+	renameReferences(&podTemplate.Spec, func(name string) string {
+		cm, ok := configMaps[GetNamespacedName(name, instance.GetNamespace())]
+		if !ok || isSnapshot(cm) {
+			return name
+		}
+		snapshot := newConfigMapSnapshot(cm)
+		snapshots[childRef{kind: configMapKind, name: GetNamespacedNameFromObject(snapshot)}] = snapshot
+		mapping = append(mapping, fmt.Sprintf("%s/%s=%s", configMapKind, snapshot.GetName(), name))
+		return snapshot.GetName()
+	}, func(name string) string {
+		s, ok := secrets[GetNamespacedName(name, instance.GetNamespace())]
+		if !ok || isSnapshot(s) || !isSnapshottable(s) {
+			return name
+		}
+		snapshot := newSecretSnapshot(s)
+		snapshots[childRef{kind: secretKind, name: GetNamespacedNameFromObject(snapshot)}] = snapshot
+		mapping = append(mapping, fmt.Sprintf("%s/%s=%s", secretKind, snapshot.GetName(), name))
+		return snapshot.GetName()
+	})
+
+	if create {
+		for _, snapshot := range snapshots {
+			if err := h.createSnapshot(ctx, snapshot); err != nil {
+				return err
+			}
+		}
+	}
+
+	sort.Strings(mapping)
+	annotations := podTemplate.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[ConfigSnapshotsAnnotation] = strings.Join(dedupe(mapping), ",")
+	annotations[ConfigHashAnnotation] = hash
+	podTemplate.SetAnnotations(annotations)
+	SetPodTemplate(instance, podTemplate)
+
+	setSnapshotHash(instance, hash)
+	return nil
+}
+
+// dedupe removes duplicates from a sorted slice
+func dedupe(values []string) []string {
+	result := []string{}
+	for i, value := range values {
+		if i == 0 || values[i-1] != value {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+// newConfigMapSnapshot returns an immutable copy of the ConfigMap
+func newConfigMapSnapshot(cm *corev1.ConfigMap) *corev1.ConfigMap {
+	immutable := true
+	return &corev1.ConfigMap{
+		ObjectMeta: snapshotObjectMeta(cm),
+		Data:       cm.Data,
+		BinaryData: cm.BinaryData,
+		Immutable:  &immutable,
+	}
+}
+
+// newSecretSnapshot returns an immutable copy of the Secret
+func newSecretSnapshot(s *corev1.Secret) *corev1.Secret {
+	immutable := true
+	return &corev1.Secret{
+		ObjectMeta: snapshotObjectMeta(s),
+		Type:       s.Type,
+		Data:       s.Data,
+		Immutable:  &immutable,
+	}
+}
+
+func snapshotObjectMeta(source Object) metav1.ObjectMeta {
+	return metav1.ObjectMeta{
+		Name:      snapshotName(source),
+		Namespace: source.GetNamespace(),
+		Labels: map[string]string{
+			SnapshotLabel: requiredAnnotationValue,
+		},
+		Annotations: map[string]string{
+			SnapshotSourceAnnotation: source.GetName(),
+		},
+	}
+}
+
+// createSnapshot creates the snapshot unless it already exists. An existing
+// object is only used if it is a snapshot of the same source with the same data.
+func (h *Handler[I]) createSnapshot(ctx context.Context, snapshot Object) error {
+	err := h.Create(ctx, snapshot)
+	if err == nil {
+		return nil
+	}
+	if !errors.IsAlreadyExists(err) {
+		return fmt.Errorf("error creating snapshot %s %s/%s: %v", kindOf(snapshot), snapshot.GetNamespace(), snapshot.GetName(), err)
+	}
+
+	existing := snapshot.DeepCopyObject().(Object)
+	if err := h.apiReader.Get(ctx, GetNamespacedNameFromObject(snapshot), existing); err != nil {
+		return fmt.Errorf("error getting snapshot %s %s/%s: %v", kindOf(snapshot), snapshot.GetNamespace(), snapshot.GetName(), err)
+	}
+	source := snapshot.GetAnnotations()[SnapshotSourceAnnotation]
+	if !isSnapshot(existing) || existing.GetAnnotations()[SnapshotSourceAnnotation] != source || childDataHash(existing) != childDataHash(snapshot) {
+		return fmt.Errorf("%s %s/%s already exists and is not a snapshot of %s", kindOf(snapshot), snapshot.GetNamespace(), snapshot.GetName(), source)
+	}
+	return nil
+}
+
+// getSnapshotHash returns the hash of the children at the time of the last snapshot
+func getSnapshotHash(obj metav1.Object) string {
+	return obj.GetAnnotations()[SnapshotHashAnnotation]
+}
+
+// setSnapshotHash sets the hash of the children at the time of the last snapshot
+func setSnapshotHash(obj metav1.Object, hash string) {
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[SnapshotHashAnnotation] = hash
+	obj.SetAnnotations(annotations)
+}
+
+// collectSnapshots deletes all snapshots in the namespace which are not
+// referenced by any workload, ReplicaSet or ControllerRevision anymore
+func (h *Handler[I]) collectSnapshots(ctx context.Context, namespace string) error {
+	return NewSnapshotCollector(h.Client, h.apiReader, nil).collect(ctx, namespace)
+}
+
+// SnapshotCollector periodically deletes the snapshots which are not
+// referenced anymore. Workloads collect the snapshots in their namespace
+// whenever they reference new snapshots, the SnapshotCollector also collects
+// the snapshots of workloads which were deleted or opted out.
+type SnapshotCollector struct {
+	client     client.Client
+	apiReader  client.Reader
+	namespaces []string
+	interval   time.Duration
+}
+
+// NewSnapshotCollector returns a SnapshotCollector for the namespaces (all
+// namespaces if empty). The apiReader reads ReplicaSets and ControllerRevisions
+// without caching them.
+func NewSnapshotCollector(c client.Client, apiReader client.Reader, namespaces []string) *SnapshotCollector {
+	if apiReader == nil {
+		apiReader = c
+	}
+	return &SnapshotCollector{
+		client:     c,
+		apiReader:  apiReader,
+		namespaces: namespaces,
+		interval:   snapshotGracePeriod,
+	}
+}
+
+// Start collects the snapshots until the context is cancelled
+func (sc *SnapshotCollector) Start(ctx context.Context) error {
+	log := logf.Log.WithName("wave")
+	ticker := time.NewTicker(sc.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := sc.collectAll(ctx); err != nil {
+				log.Error(err, "Unable to collect unreferenced snapshots")
+			}
+		}
+	}
+}
+
+// NeedLeaderElection makes sure that only the leader deletes snapshots
+func (sc *SnapshotCollector) NeedLeaderElection() bool {
+	return true
+}
+
+// collectAll collects the snapshots in all namespaces which contain snapshots
+func (sc *SnapshotCollector) collectAll(ctx context.Context) error {
+	namespaces := sc.namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{""}
+	}
+	isSnapshot := client.MatchingLabels{SnapshotLabel: requiredAnnotationValue}
+
+	withSnapshots := make(map[string]bool)
+	for _, namespace := range namespaces {
+		configMaps := &corev1.ConfigMapList{}
+		if err := sc.apiReader.List(ctx, configMaps, client.InNamespace(namespace), isSnapshot); err != nil {
+			return fmt.Errorf("error listing ConfigMap snapshots: %v", err)
+		}
+		for _, cm := range configMaps.Items {
+			withSnapshots[cm.GetNamespace()] = true
+		}
+		secrets := &corev1.SecretList{}
+		if err := sc.apiReader.List(ctx, secrets, client.InNamespace(namespace), isSnapshot); err != nil {
+			return fmt.Errorf("error listing Secret snapshots: %v", err)
+		}
+		for _, secret := range secrets.Items {
+			withSnapshots[secret.GetNamespace()] = true
+		}
+	}
+
+	var errs []error
+	for namespace := range withSnapshots {
+		if err := sc.collect(ctx, namespace); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return kerrors.NewAggregate(errs)
+}
+
+// collect deletes all snapshots in the namespace which are not referenced by
+// any workload, ReplicaSet or ControllerRevision anymore
+func (sc *SnapshotCollector) collect(ctx context.Context, namespace string) error {
+	log := logf.Log.WithName("wave").WithValues("namespace", namespace)
+	inNamespace := client.InNamespace(namespace)
+	isSnapshot := client.MatchingLabels{SnapshotLabel: requiredAnnotationValue}
+
+	configMaps := &corev1.ConfigMapList{}
+	if err := sc.apiReader.List(ctx, configMaps, inNamespace, isSnapshot); err != nil {
+		return fmt.Errorf("error listing ConfigMap snapshots: %v", err)
+	}
+	secrets := &corev1.SecretList{}
+	if err := sc.apiReader.List(ctx, secrets, inNamespace, isSnapshot); err != nil {
+		return fmt.Errorf("error listing Secret snapshots: %v", err)
+	}
+	if len(configMaps.Items) == 0 && len(secrets.Items) == 0 {
+		return nil
+	}
+
+	configMapRefs, secretRefs, revisions, err := sc.snapshotReferences(ctx, namespace)
+	if err != nil {
+		return err
+	}
+
+	isReferenced := func(name string, refs map[string]bool) bool {
+		if refs[name] {
+			return true
+		}
+		quoted := []byte(fmt.Sprintf("%q", name))
+		for _, revision := range revisions {
+			if bytes.Contains(revision, quoted) {
+				return true
+			}
+		}
+		return false
+	}
+	isCollectable := func(obj metav1.Object, refs map[string]bool) bool {
+		return time.Since(obj.GetCreationTimestamp().Time) > snapshotGracePeriod && !isReferenced(obj.GetName(), refs)
+	}
+
+	for i := range configMaps.Items {
+		cm := &configMaps.Items[i]
+		if isCollectable(cm, configMapRefs) {
+			log.V(1).Info("Deleting unreferenced snapshot", "configmap", cm.GetName())
+			if err := sc.client.Delete(ctx, cm); err != nil && !errors.IsNotFound(err) {
+				return fmt.Errorf("error deleting snapshot ConfigMap %s/%s: %v", namespace, cm.GetName(), err)
+			}
+		}
+	}
+	for i := range secrets.Items {
+		s := &secrets.Items[i]
+		if isCollectable(s, secretRefs) {
+			log.V(1).Info("Deleting unreferenced snapshot", "secret", s.GetName())
+			if err := sc.client.Delete(ctx, s); err != nil && !errors.IsNotFound(err) {
+				return fmt.Errorf("error deleting snapshot Secret %s/%s: %v", namespace, s.GetName(), err)
+			}
+		}
+	}
+	return nil
+}
+
+// snapshotReferences returns the names of all ConfigMaps and Secrets
+// referenced by the PodTemplates of the workloads and ReplicaSets in the
+// namespace and the raw data of all ControllerRevisions in the namespace
+func (sc *SnapshotCollector) snapshotReferences(ctx context.Context, namespace string) (map[string]bool, map[string]bool, [][]byte, error) {
+	inNamespace := client.InNamespace(namespace)
+	configMapRefs := make(map[string]bool)
+	secretRefs := make(map[string]bool)
+	addReferences := func(spec corev1.PodSpec) {
+		renameReferences(&spec, func(name string) string {
+			configMapRefs[name] = true
+			return name
+		}, func(name string) string {
+			secretRefs[name] = true
+			return name
+		})
+	}
+
+	deployments := &appsv1.DeploymentList{}
+	if err := sc.apiReader.List(ctx, deployments, inNamespace); err != nil {
+		return nil, nil, nil, fmt.Errorf("error listing Deployments: %v", err)
+	}
+	for _, d := range deployments.Items {
+		addReferences(d.Spec.Template.Spec)
+	}
+	statefulSets := &appsv1.StatefulSetList{}
+	if err := sc.apiReader.List(ctx, statefulSets, inNamespace); err != nil {
+		return nil, nil, nil, fmt.Errorf("error listing StatefulSets: %v", err)
+	}
+	for _, s := range statefulSets.Items {
+		addReferences(s.Spec.Template.Spec)
+	}
+	daemonSets := &appsv1.DaemonSetList{}
+	if err := sc.apiReader.List(ctx, daemonSets, inNamespace); err != nil {
+		return nil, nil, nil, fmt.Errorf("error listing DaemonSets: %v", err)
+	}
+	for _, d := range daemonSets.Items {
+		addReferences(d.Spec.Template.Spec)
+	}
+	replicaSets := &appsv1.ReplicaSetList{}
+	if err := sc.apiReader.List(ctx, replicaSets, inNamespace); err != nil {
+		return nil, nil, nil, fmt.Errorf("error listing ReplicaSets: %v", err)
+	}
+	for _, rs := range replicaSets.Items {
+		addReferences(rs.Spec.Template.Spec)
+	}
+
+	controllerRevisions := &appsv1.ControllerRevisionList{}
+	if err := sc.apiReader.List(ctx, controllerRevisions, inNamespace); err != nil {
+		return nil, nil, nil, fmt.Errorf("error listing ControllerRevisions: %v", err)
+	}
+	revisions := [][]byte{}
+	for _, revision := range controllerRevisions.Items {
+		revisions = append(revisions, revision.Data.Raw)
+	}
+	return configMapRefs, secretRefs, revisions, nil
+}
+
+// currentHash returns the hash the instance was last updated with. For
+// snapshotted children this is kept on the instance instead of the PodTemplate
+// so that a rollback of the PodTemplate does not trigger a new rollout.
+func (h *Handler[I]) currentHash(instance I) string {
+	if h.snapshotsEnabled(instance) {
+		return getSnapshotHash(instance)
+	}
+	return getConfigHash(instance)
+}
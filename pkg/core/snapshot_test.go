@@ -0,0 +1,160 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Wave snapshot Suite", func() {
+	var h *Handler[*appsv1.Deployment]
+	var instance *appsv1.Deployment
+	var cm *corev1.ConfigMap
+	var s *corev1.Secret
+	var configMaps map[types.NamespacedName]*corev1.ConfigMap
+	var secrets map[types.NamespacedName]*corev1.Secret
+
+	BeforeEach(func() {
+		h = NewHandler[*appsv1.Deployment](nil, record.NewFakeRecorder(10), HandlerOptions{EnableSnapshots: true})
+		instance = utils.ExampleDeployment.DeepCopy()
+		instance.Annotations[SnapshotConfigAnnotation] = requiredAnnotationValue
+
+		cm = utils.ExampleConfigMap1.DeepCopy()
+		s = utils.ExampleSecret1.DeepCopy()
+		configMaps = map[types.NamespacedName]*corev1.ConfigMap{GetNamespacedNameFromObject(cm): cm}
+		secrets = map[types.NamespacedName]*corev1.Secret{GetNamespacedNameFromObject(s): s}
+	})
+
+	Context("snapshotName", func() {
+		It("depends on the content of the child", func() {
+			name := snapshotName(cm)
+			Expect(name).To(HavePrefix(cm.GetName() + "-"))
+			Expect(name).To(HaveLen(len(cm.GetName()) + 1 + snapshotHashLength))
+
+			cm.Data["key1"] = "modified"
+			Expect(snapshotName(cm)).NotTo(Equal(name))
+		})
+
+		It("does not exceed the maximum name length", func() {
+			cm.SetName(strings.Repeat("a", 253))
+			Expect(snapshotName(cm)).To(HaveLen(253))
+		})
+	})
+
+	Context("snapshotSources", func() {
+		It("parses the mapping of snapshots to their sources", func() {
+			podTemplate := &corev1.PodTemplateSpec{}
+			podTemplate.SetAnnotations(map[string]string{ConfigSnapshotsAnnotation: "configmap/a-0123456789=a, secret/b-0123456789=b,invalid"})
+			Expect(snapshotSources(podTemplate)).To(Equal(map[childRef]string{
+				{kind: configMapKind, name: GetNamespacedName("a-0123456789", "")}: "a",
+				{kind: secretKind, name: GetNamespacedName("b-0123456789", "")}:    "b",
+			}))
+		})
+	})
+
+	Context("applySnapshots", func() {
+		BeforeEach(func() {
+			Expect(h.applySnapshots(context.TODO(), instance, h.sourceInstance(instance), configMaps, secrets, "hash", false)).To(Succeed())
+		})
+
+		It("rewrites the references to the snapshots", func() {
+			spec := instance.Spec.Template.Spec
+			Expect(spec.Volumes[0].Secret.SecretName).To(Equal(snapshotName(s)))
+			Expect(spec.Volumes[2].ConfigMap.Name).To(Equal(snapshotName(cm)))
+			Expect(spec.Containers[0].Env[0].ValueFrom.ConfigMapKeyRef.Name).To(Equal(snapshotName(cm)))
+			Expect(referencesLiveChildren(instance, configMaps, secrets)).To(BeFalse())
+		})
+
+		It("records the hash and the sources of the snapshots", func() {
+			Expect(getSnapshotHash(instance)).To(Equal("hash"))
+			Expect(getConfigHash(instance)).To(Equal("hash"))
+			Expect(instance.Spec.Template.Annotations[ConfigSnapshotsAnnotation]).To(Equal(
+				"configmap/" + snapshotName(cm) + "=example1,secret/" + snapshotName(s) + "=example1"))
+		})
+
+		It("restores the references to the sources", func() {
+			source := h.sourceInstance(instance)
+			Expect(source.Spec.Template.Spec.Volumes[0].Secret.SecretName).To(Equal("example1"))
+			Expect(source.Spec.Template.Spec.Volumes[2].ConfigMap.Name).To(Equal("example1"))
+			configMapsConfig, secretsConfig := getChildNamesByType(source)
+			expectedConfigMapsConfig, expectedSecretsConfig := getChildNamesByType(utils.ExampleDeployment.DeepCopy())
+			Expect(configMapsConfig).To(Equal(expectedConfigMapsConfig))
+			Expect(secretsConfig).To(Equal(expectedSecretsConfig))
+		})
+
+		It("mounts the sources again when the snapshots are dropped", func() {
+			Expect(restoreSnapshotSources(instance)).To(BeTrue())
+			Expect(instance.Spec.Template.Spec).To(Equal(utils.ExampleDeployment.Spec.Template.Spec))
+			Expect(instance.Spec.Template.Annotations).NotTo(HaveKey(ConfigSnapshotsAnnotation))
+			Expect(instance.Annotations).NotTo(HaveKey(SnapshotHashAnnotation))
+			Expect(restoreSnapshotSources(instance)).To(BeFalse())
+		})
+	})
+
+	Context("createSnapshot", func() {
+		It("uses an existing snapshot of the same child", func() {
+			c := fake.NewClientBuilder().WithObjects(newConfigMapSnapshot(cm)).Build()
+			h = NewHandler[*appsv1.Deployment](c, record.NewFakeRecorder(10), HandlerOptions{EnableSnapshots: true})
+			Expect(h.createSnapshot(context.TODO(), newConfigMapSnapshot(cm))).To(Succeed())
+		})
+
+		It("does not use objects which are not a snapshot of the child", func() {
+			existing := cm.DeepCopy()
+			existing.ObjectMeta = metav1.ObjectMeta{Name: snapshotName(cm), Namespace: cm.GetNamespace()}
+			c := fake.NewClientBuilder().WithObjects(existing).Build()
+			h = NewHandler[*appsv1.Deployment](c, record.NewFakeRecorder(10), HandlerOptions{EnableSnapshots: true})
+			err := h.createSnapshot(context.TODO(), newConfigMapSnapshot(cm))
+			Expect(err).To(MatchError(ContainSubstring("already exists and is not a snapshot of example1")))
+		})
+	})
+
+	Context("SnapshotCollector", func() {
+		It("deletes snapshots which are no longer referenced", func() {
+			Expect(h.applySnapshots(context.TODO(), instance, h.sourceInstance(instance), configMaps, secrets, "hash", false)).To(Succeed())
+			referenced := newConfigMapSnapshot(cm)
+			cm.Data["key1"] = "modified"
+			unreferenced := newConfigMapSnapshot(cm)
+			c := fake.NewClientBuilder().WithObjects(instance, referenced, unreferenced).Build()
+
+			Expect(NewSnapshotCollector(c, nil, nil).collectAll(context.TODO())).To(Succeed())
+			Expect(c.Get(context.TODO(), client.ObjectKeyFromObject(referenced), &corev1.ConfigMap{})).To(Succeed())
+			err := c.Get(context.TODO(), client.ObjectKeyFromObject(unreferenced), &corev1.ConfigMap{})
+			Expect(err).To(MatchError(ContainSubstring("not found")))
+		})
+	})
+
+	It("does not snapshot children if snapshots are disabled", func() {
+		h = NewHandler[*appsv1.Deployment](nil, record.NewFakeRecorder(10), HandlerOptions{})
+		Expect(h.snapshotsEnabled(instance)).To(BeFalse())
+	})
+
+	It("detects references to live children", func() {
+		Expect(referencesLiveChildren(instance, configMaps, secrets)).To(BeTrue())
+	})
+})
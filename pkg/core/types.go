@@ -25,9 +25,22 @@ const (
 	// due to missing children and contains the original scheduler
 	SchedulingDisabledAnnotation = "wave.pusher.com/scheduling-disabled"
 
+	// SchedulingDisabledSinceAnnotation is set on a deployment together with
+	// SchedulingDisabledAnnotation and contains the time scheduling was disabled
+	SchedulingDisabledSinceAnnotation = "wave.pusher.com/scheduling-disabled-since"
+
+	// SchedulingDisabledByAnnotation records the Wave installation which
+	// disabled scheduling so that it restores scheduling if it no longer owns
+	// the workload
+	SchedulingDisabledByAnnotation = "wave.pusher.com/scheduling-disabled-by"
+
 	// SchedulingDisabledSchedulerName is the dummy scheduler to disable scheduling of pods
 	SchedulingDisabledSchedulerName = "wave.pusher.com/invalid"
 
+	// SchedulingGateName is the scheduling gate added to pods while their
+	// required children are missing if the cluster supports scheduling gates
+	SchedulingGateName = "wave.pusher.com/missing-config"
+
 	// ExtraConfigMapsAnnotation is the key of the annotation that contains additional
 	// ConfigMaps which Wave should watch
 	ExtraConfigMapsAnnotation = "wave.pusher.com/extra-configmaps"
@@ -40,6 +53,95 @@ const (
 	// checks for before processing the deployment
 	RequiredAnnotation = "wave.pusher.com/update-on-config-change"
 
+	// BlastRadiusPendingAnnotation is set on a workload while its rollout is
+	// paused by the BlastRadiusBreaker and contains the children causing it
+	BlastRadiusPendingAnnotation = "wave.pusher.com/blast-radius-pending"
+
+	// BlastRadiusOverrideAnnotation can be set to "true" on a child or on a
+	// workload to let rollouts paused by the BlastRadiusBreaker continue
+	BlastRadiusOverrideAnnotation = "wave.pusher.com/blast-radius-override"
+
+	// RolloutAfterAnnotation is the key of the annotation that contains workloads
+	// (e.g. deployment/backend) which have to complete their rollout before Wave
+	// updates the annotated workload for a shared configuration change
+	RolloutAfterAnnotation = "wave.pusher.com/rollout-after"
+
+	// RolloutStatusAnnotation is set on a workload after Wave updated its hash and
+	// contains the state of the resulting rollout (Progressing, Succeeded, Stalled)
+	RolloutStatusAnnotation = "wave.pusher.com/rollout-status"
+
+	// RolloutTriggerAnnotation is set on a workload after Wave updated its hash
+	// and contains the children whose change triggered the rollout
+	RolloutTriggerAnnotation = "wave.pusher.com/rollout-trigger"
+
+	// SnapshotConfigAnnotation can be set to "true" on a workload to mount
+	// immutable snapshots of its children instead of the children themselves
+	// (requires --enable-config-snapshots)
+	SnapshotConfigAnnotation = "wave.pusher.com/snapshot-config"
+
+	// SnapshotHashAnnotation is set on a workload and contains the hash of the
+	// children at the time their snapshots were referenced
+	SnapshotHashAnnotation = "wave.pusher.com/snapshot-hash"
+
+	// ConfigSnapshotsAnnotation is set on the PodTemplate and maps the
+	// referenced snapshots to their children (e.g. configmap/app-config-0123456789=app-config)
+	ConfigSnapshotsAnnotation = "wave.pusher.com/config-snapshots"
+
+	// SnapshotLabel is set to "true" on all snapshots created by Wave
+	SnapshotLabel = "wave.pusher.com/snapshot"
+
+	// SnapshotSourceAnnotation is set on a snapshot and contains the name of
+	// the child it was copied from
+	SnapshotSourceAnnotation = "wave.pusher.com/snapshot-source"
+
+	// ControllerClassAnnotation selects the Wave installation which manages a
+	// workload. Workloads without it belong to the installation without a
+	// --controller-class.
+	ControllerClassAnnotation = "wave.pusher.com/controller-class"
+
+	// ControllerClassLabel selects the Wave installation like the
+	// ControllerClassAnnotation. Unlike the annotation, it can be matched by
+	// the objectSelector of the webhooks of an installation. The annotation
+	// takes precedence if both are set.
+	ControllerClassLabel = "wave.pusher.com/controller-class"
+
+	// ChildDeletionPolicyAnnotation can be set on a workload to override how
+	// the deletion of a referenced child is handled (roll, freeze or ignore)
+	ChildDeletionPolicyAnnotation = "wave.pusher.com/on-child-deletion"
+
+	// MissingChildrenPolicyAnnotation can be set on a workload to override
+	// how updates adding required references to missing children are handled
+	// (hold, gate or proceed)
+	MissingChildrenPolicyAnnotation = "wave.pusher.com/missing-children-policy"
+
+	// MissingChildrenAnnotation is set on a workload after an update added
+	// required references to missing children and contains the applied policy
+	// and the missing children
+	MissingChildrenAnnotation = "wave.pusher.com/missing-children"
+
+	// UnreadableChildrenPolicyAnnotation can be set on a workload to override
+	// how children which cannot be read are handled (block or hash-readable)
+	UnreadableChildrenPolicyAnnotation = "wave.pusher.com/on-unreadable-children"
+
+	// UnreadableChildrenAnnotation is set on a workload while children it
+	// references cannot be read and contains them as kind/namespace/name
+	UnreadableChildrenAnnotation = "wave.pusher.com/unreadable-children"
+
+	// ImagePullSecretsAnnotation can be set to "true" on a workload to treat
+	// the image pull Secrets of its pods and their ServiceAccount as children
+	// if Wave watches image pull Secrets
+	ImagePullSecretsAnnotation = "wave.pusher.com/image-pull-secrets"
+
+	// RehashRequestedAnnotation is set on a workload by kubectl wave rehash
+	// and contains the time of the request. Its update makes the controller
+	// reconcile the workload, which only rolls if its hash changed.
+	RehashRequestedAnnotation = "wave.pusher.com/rehash-requested-at"
+
+	// DependencyProtectionOverrideAnnotation can be set to "true" on a
+	// ConfigMap or Secret to allow deletes and key removals which would break
+	// required references of workloads
+	DependencyProtectionOverrideAnnotation = "wave.pusher.com/dependency-protection-override"
+
 	// requiredAnnotationValue is the value of the annotation on the Deployment that Wave
 	// checks for before processing the deployment
 	requiredAnnotationValue = "true"
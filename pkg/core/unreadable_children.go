@@ -0,0 +1,145 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// UnreadableChildrenPolicy controls how Wave handles workloads which
+// reference children it cannot read, e.g. because it is not allowed to
+type UnreadableChildrenPolicy string
+
+const (
+	// UnreadableChildrenBlock keeps the current hash until all children can
+	// be read
+	UnreadableChildrenBlock UnreadableChildrenPolicy = "block"
+
+	// UnreadableChildrenHashReadable calculates the hash from the children
+	// which can be read and leaves out the others
+	UnreadableChildrenHashReadable UnreadableChildrenPolicy = "hash-readable"
+)
+
+// ParseUnreadableChildrenPolicy parses the value of the
+// --unreadable-children-policy flag or annotation
+func ParseUnreadableChildrenPolicy(value string) (UnreadableChildrenPolicy, error) {
+	switch policy := UnreadableChildrenPolicy(value); policy {
+	case UnreadableChildrenBlock, UnreadableChildrenHashReadable:
+		return policy, nil
+	}
+	return "", fmt.Errorf("invalid unreadable children policy %q: must be %s or %s", value, UnreadableChildrenBlock, UnreadableChildrenHashReadable)
+}
+
+// unreadableChild is a child which could not be read
+type unreadableChild struct {
+	childRef
+	err error
+}
+
+// reason returns forbidden if Wave is not allowed to read the child and error
+// for any other problem
+func (c unreadableChild) reason() string {
+	if errors.IsForbidden(c.err) {
+		return "forbidden"
+	}
+	return "error"
+}
+
+// describeUnreadableChildren returns every unreadable child with its error
+func describeUnreadableChildren(unreadable []unreadableChild) string {
+	descriptions := []string{}
+	for _, child := range unreadable {
+		descriptions = append(descriptions, fmt.Sprintf("%s: %v", child.childRef, child.err))
+	}
+	return strings.Join(descriptions, ", ")
+}
+
+// unreadableChildrenPolicy returns the policy of the instance, which may be
+// overridden by an annotation
+func (h *Handler[I]) unreadableChildrenPolicy(instance I) UnreadableChildrenPolicy {
+	if value, ok := instance.GetAnnotations()[UnreadableChildrenPolicyAnnotation]; ok {
+		if policy, err := ParseUnreadableChildrenPolicy(value); err == nil {
+			return policy
+		}
+	}
+	return h.defaultUnreadableChildrenPolicy
+}
+
+// reportUnreadableChildren logs, counts and records a Warning event for the
+// children of the instance which could not be read
+func (h *Handler[I]) reportUnreadableChildren(instance I, unreadable []unreadableChild) {
+	log := logf.Log.WithName("wave").WithValues("namespace", instance.GetNamespace(), "name", instance.GetName())
+	for _, child := range unreadable {
+		childReadErrorsTotal.WithLabelValues(h.kind, child.kind, child.reason()).Inc()
+		log.V(0).Info("Unable to read child", "child", child.childRef.String(), "reason", child.reason(), "err", child.err)
+	}
+	h.recorder.Eventf(instance, corev1.EventTypeWarning, "ChildrenUnreadable", "Unable to read children: %s", describeUnreadableChildren(unreadable))
+}
+
+// setUnreadableChildrenStatus records the unreadable children of the instance
+// in an annotation, or removes it if there are none, and returns true if the
+// annotation changed
+func setUnreadableChildrenStatus[I InstanceType](instance I, unreadable []unreadableChild) bool {
+	refs := []string{}
+	for _, child := range unreadable {
+		refs = append(refs, child.childRef.String())
+	}
+	status := strings.Join(refs, ",")
+
+	annotations := instance.GetAnnotations()
+	current, ok := annotations[UnreadableChildrenAnnotation]
+	if status == "" {
+		if !ok {
+			return false
+		}
+		delete(annotations, UnreadableChildrenAnnotation)
+		instance.SetAnnotations(annotations)
+		return true
+	}
+	if ok && current == status {
+		return false
+	}
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[UnreadableChildrenAnnotation] = status
+	instance.SetAnnotations(annotations)
+	return true
+}
+
+// withoutUnreadableChildren returns the children without the unreadable ones
+func withoutUnreadableChildren(configMapsConfig configMetadataList, secretsConfig configMetadataList, unreadable []unreadableChild) (configMetadataList, configMetadataList) {
+	isUnreadable := make(map[childRef]bool)
+	for _, child := range unreadable {
+		isUnreadable[child.childRef] = true
+	}
+	filter := func(kind string, children configMetadataList) configMetadataList {
+		readable := configMetadataList{}
+		for _, child := range children {
+			if !isUnreadable[childRef{kind: kind, name: child.name}] {
+				readable = append(readable, child)
+			}
+		}
+		return readable
+	}
+	return filter(configMapKind, configMapsConfig), filter(secretKind, secretsConfig)
+}
@@ -0,0 +1,162 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"context"
+	"math"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	"golang.org/x/time/rate"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+var _ = Describe("Wave unreadable children Suite", func() {
+	var h *Handler[*appsv1.Deployment]
+	var c client.Client
+	var recorder *record.FakeRecorder
+	var deploymentObject *appsv1.Deployment
+	var forbidden bool
+
+	BeforeEach(func() {
+		deploymentObject = utils.ExampleDeployment.DeepCopy()
+		deploymentObject.Annotations[RequiredAnnotation] = requiredAnnotationValue
+		delete(deploymentObject.Annotations, ExtraConfigMapsAnnotation)
+		delete(deploymentObject.Annotations, ExtraSecretsAnnotation)
+		container := &deploymentObject.Spec.Template.Spec.Containers[0]
+		container.EnvFrom = append(container.EnvFrom, corev1.EnvFromSource{
+			SecretRef: &corev1.SecretEnvSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "restricted"},
+			},
+		})
+
+		objects := []client.Object{
+			deploymentObject,
+			&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "restricted", Namespace: deploymentObject.Namespace},
+				Data:       map[string][]byte{"key": []byte("value")},
+			},
+			utils.ExampleConfigMap1.DeepCopy(),
+			utils.ExampleConfigMap2.DeepCopy(),
+			utils.ExampleConfigMap3.DeepCopy(),
+			utils.ExampleConfigMap4.DeepCopy(),
+			utils.ExampleConfigMap5.DeepCopy(),
+			utils.ExampleConfigMap6.DeepCopy(),
+		}
+		for _, s := range []*corev1.Secret{
+			utils.ExampleSecret1.DeepCopy(),
+			utils.ExampleSecret2.DeepCopy(),
+			utils.ExampleSecret3.DeepCopy(),
+			utils.ExampleSecret4.DeepCopy(),
+			utils.ExampleSecret5.DeepCopy(),
+			utils.ExampleSecret6.DeepCopy(),
+		} {
+			// The fake client does not merge stringData into data like the API server
+			if s.Data == nil {
+				s.Data = map[string][]byte{}
+			}
+			for key, value := range s.StringData {
+				s.Data[key] = []byte(value)
+			}
+			objects = append(objects, s)
+		}
+
+		forbidden = true
+		c = fake.NewClientBuilder().WithObjects(objects...).WithInterceptorFuncs(interceptor.Funcs{
+			Get: func(ctx context.Context, c client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+				if _, ok := obj.(*corev1.Secret); ok && key.Name == "restricted" && forbidden {
+					return errors.NewForbidden(schema.GroupResource{Resource: "secrets"}, key.Name, nil)
+				}
+				return c.Get(ctx, key, obj, opts...)
+			},
+		}).Build()
+		recorder = record.NewFakeRecorder(10)
+		h = NewHandler[*appsv1.Deployment](c, recorder, HandlerOptions{
+			UpdateThrottler: NewUpdateThrottler(rate.Limit(math.Inf(1)), 1),
+		})
+	})
+
+	get := func() *appsv1.Deployment {
+		updated := &appsv1.Deployment{}
+		Expect(c.Get(context.TODO(), GetNamespacedNameFromObject(deploymentObject), updated)).To(Succeed())
+		return updated
+	}
+
+	It("keeps the hash while children cannot be read", func() {
+		_, err := h.Handle(context.TODO(), GetNamespacedNameFromObject(deploymentObject), &appsv1.Deployment{})
+		Expect(err).To(MatchError(ContainSubstring("secret/default/restricted")))
+		Expect(recorder.Events).To(Receive(ContainSubstring("ChildrenUnreadable")))
+
+		updated := get()
+		Expect(getConfigHash(updated)).To(BeEmpty())
+		Expect(updated.Annotations).To(HaveKeyWithValue(UnreadableChildrenAnnotation, "secret/default/restricted"))
+
+		forbidden = false
+		_, err = h.Handle(context.TODO(), GetNamespacedNameFromObject(deploymentObject), &appsv1.Deployment{})
+		Expect(err).NotTo(HaveOccurred())
+		updated = get()
+		Expect(getConfigHash(updated)).NotTo(BeEmpty())
+		Expect(updated.Annotations).NotTo(HaveKey(UnreadableChildrenAnnotation))
+	})
+
+	It("hashes the readable children with the hash-readable policy", func() {
+		deploymentObject.Annotations[UnreadableChildrenPolicyAnnotation] = string(UnreadableChildrenHashReadable)
+		Expect(c.Update(context.TODO(), deploymentObject)).To(Succeed())
+
+		_, err := h.Handle(context.TODO(), GetNamespacedNameFromObject(deploymentObject), &appsv1.Deployment{})
+		Expect(err).NotTo(HaveOccurred())
+		updated := get()
+		readableHash := getConfigHash(updated)
+		Expect(readableHash).NotTo(BeEmpty())
+		Expect(updated.Annotations).To(HaveKeyWithValue(UnreadableChildrenAnnotation, "secret/default/restricted"))
+
+		forbidden = false
+		_, err = h.Handle(context.TODO(), GetNamespacedNameFromObject(deploymentObject), &appsv1.Deployment{})
+		Expect(err).NotTo(HaveOccurred())
+		updated = get()
+		Expect(getConfigHash(updated)).NotTo(Equal(readableHash))
+		Expect(updated.Annotations).NotTo(HaveKey(UnreadableChildrenAnnotation))
+	})
+
+	It("skips the mutation in the webhook while children cannot be read", func() {
+		Expect(h.HandleWebhook(deploymentObject, nil, nil, true)).To(Succeed())
+		Expect(getConfigHash(deploymentObject)).To(BeEmpty())
+		Expect(deploymentObject.Annotations).To(HaveKeyWithValue(UnreadableChildrenAnnotation, "secret/default/restricted"))
+	})
+
+	It("returns an error describing every unreadable child", func() {
+		configMapsConfig, secretsConfig := getChildNamesByType(deploymentObject)
+		_, _, err := h.getCurrentChildren(configMapsConfig, secretsConfig)
+		Expect(err).To(MatchError(ContainSubstring("secret/default/restricted: secrets \"restricted\" is forbidden")))
+	})
+
+	It("parses the unreadable children policy", func() {
+		Expect(ParseUnreadableChildrenPolicy("hash-readable")).To(Equal(UnreadableChildrenHashReadable))
+		_, err := ParseUnreadableChildrenPolicy("ignore")
+		Expect(err).To(HaveOccurred())
+	})
+})
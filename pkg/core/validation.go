@@ -0,0 +1,166 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// ValidationMode controls how the validating webhook treats malformed Wave
+// annotations
+type ValidationMode string
+
+const (
+	// ValidationModeWarn admits workloads with malformed Wave annotations
+	// and returns admission warnings for them
+	ValidationModeWarn ValidationMode = "warn"
+
+	// ValidationModeReject rejects workloads with malformed Wave annotations
+	ValidationModeReject ValidationMode = "reject"
+
+	// annotationPrefix is the prefix of all annotations used by Wave
+	annotationPrefix = "wave.pusher.com/"
+)
+
+// ParseValidationMode parses the value of the --webhook-validation and
+// --dependency-protection flags
+func ParseValidationMode(value string) (ValidationMode, error) {
+	switch mode := ValidationMode(value); mode {
+	case ValidationModeWarn, ValidationModeReject:
+		return mode, nil
+	}
+	return "", fmt.Errorf("invalid validation mode %q: must be %s or %s", value, ValidationModeWarn, ValidationModeReject)
+}
+
+// ValidateWebhook is called by the validating webhook. Malformed Wave
+// annotations are rejected or returned as warnings depending on the
+// validation mode. Problems with the referenced children are always returned
+// as warnings since they may be created after the workload.
+func (h *Handler[I]) ValidateWebhook(instance I) ([]string, error) {
+	// Workloads of other Wave installations are validated by those
+	if !h.ownsInstance(instance) {
+		return nil, nil
+	}
+	warnings := h.validateReferences(instance)
+
+	errs := validateAnnotations(instance)
+	if len(errs) == 0 {
+		return warnings, nil
+	}
+	if h.validationMode == ValidationModeReject {
+		return warnings, errors.NewInvalid(schema.GroupKind{Group: "apps", Kind: h.kind}, instance.GetName(), errs)
+	}
+	invalid := []string{}
+	for _, err := range errs {
+		invalid = append(invalid, err.Error())
+	}
+	return append(invalid, warnings...), nil
+}
+
+// validateAnnotations returns an error for every Wave annotation of the
+// object which is unknown or has a value Wave does not understand
+func validateAnnotations(obj metav1.Object) field.ErrorList {
+	annotations := obj.GetAnnotations()
+	keys := []string{}
+	for key := range annotations {
+		if strings.HasPrefix(key, annotationPrefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	path := field.NewPath("metadata", "annotations")
+	errs := field.ErrorList{}
+	for _, key := range keys {
+		value := annotations[key]
+		switch key {
+		case RequiredAnnotation, SnapshotConfigAnnotation, BlastRadiusOverrideAnnotation, ImagePullSecretsAnnotation:
+			if value != "true" && value != "false" {
+				errs = append(errs, field.NotSupported(path.Key(key), value, []string{"true", "false"}))
+			}
+		case ExtraConfigMapsAnnotation, ExtraSecretsAnnotation:
+			_, invalid := parseExtraChildren(value, obj.GetNamespace())
+			for _, entry := range invalid {
+				errs = append(errs, field.Invalid(path.Key(key), entry, "must be a comma-separated list of name or namespace/name"))
+			}
+		case RolloutAfterAnnotation:
+			if _, err := parseRolloutAfter(obj); err != nil {
+				errs = append(errs, field.Invalid(path.Key(key), value, err.Error()))
+			}
+		case ChildDeletionPolicyAnnotation:
+			if _, err := ParseChildDeletionPolicy(value); err != nil {
+				errs = append(errs, field.NotSupported(path.Key(key), value, []string{string(ChildDeletionRoll), string(ChildDeletionFreeze), string(ChildDeletionIgnore)}))
+			}
+		case MissingChildrenPolicyAnnotation:
+			if _, err := ParseMissingChildrenPolicy(value); err != nil {
+				errs = append(errs, field.NotSupported(path.Key(key), value, []string{string(MissingChildrenHold), string(MissingChildrenGate), string(MissingChildrenProceed)}))
+			}
+		case UnreadableChildrenPolicyAnnotation:
+			if _, err := ParseUnreadableChildrenPolicy(value); err != nil {
+				errs = append(errs, field.NotSupported(path.Key(key), value, []string{string(UnreadableChildrenBlock), string(UnreadableChildrenHashReadable)}))
+			}
+		case ControllerClassAnnotation:
+			// Selects the Wave installation, a differing label would send the
+			// workload to the webhooks of another installation
+			if class, ok := obj.GetLabels()[ControllerClassLabel]; ok && class != value {
+				errs = append(errs, field.Invalid(path.Key(key), value, fmt.Sprintf("must match the %s label %q", ControllerClassLabel, class)))
+			}
+		case RehashRequestedAnnotation:
+			// Set by kubectl wave rehash
+		case SchedulingDisabledAnnotation, SchedulingDisabledSinceAnnotation, SchedulingDisabledByAnnotation, BlastRadiusPendingAnnotation, RolloutStatusAnnotation,
+			RolloutTriggerAnnotation, SnapshotHashAnnotation, MissingChildrenAnnotation, UnreadableChildrenAnnotation:
+			// Managed by Wave
+		default:
+			errs = append(errs, field.Invalid(path.Key(key), value, "unknown Wave annotation"))
+		}
+	}
+	return errs
+}
+
+// validateReferences returns warnings for required children which do not
+// exist and references Wave ignores
+func (h *Handler[I]) validateReferences(instance I) []string {
+	if !h.isEnabled(instance) {
+		return nil
+	}
+
+	configMapsConfig, secretsConfig, warnings := h.referencedChildren(instance)
+
+	configMaps, secrets, err := h.getCurrentChildren(configMapsConfig, secretsConfig)
+	if err != nil {
+		return append(warnings, fmt.Sprintf("unable to check children: %v", err))
+	}
+	if err := h.checkRequiredChildren(configMaps, secrets, configMapsConfig, secretsConfig); err != nil {
+		warnings = append(warnings, err.Error())
+	}
+	return warnings
+}
+
+// watchesNamespace returns true if the children in the namespace are cached
+func (h *Handler[I]) watchesNamespace(namespace string) bool {
+	if h.namespaceFilter.excludesFromCache(namespace) {
+		return false
+	}
+	return h.watchedNamespaces == nil || h.watchedNamespaces[namespace]
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/wave-k8s/wave/test/utils"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("Wave validation Suite", func() {
+	var deploymentObject *appsv1.Deployment
+
+	BeforeEach(func() {
+		deploymentObject = utils.ExampleDeployment.DeepCopy()
+		deploymentObject.Annotations[RequiredAnnotation] = requiredAnnotationValue
+	})
+
+	Context("validateAnnotations", func() {
+		It("accepts valid annotations", func() {
+			deploymentObject.Annotations[RolloutAfterAnnotation] = "deployment/backend"
+			Expect(validateAnnotations(deploymentObject)).To(BeEmpty())
+		})
+
+		It("rejects values other than true and false", func() {
+			deploymentObject.Annotations[RequiredAnnotation] = "True"
+			errs := validateAnnotations(deploymentObject)
+			Expect(errs).To(HaveLen(1))
+			Expect(errs[0].Field).To(Equal("metadata.annotations[wave.pusher.com/update-on-config-change]"))
+		})
+
+		It("rejects malformed extra children", func() {
+			deploymentObject.Annotations[ExtraConfigMapsAnnotation] = "a,b/c/d,, e,Ns/f"
+			errs := validateAnnotations(deploymentObject)
+			Expect(errs).To(HaveLen(4))
+			Expect(errs[0].BadValue).To(Equal("b/c/d"))
+			Expect(errs[1].BadValue).To(Equal(""))
+			Expect(errs[2].BadValue).To(Equal(" e"))
+			Expect(errs[3].BadValue).To(Equal("Ns/f"))
+		})
+
+		It("rejects malformed rollout-after references", func() {
+			deploymentObject.Annotations[RolloutAfterAnnotation] = "backend"
+			Expect(validateAnnotations(deploymentObject)).To(HaveLen(1))
+		})
+
+		It("rejects controller classes which differ from the label", func() {
+			deploymentObject.Annotations[ControllerClassAnnotation] = "team-a"
+			deploymentObject.Labels[ControllerClassLabel] = "team-a"
+			Expect(validateAnnotations(deploymentObject)).To(BeEmpty())
+			deploymentObject.Labels[ControllerClassLabel] = "team-b"
+			Expect(validateAnnotations(deploymentObject)).To(HaveLen(1))
+		})
+
+		It("rejects unknown annotations", func() {
+			deploymentObject.Annotations["wave.pusher.com/extra-configmap"] = "a"
+			Expect(validateAnnotations(deploymentObject)).To(HaveLen(1))
+		})
+	})
+
+	Context("ValidateWebhook", func() {
+		var h *Handler[*appsv1.Deployment]
+
+		BeforeEach(func() {
+			delete(deploymentObject.Annotations, ExtraSecretsAnnotation)
+			deploymentObject.Annotations[ExtraConfigMapsAnnotation] = "ns1/test-cm1,a/b/c"
+			c := fake.NewClientBuilder().WithObjects(utils.ExampleConfigMap2.DeepCopy()).Build()
+			h = NewHandler[*appsv1.Deployment](c, record.NewFakeRecorder(10), HandlerOptions{
+				WatchedNamespaces: []string{"default"},
+			})
+		})
+
+		It("returns warnings in warn mode", func() {
+			warnings, err := h.ValidateWebhook(deploymentObject)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(warnings).To(HaveLen(3))
+			Expect(warnings[0]).To(ContainSubstring("a/b/c"))
+			Expect(warnings[1]).To(Equal("configmap ns1/test-cm1 is in a namespace which Wave does not watch"))
+			Expect(warnings[2]).To(ContainSubstring("not all required children exist"))
+		})
+
+		It("rejects malformed annotations in reject mode", func() {
+			h.validationMode = ValidationModeReject
+			warnings, err := h.ValidateWebhook(deploymentObject)
+			Expect(errors.IsInvalid(err)).To(BeTrue())
+			Expect(warnings).To(HaveLen(2))
+		})
+
+		It("ignores children of workloads which are not enabled", func() {
+			delete(deploymentObject.Annotations, ExtraConfigMapsAnnotation)
+			deploymentObject.Annotations[RequiredAnnotation] = "false"
+			warnings, err := h.ValidateWebhook(deploymentObject)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(warnings).To(BeEmpty())
+		})
+	})
+
+	It("parses the validation mode", func() {
+		Expect(ParseValidationMode("reject")).To(Equal(ValidationModeReject))
+		_, err := ParseValidationMode("deny")
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -3,6 +3,7 @@ package core
 import (
 	"context"
 	"sync"
+	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
@@ -17,6 +18,9 @@ var _ handler.EventHandler = &enqueueRequestForWatcher{}
 type WatcherList struct {
 	watchers      map[types.NamespacedName]map[types.NamespacedName]bool
 	watchersMutex *sync.RWMutex
+	// lastChanged holds the time of the last update or deletion of every
+	// watched child
+	lastChanged map[types.NamespacedName]time.Time
 }
 
 type enqueueRequestForWatcher struct {
@@ -32,17 +36,21 @@ func EnqueueRequestForWatcher(watcherList WatcherList) handler.EventHandler {
 
 // Create implements EventHandler.
 func (e *enqueueRequestForWatcher) Create(ctx context.Context, evt event.CreateEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+	// Creations are not recorded since the initial sync of the informers
+	// reports all existing children as created
 	e.queueOwnerReconcileRequest(evt.Object, q)
 }
 
 // Update implements EventHandler.
 func (e *enqueueRequestForWatcher) Update(ctx context.Context, evt event.UpdateEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+	e.recordChange(evt.ObjectNew)
 	e.queueOwnerReconcileRequest(evt.ObjectOld, q)
 	e.queueOwnerReconcileRequest(evt.ObjectNew, q)
 }
 
 // Delete implements EventHandler.
 func (e *enqueueRequestForWatcher) Delete(ctx context.Context, evt event.DeleteEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+	e.recordChange(evt.Object)
 	e.queueOwnerReconcileRequest(evt.Object, q)
 }
 
@@ -65,6 +73,16 @@ func (e *enqueueRequestForWatcher) queueOwnerReconcileRequest(object metav1.Obje
 	e.watchersMutex.Unlock()
 }
 
+// recordChange records the time of the event if the object is watched
+func (e *enqueueRequestForWatcher) recordChange(object metav1.Object) {
+	name := GetNamespacedNameFromObject(object)
+	e.watchersMutex.Lock()
+	if _, ok := e.watchers[name]; ok && e.lastChanged != nil {
+		e.lastChanged[name] = time.Now()
+	}
+	e.watchersMutex.Unlock()
+}
+
 func (h *Handler[I]) GetWatchedConfigmaps() WatcherList {
 	return h.watchedConfigmaps
 }
@@ -76,6 +94,7 @@ func (h *Handler[I]) GetWatchedSecrets() WatcherList {
 func (h *Handler[I]) watchChildrenForInstance(instance I, configMaps configMetadataList, secrets configMetadataList) {
 	instanceName := GetNamespacedNameFromObject(instance)
 	h.watchedConfigmaps.watchersMutex.Lock()
+	lastChanged := h.watchedConfigmaps.lastChangedOf(configMaps)
 	h.removeWatchedConfigmapsInternal(instanceName)
 	for _, child := range configMaps {
 		if _, ok := h.watchedConfigmaps.watchers[child.name]; !ok {
@@ -83,8 +102,11 @@ func (h *Handler[I]) watchChildrenForInstance(instance I, configMaps configMetad
 		}
 		h.watchedConfigmaps.watchers[child.name][instanceName] = true
 	}
+	h.watchedConfigmaps.restoreLastChanged(lastChanged)
+	watchedChildren.WithLabelValues(h.kind, configMapKind).Set(float64(len(h.watchedConfigmaps.watchers)))
 	h.watchedConfigmaps.watchersMutex.Unlock()
 	h.watchedSecrets.watchersMutex.Lock()
+	lastChanged = h.watchedSecrets.lastChangedOf(secrets)
 	h.removeWatchedSecretsInternal(instanceName)
 	for _, child := range secrets {
 		if _, ok := h.watchedSecrets.watchers[child.name]; !ok {
@@ -92,6 +114,8 @@ func (h *Handler[I]) watchChildrenForInstance(instance I, configMaps configMetad
 		}
 		h.watchedSecrets.watchers[child.name][instanceName] = true
 	}
+	h.watchedSecrets.restoreLastChanged(lastChanged)
+	watchedChildren.WithLabelValues(h.kind, secretKind).Set(float64(len(h.watchedSecrets.watchers)))
 	h.watchedSecrets.watchersMutex.Unlock()
 }
 
@@ -102,10 +126,12 @@ func (h *Handler[I]) removeWatchesForInstance(instance I) {
 func (h *Handler[I]) RemoveWatches(instanceName types.NamespacedName) {
 	h.watchedConfigmaps.watchersMutex.Lock()
 	h.removeWatchedConfigmapsInternal(instanceName)
+	watchedChildren.WithLabelValues(h.kind, configMapKind).Set(float64(len(h.watchedConfigmaps.watchers)))
 	h.watchedConfigmaps.watchersMutex.Unlock()
 
 	h.watchedSecrets.watchersMutex.Lock()
 	h.removeWatchedSecretsInternal(instanceName)
+	watchedChildren.WithLabelValues(h.kind, secretKind).Set(float64(len(h.watchedSecrets.watchers)))
 	h.watchedSecrets.watchersMutex.Unlock()
 }
 
@@ -114,6 +140,7 @@ func (h *Handler[I]) removeWatchedConfigmapsInternal(instanceName types.Namespac
 		delete(watchers, instanceName)
 		if len(watchers) == 0 {
 			delete(h.watchedConfigmaps.watchers, child)
+			delete(h.watchedConfigmaps.lastChanged, child)
 		}
 	}
 }
@@ -123,6 +150,49 @@ func (h *Handler[I]) removeWatchedSecretsInternal(instanceName types.NamespacedN
 		delete(watchers, instanceName)
 		if len(watchers) == 0 {
 			delete(h.watchedSecrets.watchers, child)
+			delete(h.watchedSecrets.lastChanged, child)
+		}
+	}
+}
+
+// lastChangedOf returns the recorded changes of the children so that they
+// survive removing and re-adding the watches of an instance. The caller must
+// hold the watchersMutex.
+func (w WatcherList) lastChangedOf(children configMetadataList) map[types.NamespacedName]time.Time {
+	lastChanged := make(map[types.NamespacedName]time.Time)
+	for _, child := range children {
+		if changed, ok := w.lastChanged[child.name]; ok {
+			lastChanged[child.name] = changed
+		}
+	}
+	return lastChanged
+}
+
+// restoreLastChanged restores the changes returned by lastChangedOf. The
+// caller must hold the watchersMutex.
+func (w WatcherList) restoreLastChanged(lastChanged map[types.NamespacedName]time.Time) {
+	if w.lastChanged == nil {
+		return
+	}
+	for name, changed := range lastChanged {
+		w.lastChanged[name] = changed
+	}
+}
+
+// lastChildChange returns the time of the most recent event of any of the
+// children. It returns false if no event was observed.
+func (h *Handler[I]) lastChildChange(configMaps configMetadataList, secrets configMetadataList) (time.Time, bool) {
+	var last time.Time
+	latest := func(list WatcherList, children configMetadataList) {
+		list.watchersMutex.RLock()
+		defer list.watchersMutex.RUnlock()
+		for _, child := range children {
+			if changed, ok := list.lastChanged[child.name]; ok && changed.After(last) {
+				last = changed
+			}
 		}
 	}
+	latest(h.watchedConfigmaps, configMaps)
+	latest(h.watchedSecrets, secrets)
+	return last, !last.IsZero()
 }
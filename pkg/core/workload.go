@@ -0,0 +1,120 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// NewWorkload returns an empty workload object for a kind like it is given to
+// kubectl, e.g. deployment, sts or ds
+func NewWorkload(kind string) (client.Object, error) {
+	return newWorkload(kind)
+}
+
+// KindOf returns the kind of a workload, ConfigMap or Secret
+func KindOf(obj client.Object) string {
+	return kindOf(obj)
+}
+
+// newWorkload returns an empty workload object for the given kind
+// (deployment, statefulset or daemonset)
+func newWorkload(kind string) (client.Object, error) {
+	switch strings.ToLower(kind) {
+	case "deployment", "deployments", "deploy":
+		return &appsv1.Deployment{}, nil
+	case "statefulset", "statefulsets", "sts":
+		return &appsv1.StatefulSet{}, nil
+	case "daemonset", "daemonsets", "ds":
+		return &appsv1.DaemonSet{}, nil
+	}
+	return nil, fmt.Errorf("unsupported workload kind %q", kind)
+}
+
+// newWorkloadList returns an empty list for workloads of the given kind
+func newWorkloadList(kind string) (client.ObjectList, error) {
+	switch strings.ToLower(kind) {
+	case "deployment", "deployments", "deploy":
+		return &appsv1.DeploymentList{}, nil
+	case "statefulset", "statefulsets", "sts":
+		return &appsv1.StatefulSetList{}, nil
+	case "daemonset", "daemonsets", "ds":
+		return &appsv1.DaemonSetList{}, nil
+	}
+	return nil, fmt.Errorf("unsupported workload kind %q", kind)
+}
+
+// isRolloutComplete returns true if the controller of the workload has
+// observed its latest generation and all replicas are updated and ready
+func isRolloutComplete(obj client.Object) bool {
+	switch o := obj.(type) {
+	case *appsv1.Deployment:
+		replicas := int32(1)
+		if o.Spec.Replicas != nil {
+			replicas = *o.Spec.Replicas
+		}
+		return o.Status.ObservedGeneration >= o.Generation &&
+			o.Status.UpdatedReplicas == replicas &&
+			o.Status.ReadyReplicas == replicas &&
+			o.Status.Replicas == replicas
+	case *appsv1.StatefulSet:
+		replicas := int32(1)
+		if o.Spec.Replicas != nil {
+			replicas = *o.Spec.Replicas
+		}
+		return o.Status.ObservedGeneration >= o.Generation &&
+			o.Status.UpdatedReplicas == replicas &&
+			o.Status.ReadyReplicas == replicas
+	case *appsv1.DaemonSet:
+		return o.Status.ObservedGeneration >= o.Generation &&
+			o.Status.UpdatedNumberScheduled == o.Status.DesiredNumberScheduled &&
+			o.Status.NumberReady == o.Status.DesiredNumberScheduled
+	}
+	panic(fmt.Sprintf("Invalid type %s", reflect.TypeOf(obj)))
+}
+
+// readyReplicas returns the number of ready replicas of the workload
+func readyReplicas(obj client.Object) int32 {
+	switch o := obj.(type) {
+	case *appsv1.Deployment:
+		return o.Status.ReadyReplicas
+	case *appsv1.StatefulSet:
+		return o.Status.ReadyReplicas
+	case *appsv1.DaemonSet:
+		return o.Status.NumberReady
+	}
+	panic(fmt.Sprintf("Invalid type %s", reflect.TypeOf(obj)))
+}
+
+// rolloutFailure returns the reason reported by the controller of the
+// workload if its rollout failed or an empty string otherwise
+func rolloutFailure(obj client.Object) string {
+	if deployment, ok := obj.(*appsv1.Deployment); ok {
+		for _, condition := range deployment.Status.Conditions {
+			if condition.Type == appsv1.DeploymentProgressing && condition.Status == corev1.ConditionFalse && condition.Reason == "ProgressDeadlineExceeded" {
+				return condition.Message
+			}
+		}
+	}
+	return ""
+}
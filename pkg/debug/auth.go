@@ -0,0 +1,186 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package debug
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// +kubebuilder:rbac:groups=authentication.k8s.io,resources=tokenreviews,verbs=create
+// +kubebuilder:rbac:groups=authorization.k8s.io,resources=subjectaccessreviews,verbs=create
+
+const (
+	// allowedTTL is how long a token which may get a path is remembered
+	allowedTTL = time.Minute
+	// deniedTTL is how long a token which may not get a path is remembered
+	deniedTTL = 30 * time.Second
+)
+
+// authenticator checks bearer tokens with a TokenReview and authorizes the
+// user with a SubjectAccessReview for the non-resource URL of the request
+type authenticator struct {
+	client kubernetes.Interface
+	next   http.Handler
+
+	// now returns the current time, it is replaced in tests
+	now func() time.Time
+
+	mutex sync.Mutex
+	// reviews remembers the results of the reviews by the hash of the token
+	// and the path, so that repeated requests do not each create a
+	// TokenReview and a SubjectAccessReview
+	reviews map[string]review
+}
+
+// review is the remembered result of the reviews of a token and a path
+type review struct {
+	allowed bool
+	expires time.Time
+}
+
+// WithAuthentication wraps the handler so that it is only served to users who
+// are allowed to get the path of the request, e.g. by a ClusterRole with
+//
+//	nonResourceURLs: ["/debug/wave/graph"]
+//	verbs: ["get"]
+//
+// The results are remembered for a minute if the user may get the path and
+// for 30 seconds otherwise. The handler does not encrypt anything itself, so
+// it must be served over TLS to keep the bearer tokens secret.
+func WithAuthentication(config *rest.Config, next http.Handler) (http.Handler, error) {
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("error creating client for authentication: %v", err)
+	}
+	return newAuthenticator(client, next), nil
+}
+
+// newAuthenticator returns an authenticator which reviews tokens with the client
+func newAuthenticator(client kubernetes.Interface, next http.Handler) *authenticator {
+	return &authenticator{
+		client:  client,
+		next:    next,
+		now:     time.Now,
+		reviews: make(map[string]review),
+	}
+}
+
+// ServeHTTP implements http.Handler
+func (a *authenticator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	allowed, err := a.authorize(r.Context(), token, r.URL.Path)
+	if err != nil {
+		logf.Log.WithName("wave").Error(err, "Unable to authorize request", "path", r.URL.Path)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if !allowed {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	a.next.ServeHTTP(w, r)
+}
+
+// authorize returns true if the token belongs to a user who may get the path.
+// Results are remembered until they expire, errors are not.
+func (a *authenticator) authorize(ctx context.Context, token string, path string) (bool, error) {
+	sum := sha256.Sum256([]byte(token + "\x00" + path))
+	key := hex.EncodeToString(sum[:])
+
+	a.mutex.Lock()
+	cached, ok := a.reviews[key]
+	a.mutex.Unlock()
+	if ok && a.now().Before(cached.expires) {
+		return cached.allowed, nil
+	}
+
+	allowed, err := a.review(ctx, token, path)
+	if err != nil {
+		return false, err
+	}
+
+	ttl := deniedTTL
+	if allowed {
+		ttl = allowedTTL
+	}
+	now := a.now()
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	// Drop expired results so that the map does not grow with every token
+	for k, r := range a.reviews {
+		if !now.Before(r.expires) {
+			delete(a.reviews, k)
+		}
+	}
+	a.reviews[key] = review{allowed: allowed, expires: now.Add(ttl)}
+	return allowed, nil
+}
+
+// review creates a TokenReview and a SubjectAccessReview and returns true if
+// the token belongs to a user who may get the path
+func (a *authenticator) review(ctx context.Context, token string, path string) (bool, error) {
+	tokenReview, err := a.client.AuthenticationV1().TokenReviews().Create(ctx, &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{Token: token},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return false, fmt.Errorf("error creating TokenReview: %v", err)
+	}
+	if !tokenReview.Status.Authenticated {
+		return false, nil
+	}
+
+	user := tokenReview.Status.User
+	extra := make(map[string]authorizationv1.ExtraValue, len(user.Extra))
+	for key, value := range user.Extra {
+		extra[key] = authorizationv1.ExtraValue(value)
+	}
+	accessReview, err := a.client.AuthorizationV1().SubjectAccessReviews().Create(ctx, &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			User:   user.Username,
+			UID:    user.UID,
+			Groups: user.Groups,
+			Extra:  extra,
+			NonResourceAttributes: &authorizationv1.NonResourceAttributes{
+				Path: path,
+				Verb: "get",
+			},
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return false, fmt.Errorf("error creating SubjectAccessReview: %v", err)
+	}
+	return accessReview.Status.Allowed, nil
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2018 Pusher Ltd. and Wave Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package debug
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+var _ = Describe("Wave debug authentication Suite", func() {
+	const path = "/debug/wave/graph"
+	var a *authenticator
+	var clientset *fake.Clientset
+	var reviewed *authorizationv1.SubjectAccessReview
+	var now time.Time
+
+	BeforeEach(func() {
+		reviewed = nil
+		now = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		clientset = fake.NewClientset()
+		// Only the token "valid" belongs to a user and only "alice" may get the path
+		clientset.PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			review := action.(k8stesting.CreateAction).GetObject().(*authenticationv1.TokenReview).DeepCopy()
+			switch review.Spec.Token {
+			case "valid":
+				review.Status = authenticationv1.TokenReviewStatus{Authenticated: true, User: authenticationv1.UserInfo{Username: "alice", Groups: []string{"team-a"}}}
+			case "forbidden":
+				review.Status = authenticationv1.TokenReviewStatus{Authenticated: true, User: authenticationv1.UserInfo{Username: "bob"}}
+			case "error":
+				return true, nil, fmt.Errorf("unavailable")
+			}
+			return true, review, nil
+		})
+		clientset.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			reviewed = action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SubjectAccessReview).DeepCopy()
+			reviewed.Status.Allowed = reviewed.Spec.User == "alice"
+			return true, reviewed, nil
+		})
+		a = newAuthenticator(clientset, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			fmt.Fprint(w, "graph")
+		}))
+		a.now = func() time.Time { return now }
+	})
+
+	serve := func(authorization string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		if authorization != "" {
+			r.Header.Set("Authorization", authorization)
+		}
+		w := httptest.NewRecorder()
+		a.ServeHTTP(w, r)
+		return w
+	}
+
+	DescribeTable("answers requests",
+		func(authorization string, status int) {
+			Expect(serve(authorization).Code).To(Equal(status))
+		},
+		Entry("without a token", "", http.StatusUnauthorized),
+		Entry("with another scheme", "Basic dXNlcjpwYXNz", http.StatusUnauthorized),
+		Entry("with an empty token", "Bearer ", http.StatusUnauthorized),
+		Entry("with an unknown token", "Bearer wrong", http.StatusForbidden),
+		Entry("with a token of a user who may not get the path", "Bearer forbidden", http.StatusForbidden),
+		Entry("when the token cannot be reviewed", "Bearer error", http.StatusInternalServerError),
+	)
+
+	It("serves users who may get the path", func() {
+		w := serve("Bearer valid")
+		Expect(w.Code).To(Equal(http.StatusOK))
+		Expect(w.Body.String()).To(Equal("graph"))
+		Expect(reviewed.Spec.Groups).To(Equal([]string{"team-a"}))
+		Expect(reviewed.Spec.NonResourceAttributes).To(Equal(&authorizationv1.NonResourceAttributes{Path: path, Verb: "get"}))
+	})
+
+	Context("when a token was reviewed", func() {
+		DescribeTable("does not review it again until the result expires",
+			func(token string, status int, ttl time.Duration) {
+				Expect(serve("Bearer " + token).Code).To(Equal(status))
+				reviews := len(clientset.Actions())
+
+				now = now.Add(ttl - time.Second)
+				Expect(serve("Bearer " + token).Code).To(Equal(status))
+				Expect(clientset.Actions()).To(HaveLen(reviews))
+
+				now = now.Add(time.Second)
+				Expect(serve("Bearer " + token).Code).To(Equal(status))
+				Expect(len(clientset.Actions())).To(BeNumerically(">", reviews))
+			},
+			Entry("for a user who may get the path", "valid", http.StatusOK, allowedTTL),
+			Entry("for a user who may not get the path", "forbidden", http.StatusForbidden, deniedTTL),
+			Entry("for an unknown token", "wrong", http.StatusForbidden, deniedTTL),
+		)
+
+		It("reviews it again for another path", func() {
+			Expect(serve("Bearer valid").Code).To(Equal(http.StatusOK))
+			reviews := len(clientset.Actions())
+
+			r := httptest.NewRequest(http.MethodGet, "/debug/other", nil)
+			r.Header.Set("Authorization", "Bearer valid")
+			a.ServeHTTP(httptest.NewRecorder(), r)
+			Expect(len(clientset.Actions())).To(BeNumerically(">", reviews))
+			Expect(reviewed.Spec.NonResourceAttributes.Path).To(Equal("/debug/other"))
+		})
+
+		It("does not remember errors", func() {
+			Expect(serve("Bearer error").Code).To(Equal(http.StatusInternalServerError))
+			reviews := len(clientset.Actions())
+			Expect(serve("Bearer error").Code).To(Equal(http.StatusInternalServerError))
+			Expect(len(clientset.Actions())).To(BeNumerically(">", reviews))
+		})
+	})
+})